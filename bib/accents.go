@@ -0,0 +1,865 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+/*=====================================================================================
+ * Accented letters
+ *
+ * Tables that relate LaTeX accent commands (\'e, \c{c}, \ss, ...) to the
+ * Unicode characters they produce.
+ *====================================================================================*/
+
+// accentedLetter is a letter with an accent. Accent is the character that
+// names the LaTeX accent command (e.g. ' for \', or c for \c).
+type accentedLetter struct {
+	Accent rune
+	Base   rune
+}
+
+// specialLetter is a letter that LaTeX writes with a command of its own
+// rather than as an accent on a base letter.
+type specialLetter struct {
+	Macro string
+	R     rune
+	ASCII string
+}
+
+// specialLetters lists the letters that have their own LaTeX commands.
+var specialLetters = []specialLetter{
+	{"ss", 'ß', "ss"},
+	{"ae", 'æ', "ae"},
+	{"AE", 'Æ', "AE"},
+	{"oe", 'œ', "oe"},
+	{"OE", 'Œ', "OE"},
+	{"aa", 'å', "a"},
+	{"AA", 'Å', "A"},
+	{"o", 'ø', "o"},
+	{"O", 'Ø', "O"},
+	{"l", 'ł', "l"},
+	{"L", 'Ł', "L"},
+	{"i", 'ı', "i"},
+	{"j", 'ȷ', "j"},
+}
+
+// unicodeAccents maps precomposed Unicode letters to their accent and base
+// letter.
+var unicodeAccents = map[rune]accentedLetter{
+	'À': {'`', 'A'},
+	'Á': {'\'', 'A'},
+	'Â': {'^', 'A'},
+	'Ã': {'~', 'A'},
+	'Ä': {'"', 'A'},
+	'Å': {'r', 'A'},
+	'Ç': {'c', 'C'},
+	'È': {'`', 'E'},
+	'É': {'\'', 'E'},
+	'Ê': {'^', 'E'},
+	'Ë': {'"', 'E'},
+	'Ì': {'`', 'I'},
+	'Í': {'\'', 'I'},
+	'Î': {'^', 'I'},
+	'Ï': {'"', 'I'},
+	'Ñ': {'~', 'N'},
+	'Ò': {'`', 'O'},
+	'Ó': {'\'', 'O'},
+	'Ô': {'^', 'O'},
+	'Õ': {'~', 'O'},
+	'Ö': {'"', 'O'},
+	'Ù': {'`', 'U'},
+	'Ú': {'\'', 'U'},
+	'Û': {'^', 'U'},
+	'Ü': {'"', 'U'},
+	'Ý': {'\'', 'Y'},
+	'à': {'`', 'a'},
+	'á': {'\'', 'a'},
+	'â': {'^', 'a'},
+	'ã': {'~', 'a'},
+	'ä': {'"', 'a'},
+	'å': {'r', 'a'},
+	'ç': {'c', 'c'},
+	'è': {'`', 'e'},
+	'é': {'\'', 'e'},
+	'ê': {'^', 'e'},
+	'ë': {'"', 'e'},
+	'ì': {'`', 'i'},
+	'í': {'\'', 'i'},
+	'î': {'^', 'i'},
+	'ï': {'"', 'i'},
+	'ñ': {'~', 'n'},
+	'ò': {'`', 'o'},
+	'ó': {'\'', 'o'},
+	'ô': {'^', 'o'},
+	'õ': {'~', 'o'},
+	'ö': {'"', 'o'},
+	'ù': {'`', 'u'},
+	'ú': {'\'', 'u'},
+	'û': {'^', 'u'},
+	'ü': {'"', 'u'},
+	'ý': {'\'', 'y'},
+	'ÿ': {'"', 'y'},
+	'Ā': {'=', 'A'},
+	'ā': {'=', 'a'},
+	'Ă': {'u', 'A'},
+	'ă': {'u', 'a'},
+	'Ą': {'k', 'A'},
+	'ą': {'k', 'a'},
+	'Ć': {'\'', 'C'},
+	'ć': {'\'', 'c'},
+	'Ĉ': {'^', 'C'},
+	'ĉ': {'^', 'c'},
+	'Ċ': {'.', 'C'},
+	'ċ': {'.', 'c'},
+	'Č': {'v', 'C'},
+	'č': {'v', 'c'},
+	'Ď': {'v', 'D'},
+	'ď': {'v', 'd'},
+	'Ē': {'=', 'E'},
+	'ē': {'=', 'e'},
+	'Ĕ': {'u', 'E'},
+	'ĕ': {'u', 'e'},
+	'Ė': {'.', 'E'},
+	'ė': {'.', 'e'},
+	'Ę': {'k', 'E'},
+	'ę': {'k', 'e'},
+	'Ě': {'v', 'E'},
+	'ě': {'v', 'e'},
+	'Ĝ': {'^', 'G'},
+	'ĝ': {'^', 'g'},
+	'Ğ': {'u', 'G'},
+	'ğ': {'u', 'g'},
+	'Ġ': {'.', 'G'},
+	'ġ': {'.', 'g'},
+	'Ģ': {'c', 'G'},
+	'ģ': {'c', 'g'},
+	'Ĥ': {'^', 'H'},
+	'ĥ': {'^', 'h'},
+	'Ĩ': {'~', 'I'},
+	'ĩ': {'~', 'i'},
+	'Ī': {'=', 'I'},
+	'ī': {'=', 'i'},
+	'Ĭ': {'u', 'I'},
+	'ĭ': {'u', 'i'},
+	'Į': {'k', 'I'},
+	'į': {'k', 'i'},
+	'İ': {'.', 'I'},
+	'Ĵ': {'^', 'J'},
+	'ĵ': {'^', 'j'},
+	'Ķ': {'c', 'K'},
+	'ķ': {'c', 'k'},
+	'Ĺ': {'\'', 'L'},
+	'ĺ': {'\'', 'l'},
+	'Ļ': {'c', 'L'},
+	'ļ': {'c', 'l'},
+	'Ľ': {'v', 'L'},
+	'ľ': {'v', 'l'},
+	'Ń': {'\'', 'N'},
+	'ń': {'\'', 'n'},
+	'Ņ': {'c', 'N'},
+	'ņ': {'c', 'n'},
+	'Ň': {'v', 'N'},
+	'ň': {'v', 'n'},
+	'Ō': {'=', 'O'},
+	'ō': {'=', 'o'},
+	'Ŏ': {'u', 'O'},
+	'ŏ': {'u', 'o'},
+	'Ő': {'H', 'O'},
+	'ő': {'H', 'o'},
+	'Ŕ': {'\'', 'R'},
+	'ŕ': {'\'', 'r'},
+	'Ŗ': {'c', 'R'},
+	'ŗ': {'c', 'r'},
+	'Ř': {'v', 'R'},
+	'ř': {'v', 'r'},
+	'Ś': {'\'', 'S'},
+	'ś': {'\'', 's'},
+	'Ŝ': {'^', 'S'},
+	'ŝ': {'^', 's'},
+	'Ş': {'c', 'S'},
+	'ş': {'c', 's'},
+	'Š': {'v', 'S'},
+	'š': {'v', 's'},
+	'Ţ': {'c', 'T'},
+	'ţ': {'c', 't'},
+	'Ť': {'v', 'T'},
+	'ť': {'v', 't'},
+	'Ũ': {'~', 'U'},
+	'ũ': {'~', 'u'},
+	'Ū': {'=', 'U'},
+	'ū': {'=', 'u'},
+	'Ŭ': {'u', 'U'},
+	'ŭ': {'u', 'u'},
+	'Ů': {'r', 'U'},
+	'ů': {'r', 'u'},
+	'Ű': {'H', 'U'},
+	'ű': {'H', 'u'},
+	'Ų': {'k', 'U'},
+	'ų': {'k', 'u'},
+	'Ŵ': {'^', 'W'},
+	'ŵ': {'^', 'w'},
+	'Ŷ': {'^', 'Y'},
+	'ŷ': {'^', 'y'},
+	'Ÿ': {'"', 'Y'},
+	'Ź': {'\'', 'Z'},
+	'ź': {'\'', 'z'},
+	'Ż': {'.', 'Z'},
+	'ż': {'.', 'z'},
+	'Ž': {'v', 'Z'},
+	'ž': {'v', 'z'},
+	'Ǎ': {'v', 'A'},
+	'ǎ': {'v', 'a'},
+	'Ǐ': {'v', 'I'},
+	'ǐ': {'v', 'i'},
+	'Ǒ': {'v', 'O'},
+	'ǒ': {'v', 'o'},
+	'Ǔ': {'v', 'U'},
+	'ǔ': {'v', 'u'},
+	'Ǧ': {'v', 'G'},
+	'ǧ': {'v', 'g'},
+	'Ǩ': {'v', 'K'},
+	'ǩ': {'v', 'k'},
+	'Ǫ': {'k', 'O'},
+	'ǫ': {'k', 'o'},
+	'ǰ': {'v', 'j'},
+	'Ǵ': {'\'', 'G'},
+	'ǵ': {'\'', 'g'},
+	'Ǹ': {'`', 'N'},
+	'ǹ': {'`', 'n'},
+	'Ș': {'c', 'S'},
+	'ș': {'c', 's'},
+	'Ț': {'c', 'T'},
+	'ț': {'c', 't'},
+	'Ȟ': {'v', 'H'},
+	'ȟ': {'v', 'h'},
+	'Ȧ': {'.', 'A'},
+	'ȧ': {'.', 'a'},
+	'Ȩ': {'c', 'E'},
+	'ȩ': {'c', 'e'},
+	'Ȯ': {'.', 'O'},
+	'ȯ': {'.', 'o'},
+	'Ȳ': {'=', 'Y'},
+	'ȳ': {'=', 'y'},
+	'Ḃ': {'.', 'B'},
+	'ḃ': {'.', 'b'},
+	'Ḅ': {'d', 'B'},
+	'ḅ': {'d', 'b'},
+	'Ḇ': {'b', 'B'},
+	'ḇ': {'b', 'b'},
+	'Ḋ': {'.', 'D'},
+	'ḋ': {'.', 'd'},
+	'Ḍ': {'d', 'D'},
+	'ḍ': {'d', 'd'},
+	'Ḏ': {'b', 'D'},
+	'ḏ': {'b', 'd'},
+	'Ḑ': {'c', 'D'},
+	'ḑ': {'c', 'd'},
+	'Ḟ': {'.', 'F'},
+	'ḟ': {'.', 'f'},
+	'Ḡ': {'=', 'G'},
+	'ḡ': {'=', 'g'},
+	'Ḣ': {'.', 'H'},
+	'ḣ': {'.', 'h'},
+	'Ḥ': {'d', 'H'},
+	'ḥ': {'d', 'h'},
+	'Ḧ': {'"', 'H'},
+	'ḧ': {'"', 'h'},
+	'Ḩ': {'c', 'H'},
+	'ḩ': {'c', 'h'},
+	'Ḱ': {'\'', 'K'},
+	'ḱ': {'\'', 'k'},
+	'Ḳ': {'d', 'K'},
+	'ḳ': {'d', 'k'},
+	'Ḵ': {'b', 'K'},
+	'ḵ': {'b', 'k'},
+	'Ḷ': {'d', 'L'},
+	'ḷ': {'d', 'l'},
+	'Ḻ': {'b', 'L'},
+	'ḻ': {'b', 'l'},
+	'Ḿ': {'\'', 'M'},
+	'ḿ': {'\'', 'm'},
+	'Ṁ': {'.', 'M'},
+	'ṁ': {'.', 'm'},
+	'Ṃ': {'d', 'M'},
+	'ṃ': {'d', 'm'},
+	'Ṅ': {'.', 'N'},
+	'ṅ': {'.', 'n'},
+	'Ṇ': {'d', 'N'},
+	'ṇ': {'d', 'n'},
+	'Ṉ': {'b', 'N'},
+	'ṉ': {'b', 'n'},
+	'Ṕ': {'\'', 'P'},
+	'ṕ': {'\'', 'p'},
+	'Ṗ': {'.', 'P'},
+	'ṗ': {'.', 'p'},
+	'Ṙ': {'.', 'R'},
+	'ṙ': {'.', 'r'},
+	'Ṛ': {'d', 'R'},
+	'ṛ': {'d', 'r'},
+	'Ṟ': {'b', 'R'},
+	'ṟ': {'b', 'r'},
+	'Ṡ': {'.', 'S'},
+	'ṡ': {'.', 's'},
+	'Ṣ': {'d', 'S'},
+	'ṣ': {'d', 's'},
+	'Ṫ': {'.', 'T'},
+	'ṫ': {'.', 't'},
+	'Ṭ': {'d', 'T'},
+	'ṭ': {'d', 't'},
+	'Ṯ': {'b', 'T'},
+	'ṯ': {'b', 't'},
+	'Ṽ': {'~', 'V'},
+	'ṽ': {'~', 'v'},
+	'Ṿ': {'d', 'V'},
+	'ṿ': {'d', 'v'},
+	'Ẁ': {'`', 'W'},
+	'ẁ': {'`', 'w'},
+	'Ẃ': {'\'', 'W'},
+	'ẃ': {'\'', 'w'},
+	'Ẅ': {'"', 'W'},
+	'ẅ': {'"', 'w'},
+	'Ẇ': {'.', 'W'},
+	'ẇ': {'.', 'w'},
+	'Ẉ': {'d', 'W'},
+	'ẉ': {'d', 'w'},
+	'Ẋ': {'.', 'X'},
+	'ẋ': {'.', 'x'},
+	'Ẍ': {'"', 'X'},
+	'ẍ': {'"', 'x'},
+	'Ẏ': {'.', 'Y'},
+	'ẏ': {'.', 'y'},
+	'Ẑ': {'^', 'Z'},
+	'ẑ': {'^', 'z'},
+	'Ẓ': {'d', 'Z'},
+	'ẓ': {'d', 'z'},
+	'Ẕ': {'b', 'Z'},
+	'ẕ': {'b', 'z'},
+	'ẖ': {'b', 'h'},
+	'ẗ': {'"', 't'},
+	'ẘ': {'r', 'w'},
+	'ẙ': {'r', 'y'},
+	'Ạ': {'d', 'A'},
+	'ạ': {'d', 'a'},
+	'Ẹ': {'d', 'E'},
+	'ẹ': {'d', 'e'},
+	'Ẽ': {'~', 'E'},
+	'ẽ': {'~', 'e'},
+	'Ị': {'d', 'I'},
+	'ị': {'d', 'i'},
+	'Ọ': {'d', 'O'},
+	'ọ': {'d', 'o'},
+	'Ụ': {'d', 'U'},
+	'ụ': {'d', 'u'},
+	'Ỳ': {'`', 'Y'},
+	'ỳ': {'`', 'y'},
+	'Ỵ': {'d', 'Y'},
+	'ỵ': {'d', 'y'},
+	'Ỹ': {'~', 'Y'},
+	'ỹ': {'~', 'y'},
+}
+
+var (
+	latexSymbolAccent = regexp.MustCompile(`\\([` + "`" + `'^"~=.])\s*(?:\{\s*(\\?[a-zA-Z])\s*\}|(\\?[a-zA-Z]))`)
+	latexLetterAccent = regexp.MustCompile(`\\([cuvHkrdbt])(?:\s*\{\s*(\\?[a-zA-Z])\s*\}|\s+(\\?[a-zA-Z]))`)
+	latexSpecial      = regexp.MustCompile(`\\(ss|ae|AE|oe|OE|aa|AA|o|O|l|L|i|j)(\{\}|\s+|[^a-zA-Z]|$)`)
+)
+
+// stripLaTeXAccents removes LaTeX accent commands from s, leaving the base
+// letters, and replaces the special letter commands (\ss, \o, ...) with
+// their ASCII equivalents.
+func stripLaTeXAccents(s string) string {
+	base := func(m []string) string {
+		b := m[2]
+		if b == "" {
+			b = m[3]
+		}
+		return strings.TrimPrefix(b, "\\")
+	}
+	s = latexSymbolAccent.ReplaceAllStringFunc(s, func(x string) string {
+		return base(latexSymbolAccent.FindStringSubmatch(x))
+	})
+	s = latexLetterAccent.ReplaceAllStringFunc(s, func(x string) string {
+		return base(latexLetterAccent.FindStringSubmatch(x))
+	})
+	s = latexSpecial.ReplaceAllStringFunc(s, func(x string) string {
+		m := latexSpecial.FindStringSubmatch(x)
+		for _, sl := range specialLetters {
+			if sl.Macro == m[1] {
+				// a following {} or space only terminates the command
+				if m[2] == "{}" || strings.TrimSpace(m[2]) == "" {
+					return sl.ASCII
+				}
+				return sl.ASCII + m[2]
+			}
+		}
+		return x
+	})
+	return s
+}
+
+// foldAccents returns s with the accents removed from accented letters,
+// whether they are written as LaTeX commands or as Unicode characters.
+func foldAccents(s string) string {
+	s = stripLaTeXAccents(s)
+	var b strings.Builder
+	for _, r := range s {
+		if a, ok := unicodeAccents[r]; ok {
+			b.WriteRune(a.Base)
+			continue
+		}
+		if r > unicode.MaxASCII {
+			special := false
+			for _, sl := range specialLetters {
+				if sl.R == r {
+					b.WriteString(sl.ASCII)
+					special = true
+					break
+				}
+			}
+			if special {
+				continue
+			}
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// accentMarks maps the LaTeX accent commands to the Unicode combining marks
+// they produce.
+var accentMarks = map[rune]rune{
+	'`':  '̀',
+	'\'': '́',
+	'^':  '̂',
+	'~':  '̃',
+	'=':  '̄',
+	'u':  '̆',
+	'.':  '̇',
+	'"':  '̈',
+	'r':  '̊',
+	'H':  '̋',
+	'v':  '̌',
+	'c':  '̧',
+	'k':  '̨',
+	'd':  '̣',
+	'b':  '̱',
+}
+
+// composedLetters is the inverse of unicodeAccents. If two letters have the
+// same accent and base (e.g. s with a cedilla and s with a comma below), the
+// one with the smallest code point is used.
+var composedLetters = func() map[accentedLetter]rune {
+	m := make(map[accentedLetter]rune)
+	for r, a := range unicodeAccents {
+		if old, ok := m[a]; !ok || r < old {
+			m[a] = r
+		}
+	}
+	return m
+}()
+
+// composeAccent returns the letter base with the given LaTeX accent as a
+// Unicode string: a precomposed letter if there is one, and the base followed
+// by a combining mark otherwise.
+func composeAccent(accent rune, base string) string {
+	// \i and \j are the dotless i and j, used under accents
+	base = strings.TrimPrefix(base, "\\")
+	if b := []rune(base); len(b) == 1 {
+		if r, ok := composedLetters[accentedLetter{accent, b[0]}]; ok {
+			return string(r)
+		}
+	}
+	if mark, ok := accentMarks[accent]; ok {
+		return base + string(mark)
+	}
+	return base
+}
+
+// latexTextCommands are commands whose argument is kept as plain text when
+// converting LaTeX to text.
+var latexTextCommands = map[string]bool{
+	"emph":   true,
+	"textit": true,
+	"textbf": true,
+	"textsc": true,
+	"textrm": true,
+	"textsf": true,
+	"texttt": true,
+	"textup": true,
+	"textsl": true,
+	"mbox":   true,
+	"url":    true,
+}
+
+// latexSymbols maps LaTeX symbol commands to the characters they produce.
+var latexSymbols = map[string]string{
+	"textendash":         "–",
+	"textemdash":         "—",
+	"textquoteleft":      "‘",
+	"textquoteright":     "’",
+	"textquotedblleft":   "“",
+	"textquotedblright":  "”",
+	"textregistered":     "®",
+	"textcopyright":      "©",
+	"texttrademark":      "™",
+	"textdegree":         "°",
+	"textellipsis":       "…",
+	"ldots":              "…",
+	"dots":               "…",
+	"textbackslash":      "\\",
+	"textasciitilde":     "~",
+	"textunderscore":     "_",
+	"textbar":            "|",
+	"textless":           "<",
+	"textgreater":        ">",
+	"textperiodcentered": "·",
+	"textsection":        "§",
+	"S":                  "§",
+	"P":                  "¶",
+	"pounds":             "£",
+	"euro":               "€",
+}
+
+// latexLigatures are the ligatures of the standard LaTeX fonts that produce
+// Unicode punctuation, longest first.
+var latexLigatures = []struct{ from, to string }{
+	{"---", "—"},
+	{"--", "–"},
+	{"``", "“"},
+	{"''", "”"},
+	{"!`", "¡"},
+	{"?`", "¿"},
+}
+
+// latexEscapes are the escaped characters and ties replaced when converting
+// LaTeX to plain text.
+var latexEscapes = []struct{ from, to string }{
+	{`\&`, "&"},
+	{`\%`, "%"},
+	{`\$`, "$"},
+	{`\#`, "#"},
+	{`\_`, "_"},
+	{`\{`, "\x00{"},
+	{`\}`, "\x00}"},
+	{"~", " "},
+}
+
+// latexMath maps the math written by unicodeToLaTeX (e.g. $\alpha$) back to
+// Unicode.
+var latexMath = func() map[string]string {
+	m := make(map[string]string)
+	for r, sym := range unicodeSymbols {
+		if strings.HasPrefix(sym, "$") {
+			m[sym] = string(r)
+		}
+	}
+	for r, name := range greekLetters {
+		m[`$\`+name+`$`] = string(r)
+	}
+	return m
+}()
+
+var (
+	latexCommand      = regexp.MustCompile(`\\([a-zA-Z]+)\s*(\{\}|\s)?`)
+	latexMathSymbol   = regexp.MustCompile(`\$[^$]{1,16}\$`)
+	latexTrailingCmd  = regexp.MustCompile(`\\([` + "`" + `'^"~=.]|[cuvHkrdbt]|ss|ae|AE|oe|OE|aa|AA|o|O|l|L|i|j)\s*$`)
+	latexAccentGroup  = regexp.MustCompile(`^\s*\\(?:[` + "`" + `'^"~=.]\s*\{?\s*\\?[a-zA-Z]\s*\}?|[cuvHkrdbt](?:\s*\{\s*\\?[a-zA-Z]\s*\}|\s+\\?[a-zA-Z])|(?:ss|ae|AE|oe|OE|aa|AA|o|O|l|L|i|j)(?:\{\})?)\s*$`)
+	latexCommandGroup = regexp.MustCompile(`^\s*\\([a-zA-Z]+)\s*$`)
+)
+
+// decodeLaTeXText converts the accents, special letters, ligatures, symbol
+// commands and simple math in a string that has no {} groups.
+func decodeLaTeXText(s string) string {
+	s = latexSymbolAccent.ReplaceAllStringFunc(s, func(x string) string {
+		m := latexSymbolAccent.FindStringSubmatch(x)
+		return composeAccent([]rune(m[1])[0], m[2]+m[3])
+	})
+	s = latexLetterAccent.ReplaceAllStringFunc(s, func(x string) string {
+		m := latexLetterAccent.FindStringSubmatch(x)
+		return composeAccent([]rune(m[1])[0], m[2]+m[3])
+	})
+	s = latexSpecial.ReplaceAllStringFunc(s, func(x string) string {
+		m := latexSpecial.FindStringSubmatch(x)
+		for _, sl := range specialLetters {
+			if sl.Macro == m[1] {
+				if m[2] == "{}" || strings.TrimSpace(m[2]) == "" {
+					return string(sl.R)
+				}
+				return string(sl.R) + m[2]
+			}
+		}
+		return x
+	})
+	for _, rep := range latexLigatures {
+		s = strings.ReplaceAll(s, rep.from, rep.to)
+	}
+	s = latexMathSymbol.ReplaceAllStringFunc(s, func(x string) string {
+		if r, ok := latexMath[x]; ok {
+			return r
+		}
+		return x
+	})
+	return latexCommand.ReplaceAllStringFunc(s, func(x string) string {
+		m := latexCommand.FindStringSubmatch(x)
+		if sym, ok := latexSymbols[m[1]]; ok {
+			return sym
+		}
+		return x
+	})
+}
+
+// isDecorationGroup returns true iff the {} group bn holds only an accented
+// or special letter ({\"o}, {\"{o}}, {\ss}) or a symbol command ({\ldots}).
+// BibTeX doesn't change the case inside such groups, so their braces only
+// delimit the command and can be dropped once it's decoded.
+func isDecorationGroup(bn *BraceNode) bool {
+	inner := bn.flatten(true, true)
+	if latexAccentGroup.MatchString(inner) {
+		return true
+	}
+	m := latexCommandGroup.FindStringSubmatch(inner)
+	return m != nil && latexSymbols[m[1]] != ""
+}
+
+// decodeBraceChildren converts the children of bn to Unicode, keeping the
+// braces of groups that protect case. An accent command at the end of a leaf
+// takes its argument from the group that follows (\"{o}, \c{c}, \ss{}).
+func decodeBraceChildren(bn *BraceNode) string {
+	var b strings.Builder
+	kids := bn.Children
+	for i := 0; i < len(kids); i++ {
+		c := kids[i]
+		if !c.IsLeaf() {
+			if isDecorationGroup(c) {
+				b.WriteString(decodeBraceChildren(c))
+			} else {
+				b.WriteString("{" + decodeBraceChildren(c) + "}")
+			}
+			continue
+		}
+
+		leaf := c.Leaf
+		if i+1 < len(kids) && !kids[i+1].IsLeaf() {
+			if m := latexTrailingCmd.FindStringSubmatchIndex(leaf); m != nil {
+				cmd := leaf[m[2]:m[3]]
+				arg := strings.TrimSpace(kids[i+1].flatten(true, true))
+				if len(cmd) == 1 && (len(arg) == 1 || (len(arg) == 2 && arg[0] == '\\')) {
+					// an accent and its argument
+					b.WriteString(decodeLaTeXText(leaf[:m[0]]))
+					b.WriteString(composeAccent([]rune(cmd)[0], arg))
+					i++
+					continue
+				} else if len(cmd) > 1 && arg == "" {
+					// a special letter terminated by {}
+					b.WriteString(decodeLaTeXText(leaf[:m[0]] + `\` + cmd))
+					i++
+					continue
+				}
+			}
+		}
+		b.WriteString(decodeLaTeXText(leaf))
+	}
+	return b.String()
+}
+
+// LaTeXToUnicode converts the LaTeX accents in s to Unicode in any of their
+// brace forms (\"{o}, {\"o} and \"o all become ö), along with the special
+// letters (\ss becomes ß), dash and quote ligatures, symbol commands
+// (\ldots) and the math that ConvertUnicodeToLaTeX writes ($\alpha$). Braces
+// that only delimited an accent are dropped; braces that protect case are
+// kept, so {\"O}zt{\"u}rk becomes Öztürk but {DNA} stays {DNA}. Escaped
+// characters (\&, \%, ...) and other commands are left alone, so the result
+// is still valid in a .bib file read by biber.
+func LaTeXToUnicode(s string) string {
+	// \{ and \} don't delimit groups, and a string with unbalanced braces
+	// can't be parsed into a tree, so just convert the text in them
+	depth := 0
+	for _, r := range s {
+		if r == '{' {
+			depth++
+		} else if r == '}' {
+			depth--
+		}
+		if depth < 0 {
+			break
+		}
+	}
+	if depth != 0 || strings.Contains(s, `\{`) || strings.Contains(s, `\}`) {
+		return decodeLaTeXText(s)
+	}
+	bt, _ := ParseBraceTree(s)
+	return decodeBraceChildren(bt)
+}
+
+// latexToText converts a LaTeX string into plain Unicode text. In addition to
+// the conversions of LaTeXToUnicode, escaped characters and ties are
+// converted, the text formatting commands (\emph, \textbf, ...) are dropped,
+// and so are all the {} that aren't escaped. Other commands and math are left
+// alone.
+func latexToText(s string) string {
+	s = LaTeXToUnicode(s)
+	for _, rep := range latexEscapes {
+		s = strings.ReplaceAll(s, rep.from, rep.to)
+	}
+	s = latexCommand.ReplaceAllStringFunc(s, func(x string) string {
+		m := latexCommand.FindStringSubmatch(x)
+		if latexTextCommands[m[1]] {
+			return ""
+		}
+		return x
+	})
+
+	// drop the unescaped {}, which were marked with a \x00 above
+	var b strings.Builder
+	escaped := false
+	for _, r := range s {
+		switch {
+		case r == 0:
+			escaped = true
+			continue
+		case (r == '{' || r == '}') && !escaped:
+		default:
+			b.WriteRune(r)
+		}
+		escaped = false
+	}
+	return b.String()
+}
+
+/*-------------------------------------------------------------------------------------
+ * Unicode to LaTeX
+ *------------------------------------------------------------------------------------*/
+
+// unicodeSymbols maps Unicode punctuation and symbols to LaTeX.
+var unicodeSymbols = map[rune]string{
+	'–':      "--",
+	'—':      "---",
+	'‘':      "`",
+	'’':      "'",
+	'“':      "``",
+	'”':      "''",
+	'\u00a0': "~",
+	'¡':      "!`",
+	'¿':      "?`",
+	'…':      `{\ldots}`,
+	'®':      `{\textregistered}`,
+	'©':      `{\textcopyright}`,
+	'™':      `{\texttrademark}`,
+	'°':      `{\textdegree}`,
+	'·':      `{\textperiodcentered}`,
+	'§':      `{\S}`,
+	'¶':      `{\P}`,
+	'£':      `{\pounds}`,
+	'€':      `{\euro}`,
+	'±':      `$\pm$`,
+	'×':      `$\times$`,
+	'−':      `$-$`,
+	'≤':      `$\leq$`,
+	'≥':      `$\geq$`,
+	'≈':      `$\approx$`,
+	'→':      `$\rightarrow$`,
+	'∞':      `$\infty$`,
+	'\u2009': `\,`,
+	'ﬀ':      "ff",
+	'ﬁ':      "fi",
+	'ﬂ':      "fl",
+	'ﬃ':      "ffi",
+	'ﬄ':      "ffl",
+}
+
+// greekLetters maps Greek letters to the LaTeX math commands for them.
+// Uppercase letters that look like Latin letters have no command.
+var greekLetters = map[rune]string{
+	'α': "alpha", 'β': "beta", 'γ': "gamma", 'δ': "delta", 'ε': "epsilon",
+	'ζ': "zeta", 'η': "eta", 'θ': "theta", 'ι': "iota", 'κ': "kappa",
+	'λ': "lambda", 'μ': "mu", 'ν': "nu", 'ξ': "xi", 'π': "pi", 'ρ': "rho",
+	'σ': "sigma", 'τ': "tau", 'υ': "upsilon", 'φ': "phi", 'χ': "chi",
+	'ψ': "psi", 'ω': "omega", 'Γ': "Gamma", 'Δ': "Delta", 'Θ': "Theta",
+	'Λ': "Lambda", 'Ξ': "Xi", 'Π': "Pi", 'Σ': "Sigma", 'Υ': "Upsilon",
+	'Φ': "Phi", 'Ψ': "Psi", 'Ω': "Omega",
+}
+
+// accentsForMarks is the inverse of accentMarks.
+var accentsForMarks = func() map[rune]rune {
+	m := make(map[rune]rune)
+	for accent, mark := range accentMarks {
+		m[mark] = accent
+	}
+	return m
+}()
+
+// latexAccent writes base with a LaTeX accent, in the braced form that
+// canonicalBrace leaves alone: {\'e} for accents named by a symbol, and
+// {\c{c}} for accents named by a letter. A dotted i or j under an accent
+// above the letter becomes a dotless \i or \j.
+func latexAccent(accent, base rune) string {
+	b := string(base)
+	switch accent {
+	case 'c', 'k', 'd', 'b':
+	default:
+		if base == 'i' || base == 'j' {
+			b = `\` + b
+		}
+	}
+	if unicode.IsLetter(accent) {
+		return `{\` + string(accent) + "{" + b + "}}"
+	}
+	return `{\` + string(accent) + b + "}"
+}
+
+// unicodeToLaTeX converts the non-ASCII characters in s to LaTeX: accented
+// letters (precomposed, or followed by combining marks) become accent
+// commands, special letters become their commands (ß becomes {\ss}), and
+// Unicode punctuation, symbols and Greek letters become their LaTeX
+// equivalents. It returns the converted string and the characters that
+// couldn't be converted, which are left in place.
+func unicodeToLaTeX(s string) (string, []rune) {
+	var b strings.Builder
+	unmapped := make([]rune, 0)
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		// a base letter followed by a combining mark
+		if i+1 < len(runes) {
+			if accent, ok := accentsForMarks[runes[i+1]]; ok && r <= unicode.MaxASCII && unicode.IsLetter(r) {
+				b.WriteString(latexAccent(accent, r))
+				i++
+				continue
+			}
+		}
+
+		if r <= unicode.MaxASCII {
+			b.WriteRune(r)
+			continue
+		}
+		if a, ok := unicodeAccents[r]; ok {
+			b.WriteString(latexAccent(a.Accent, a.Base))
+			continue
+		}
+		if sym, ok := unicodeSymbols[r]; ok {
+			b.WriteString(sym)
+			continue
+		}
+		if name, ok := greekLetters[r]; ok {
+			b.WriteString(`$\` + name + `$`)
+			continue
+		}
+		found := false
+		for _, sl := range specialLetters {
+			if sl.R == r {
+				b.WriteString(`{\` + sl.Macro + "}")
+				found = true
+				break
+			}
+		}
+		if !found {
+			b.WriteRune(r)
+			unmapped = append(unmapped, r)
+		}
+	}
+	return b.String(), unmapped
+}
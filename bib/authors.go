@@ -0,0 +1,515 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/*=====================================================================================
+ * Author identities
+ *
+ * The same person is often written differently in different entries:
+ * "Kingsford, C.", "Kingsford, Carl" and "Kingsford, Carl L.". Names with the
+ * same von and last name are compatible if their first names agree word by
+ * word, where an initial agrees with any name it abbreviates. Compatible
+ * names are clustered, but only when every pair in the cluster is compatible,
+ * so "Carl" and "Chris" are never merged, even through "C.".
+ *====================================================================================*/
+
+// firstNameWord is one word of a first name.
+type firstNameWord struct {
+	text    string
+	sep     byte   // the separator before the word: ' ', '-' or '~'
+	letters string // the lowercase letters of the word, without accents
+	initial bool   // true if the word is an initial or abbreviation ("C.", "Ch.")
+}
+
+// firstNameWords splits a first name into its words.
+func firstNameWords(first string) []firstNameWord {
+	tokens, seps := nameTokens(first)
+	words := make([]firstNameWord, len(tokens))
+	for i, t := range tokens {
+		words[i] = firstNameWord{
+			text:    t,
+			sep:     seps[i],
+			letters: strings.ToLower(Purify(foldAccents(t))),
+			initial: strings.HasSuffix(t, ".") || textLength(t) == 1,
+		}
+	}
+	return words
+}
+
+// agrees returns true if the two words could be the same name.
+func (w firstNameWord) agrees(o firstNameWord) bool {
+	switch {
+	case w.initial && o.initial:
+		return strings.HasPrefix(w.letters, o.letters) || strings.HasPrefix(o.letters, w.letters)
+	case w.initial:
+		return strings.HasPrefix(o.letters, w.letters)
+	case o.initial:
+		return strings.HasPrefix(w.letters, o.letters)
+	}
+	return w.letters == o.letters
+}
+
+// nameVariant is one spelling of a name, and the number of times it is used.
+type nameVariant struct {
+	author *Author
+	words  []firstNameWord
+	count  int
+	order  int
+}
+
+// full returns the number of words of the first name that aren't initials.
+func (v *nameVariant) full() int {
+	n := 0
+	for _, w := range v.words {
+		if !w.initial {
+			n++
+		}
+	}
+	return n
+}
+
+// compatible returns true if the two variants could name the same person.
+// Names without a first name are never compatible with anything.
+func (v *nameVariant) compatible(o *nameVariant) bool {
+	if len(v.words) == 0 || len(o.words) == 0 {
+		return false
+	}
+	jr1, jr2 := strings.ToLower(sortString(v.author.Jr)), strings.ToLower(sortString(o.author.Jr))
+	if jr1 != "" && jr2 != "" && jr1 != jr2 {
+		return false
+	}
+	for i := 0; i < len(v.words) && i < len(o.words); i++ {
+		if !v.words[i].agrees(o.words[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesName returns true if a could be the same person as one of the names
+// in list: the von and last names are the same, and the first names agree
+// word by word, as in CheckAuthorVariants.
+func matchesName(a *Author, list []*Author) bool {
+	last := lastNameKey(a)
+	v := &nameVariant{author: a, words: firstNameWords(a.First)}
+	for _, b := range list {
+		if b.Others || lastNameKey(b) != last {
+			continue
+		}
+		if a.First == "" && b.First == "" {
+			return true
+		}
+		if v.compatible(&nameVariant{author: b, words: firstNameWords(b.First)}) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorCluster is a set of names that look like the same person.
+type authorCluster struct {
+	variants []*nameVariant
+	merged   *Author
+	// words are the words of the merged first name
+	words []firstNameWord
+}
+
+// accepts returns true if v is compatible with every name in the cluster.
+func (c *authorCluster) accepts(v *nameVariant) bool {
+	for _, o := range c.variants {
+		if !v.compatible(o) {
+			return false
+		}
+	}
+	return true
+}
+
+// merge returns the most complete form of the names in the cluster, and sets
+// c.words to the words of its first name: each word
+// of the first name is written in full if any variant has it in full, the von
+// and last name are the most common spelling, and the jr part is kept if any
+// variant has one.
+func (c *authorCluster) merge() *Author {
+	merged := &Author{}
+	lastCount := make(map[string]int)
+	nwords := 0
+	for _, v := range c.variants {
+		lastCount[v.author.Von+"\x00"+v.author.Last] += v.count
+		if merged.Jr == "" {
+			merged.Jr = v.author.Jr
+		}
+		if len(v.words) > nwords {
+			nwords = len(v.words)
+		}
+	}
+
+	best := 0
+	for _, v := range c.variants {
+		if n := lastCount[v.author.Von+"\x00"+v.author.Last]; n > best {
+			merged.Von, merged.Last, best = v.author.Von, v.author.Last, n
+		}
+	}
+
+	words := make([]firstNameWord, nwords)
+	for i := range words {
+		for _, v := range c.variants {
+			if i >= len(v.words) {
+				continue
+			}
+			// a hyphen in any variant (Jean-Pierre, J.-P.) is kept
+			w, hyphen := v.words[i], words[i].sep == '-' || v.words[i].sep == '-'
+			if words[i].text == "" || (words[i].initial && (!w.initial || len(w.letters) > len(words[i].letters))) {
+				words[i] = w
+			}
+			if hyphen {
+				words[i].sep = '-'
+			}
+		}
+	}
+	c.words = words
+	merged.First = joinFirstNameWords(words)
+	return merged
+}
+
+// joinFirstNameWords joins the words of a first name with their separators.
+func joinFirstNameWords(words []firstNameWord) string {
+	var first strings.Builder
+	for i, w := range words {
+		if i > 0 {
+			first.WriteByte(w.sep)
+		}
+		first.WriteString(w.text)
+	}
+	return first.String()
+}
+
+// authorClusters groups the names in the name lists of the entries (author,
+// editor, ...) into clusters of compatible names. Only clusters of more than
+// one spelling are returned. NormalizeAuthors must have been called.
+func (db *Database) authorClusters() []*authorCluster {
+	names := make([]*Author, 0)
+	for _, e := range db.Pubs {
+		for _, tag := range db.dialect().NameFields {
+			names = append(names, e.NameList(tag)...)
+		}
+	}
+	return clusterNames(names)
+}
+
+// lastNameKey returns the von and last name of a, ignoring case and accents.
+func lastNameKey(a *Author) string {
+	return strings.ToLower(sortString(strings.TrimSpace(a.Von + " " + a.Last)))
+}
+
+// clusterNames groups names, which may repeat, into clusters of compatible
+// names. Only clusters of more than one spelling are returned.
+func clusterNames(names []*Author) []*authorCluster {
+	variants := make(map[string]*nameVariant)
+	byLast := make(map[string][]*nameVariant)
+	lasts := make([]string, 0)
+	for _, a := range names {
+		if a.Others {
+			continue
+		}
+		name := a.String()
+		if v, ok := variants[name]; ok {
+			v.count++
+			continue
+		}
+		v := &nameVariant{author: a, words: firstNameWords(a.First), count: 1, order: len(variants)}
+		variants[name] = v
+		last := lastNameKey(a)
+		if _, ok := byLast[last]; !ok {
+			lasts = append(lasts, last)
+		}
+		byLast[last] = append(byLast[last], v)
+	}
+
+	clusters := make([]*authorCluster, 0)
+	for _, last := range lasts {
+		list := byLast[last]
+		if len(list) < 2 {
+			continue
+		}
+		// the most complete names start the clusters
+		sort.SliceStable(list, func(i, j int) bool {
+			if f1, f2 := list[i].full(), list[j].full(); f1 != f2 {
+				return f1 > f2
+			}
+			return len(list[i].words) > len(list[j].words)
+		})
+		group := make([]*authorCluster, 0)
+		for _, v := range list {
+			var home *authorCluster
+			n := 0
+			for _, c := range group {
+				if c.accepts(v) {
+					home = c
+					n++
+				}
+			}
+			switch n {
+			case 0:
+				group = append(group, &authorCluster{variants: []*nameVariant{v}})
+			case 1:
+				home.variants = append(home.variants, v)
+			}
+			// a name that could belong to more than one cluster is left alone
+		}
+		for _, c := range group {
+			if len(c.variants) > 1 {
+				sort.Slice(c.variants, func(i, j int) bool { return c.variants[i].order < c.variants[j].order })
+				c.merged = c.merge()
+				clusters = append(clusters, c)
+			}
+		}
+	}
+	return clusters
+}
+
+// CheckAuthorVariants reports names that appear to be the same person
+// written in different ways, once for each person, on the first entry that
+// uses a name other than the most complete form. NormalizeAuthors must have
+// been called.
+func (db *Database) CheckAuthorVariants() {
+	for _, c := range db.authorClusters() {
+		merged := c.merged.String()
+		names := make([]string, len(c.variants))
+		for i, v := range c.variants {
+			names[i] = `"` + v.author.String() + `"`
+		}
+	loop:
+		for _, e := range db.Pubs {
+			for _, tag := range db.dialect().NameFields {
+				for _, a := range e.NameList(tag) {
+					for _, v := range c.variants {
+						if a.String() == v.author.String() && a.String() != merged {
+							db.addError(e, tag, fmt.Sprintf("names %s look like the same person; the most complete form is \"%s\"",
+								strings.Join(names, ", "), merged))
+							break loop
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// NameReplacement records a name in an entry that was rewritten.
+type NameReplacement struct {
+	Key string
+	Old string
+	New string
+}
+
+// MergeAuthorVariants rewrites each name in a name list that appears to be the
+// same person as other names in the database to the most complete form of
+// those names (see CheckAuthorVariants), and returns the replacements made.
+// NormalizeAuthors must have been called.
+func (db *Database) MergeAuthorVariants() []NameReplacement {
+	forms := make(map[string]*Author)
+	for _, c := range db.authorClusters() {
+		for _, v := range c.variants {
+			forms[v.author.String()] = c.merged
+		}
+	}
+
+	replacements := make([]NameReplacement, 0)
+	for _, e := range db.Pubs {
+		for _, tag := range db.dialect().NameFields {
+			list, changed := e.NameList(tag), false
+			for i, a := range list {
+				merged, ok := forms[a.String()]
+				if !ok || merged.String() == a.String() {
+					continue
+				}
+				replacements = append(replacements, NameReplacement{Key: e.Key, Old: a.String(), New: merged.String()})
+				m := *merged
+				list[i] = &m
+				changed = true
+			}
+			if changed {
+				e.Fields[tag] = nameListValue(list)
+			}
+		}
+	}
+	return replacements
+}
+
+/*-------------------------------------------------------------------------------------
+ * First names
+ *-----------------------------------------------------------------------------------*/
+
+// FirstNameMode says how first names are written.
+type FirstNameMode int
+
+const (
+	// KeepFirstNames leaves first names as they are.
+	KeepFirstNames FirstNameMode = iota
+	// InitialFirstNames abbreviates first names to initials.
+	InitialFirstNames
+	// FullFirstNames expands initials to the full names used for the same
+	// person elsewhere in the database.
+	FullFirstNames
+)
+
+// ParseFirstNameMode parses "initials", "full" or "keep" into a
+// FirstNameMode.
+func ParseFirstNameMode(s string) (FirstNameMode, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "initials":
+		return InitialFirstNames, nil
+	case "full":
+		return FullFirstNames, nil
+	case "keep", "":
+		return KeepFirstNames, nil
+	}
+	return KeepFirstNames, fmt.Errorf("unknown first name style %q: must be initials, full or keep", s)
+}
+
+// initials abbreviates a first name to initials: "John Andrew" becomes "J.
+// A.", "Jean-Pierre" becomes "J.-P." and "{\\'E}mile" becomes "{\\'E}.".
+// Words that are already initials are kept.
+func initials(first string) string {
+	words := firstNameWords(first)
+	for i, w := range words {
+		switch {
+		case !w.initial:
+			words[i].text = abbreviateToken(w.text) + "."
+		case !strings.HasSuffix(w.text, "."):
+			words[i].text += "."
+		}
+		if w.sep != '-' {
+			words[i].sep = ' '
+		}
+	}
+	return joinFirstNameWords(words)
+}
+
+// expand returns the first name of v with each initial that the cluster's
+// merged name has in full replaced by the full word.
+func (c *authorCluster) expand(v *nameVariant) string {
+	words := make([]firstNameWord, len(v.words))
+	copy(words, v.words)
+	for i, w := range words {
+		if w.initial && i < len(c.words) && !c.words[i].initial {
+			words[i].text = c.words[i].text
+		}
+	}
+	return joinFirstNameWords(words)
+}
+
+// ConvertFirstNames rewrites the first names in the name lists as the mode
+// says. In FullFirstNames mode, an initial is expanded only if the name
+// belongs to a cluster of names for the same person (see
+// CheckAuthorVariants) in which that word is written in full; names that could
+// be more than one person are left alone. NormalizeAuthors must have been
+// called.
+func (db *Database) ConvertFirstNames(mode FirstNameMode) {
+	if mode == KeepFirstNames {
+		return
+	}
+	expansions := make(map[string]string)
+	if mode == FullFirstNames {
+		for _, c := range db.authorClusters() {
+			for _, v := range c.variants {
+				expansions[v.author.String()] = c.expand(v)
+			}
+		}
+	}
+
+	for _, e := range db.Pubs {
+		for _, tag := range db.dialect().NameFields {
+			list, changed := e.NameList(tag), false
+			for i, a := range list {
+				if a.Others || a.First == "" {
+					continue
+				}
+				first := a.First
+				switch mode {
+				case InitialFirstNames:
+					first = initials(a.First)
+				case FullFirstNames:
+					if full, ok := expansions[a.String()]; ok {
+						first = full
+					}
+				}
+				if first != a.First {
+					n := *a
+					n.First = first
+					list[i] = &n
+					changed = true
+				}
+			}
+			if changed {
+				e.Fields[tag] = nameListValue(list)
+			}
+		}
+	}
+}
+
+/*-------------------------------------------------------------------------------------
+ * Long author lists
+ *-----------------------------------------------------------------------------------*/
+
+// AuthorTruncation records the number of names removed from an entry's author
+// list.
+type AuthorTruncation struct {
+	Key     string
+	Removed int
+}
+
+// TruncateAuthors shortens each author list of more than max names to its
+// first keep names followed by "others". Names that match one of the names
+// in exempt ("Kingsford, C." matches "Kingsford, Carl") are kept wherever
+// they are in the list. Exempt names that are organizations, by the same
+// test as CheckOrganizationAuthors with the given organizations, are braced
+// first, so "ENCODE Project Consortium" matches "{ENCODE Project
+// Consortium}". A keep of 0 or less keeps max names. It returns the number
+// of names removed from each entry that was changed. NormalizeAuthors must
+// have been called.
+func (db *Database) TruncateAuthors(max, keep int, exempt, organizations []string) []AuthorTruncation {
+	if keep <= 0 {
+		keep = max
+	}
+	orgs := newOrganizationSet(organizations)
+	exemptNames := make([]*Author, 0, len(exempt))
+	for _, name := range exempt {
+		if name = strings.TrimSpace(name); orgs.isOrganization(name) {
+			name = "{" + name + "}"
+		}
+		if a := NormalizeName(name); a != nil {
+			exemptNames = append(exemptNames, a)
+		}
+	}
+	truncated := make([]AuthorTruncation, 0)
+	for _, e := range db.Pubs {
+		names := e.AuthorList
+		if len(names) > 0 && names[len(names)-1].Others {
+			names = names[:len(names)-1]
+		}
+		if len(names) <= max || len(names) <= keep {
+			continue
+		}
+		list := make([]*Author, 0, keep+1)
+		for i, a := range names {
+			if i < keep || matchesName(a, exemptNames) {
+				list = append(list, a)
+			}
+		}
+		removed := len(names) - len(list)
+		if removed == 0 {
+			continue
+		}
+		list = append(list, &Author{Others: true})
+		truncated = append(truncated, AuthorTruncation{Key: e.Key, Removed: removed})
+		e.AuthorList = list
+		e.Fields["author"] = nameListValue(list)
+	}
+	return truncated
+}
@@ -0,0 +1,161 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"strings"
+	"testing"
+)
+
+const authorVariantsBib = `@article{a, author={Kingsford, C. and Smith, J.}, title={A}}
+@article{b, author={Kingsford, Carl and Smith, John}, title={B}}
+@article{c, author={Carl L. Kingsford and Smith, James and Kingsford, Carl M.}, title={C}}
+@article{d, author={Rampal, J.-P. and Rampal, Jean Pierre and G{\"o}del, K. and Godel, Kurt and others}, title={D}}
+`
+
+func TestAuthorClusters(t *testing.T) {
+	db := NewParser(strings.NewReader(authorVariantsBib)).ParseBibTeX()
+	db.NormalizeAuthors()
+	clusters := make([]string, 0)
+	for _, c := range db.authorClusters() {
+		names := make([]string, 0)
+		for _, v := range c.variants {
+			names = append(names, v.author.String())
+		}
+		clusters = append(clusters, strings.Join(names, "; ")+" => "+c.merged.String())
+	}
+	exp := []string{
+		"Rampal, J.-P.; Rampal, Jean Pierre => Rampal, Jean-Pierre",
+		`G{\"o}del, K.; Godel, Kurt => G{\"o}del, Kurt`,
+	}
+	// "Kingsford, C." and "Kingsford, Carl" could be Carl L. or Carl M., and
+	// "Smith, J." could be John or James, so they aren't merged
+	if strings.Join(clusters, "\n") != strings.Join(exp, "\n") {
+		t.Errorf("clusters:\n%s\nexpected:\n%s", strings.Join(clusters, "\n"), strings.Join(exp, "\n"))
+	}
+}
+
+func TestMergeAuthorVariants(t *testing.T) {
+	db := NewParser(strings.NewReader(strings.Replace(authorVariantsBib, " and Kingsford, Carl M.", "", 1))).ParseBibTeX()
+	db.NormalizeAuthors()
+	db.CheckAuthorVariants()
+	if len(db.Errors) != 3 || db.Errors[0].BadEntry.Key != "a" || db.Errors[1].BadEntry.Key != "d" {
+		t.Errorf("expected clusters reported on a and d, got %d errors", len(db.Errors))
+	}
+
+	replaced := db.MergeAuthorVariants()
+	if len(replaced) != 6 {
+		t.Errorf("expected 6 replacements, got %d", len(replaced))
+	}
+	exp := []string{
+		"Kingsford, Carl L. and Smith, J.",
+		"Kingsford, Carl L. and Smith, John",
+		"Kingsford, Carl L. and Smith, James",
+		`Rampal, Jean-Pierre and Rampal, Jean-Pierre and G{\"o}del, Kurt and G{\"o}del, Kurt and others`,
+	}
+	for i, e := range db.Pubs {
+		if e.Fields["author"].S != exp[i] {
+			t.Errorf("%s: author = %q, expected %q", e.Key, e.Fields["author"].S, exp[i])
+		}
+	}
+}
+
+func TestFirstNamesAgree(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		agree bool
+	}{
+		{"Kingsford, C.", "Kingsford, Carl", true},
+		{"Kingsford, Ch.", "Kingsford, Carl", false},
+		{"Kingsford, C. L.", "Kingsford, Carl", true},
+		{"Kingsford, Carl L.", "Kingsford, Carl M.", false},
+		{"Kingsford, Carl", "Kingsford, Chris", false},
+		{"Kingsford, Jr., Carl", "Kingsford, III, Carl", false},
+		{"Zola, {\\'E}.", "Zola, {\\'E}mile", true},
+		{"Kingsford", "Kingsford, Carl", false},
+	}
+	for _, tc := range tests {
+		a, b := NormalizeName(tc.a), NormalizeName(tc.b)
+		v1 := &nameVariant{author: a, words: firstNameWords(a.First)}
+		v2 := &nameVariant{author: b, words: firstNameWords(b.First)}
+		if v1.compatible(v2) != tc.agree || v2.compatible(v1) != tc.agree {
+			t.Errorf("%q and %q: compatible = %v, expected %v", tc.a, tc.b, !tc.agree, tc.agree)
+		}
+	}
+}
+
+func TestConvertFirstNames(t *testing.T) {
+	db := NewParser(strings.NewReader(authorVariantsBib)).ParseBibTeX()
+	db.NormalizeAuthors()
+	db.ConvertFirstNames(FullFirstNames)
+	exp := []string{
+		"Kingsford, C. and Smith, J.",
+		"Kingsford, Carl and Smith, John",
+		"Kingsford, Carl L. and Smith, James and Kingsford, Carl M.",
+		`Rampal, Jean-Pierre and Rampal, Jean Pierre and G{\"o}del, Kurt and Godel, Kurt and others`,
+	}
+	for i, e := range db.Pubs {
+		if e.Fields["author"].S != exp[i] {
+			t.Errorf("full: %s: author = %q, expected %q", e.Key, e.Fields["author"].S, exp[i])
+		}
+	}
+
+	db.ConvertFirstNames(InitialFirstNames)
+	exp = []string{
+		"Kingsford, C. and Smith, J.",
+		"Kingsford, C. and Smith, J.",
+		"Kingsford, C. L. and Smith, J. and Kingsford, C. M.",
+		`Rampal, J.-P. and Rampal, J. P. and G{\"o}del, K. and Godel, K. and others`,
+	}
+	for i, e := range db.Pubs {
+		if e.Fields["author"].S != exp[i] {
+			t.Errorf("initials: %s: author = %q, expected %q", e.Key, e.Fields["author"].S, exp[i])
+		}
+	}
+
+	tests := []struct{ in, out string }{
+		{"{\\'E}mile", "{\\'E}."},
+		{"Carl~Lee", "C. L."},
+		{"C L", "C. L."},
+		{"Jean-{\\relax Ch}ristophe", "J.-{\\relax Ch}."},
+	}
+	for _, tc := range tests {
+		if got := initials(tc.in); got != tc.out {
+			t.Errorf("initials(%q) = %q, expected %q", tc.in, got, tc.out)
+		}
+	}
+
+	if _, err := ParseFirstNameMode("short"); err == nil {
+		t.Errorf("expected an error for an unknown first name style")
+	}
+}
+
+func TestTruncateAuthors(t *testing.T) {
+	in := `@article{big, author={A One and B Two and C Three and D Four and Carl Kingsford and F Six}, title={X}}
+@article{small, author={A One and B Two}, title={Y}}
+@article{etal, author={A One and B Two and C Three and D Four and others}, title={Z}}
+@article{exempt, author={A One and B Two and C. Kingsford and Rob Patro}, title={W}}
+@article{org, author={A One and B Two and C Three and {ENCODE Project Consortium}}, title={V}}
+`
+	db := NewParser(strings.NewReader(in)).ParseBibTeX()
+	db.NormalizeAuthors()
+	truncated := db.TruncateAuthors(3, 1, []string{"Kingsford, C.", "Rob Patro", "Three, Bob", "ENCODE Project Consortium"}, nil)
+	removed := make([]string, 0)
+	for _, tr := range truncated {
+		removed = append(removed, tr.Key+":"+strings.Repeat("x", tr.Removed))
+	}
+	if exp := "big:xxxx etal:xxx exempt:x org:xx"; strings.Join(removed, " ") != exp {
+		t.Errorf("removed %v, expected %s", removed, exp)
+	}
+	exp := []string{
+		"One, A and Kingsford, Carl and others",
+		"One, A and Two, B",
+		"One, A and others",
+		"One, A and Kingsford, C. and Patro, Rob and others",
+		"One, A and {ENCODE Project Consortium} and others",
+	}
+	for i, e := range db.Pubs {
+		if e.Fields["author"].S != exp[i] {
+			t.Errorf("%s: author = %q, expected %q", e.Key, e.Fields["author"].S, exp[i])
+		}
+	}
+}
@@ -7,8 +7,6 @@ import (
 	"sort"
 	"strconv"
 	"strings"
-	"unicode"
-	"unicode/utf8"
 
 	"github.com/Kingsford-Group/biblint/lexer"
 )
@@ -39,6 +37,28 @@ const (
 	Proceedings   EntryKind = "proceedings"
 	TechReport    EntryKind = "techreport"
 	Unpublished   EntryKind = "unpublished"
+
+	// biblatex entry types
+	BookInBook     EntryKind = "bookinbook"
+	Collection     EntryKind = "collection"
+	Dataset        EntryKind = "dataset"
+	InReference    EntryKind = "inreference"
+	MvBook         EntryKind = "mvbook"
+	MvCollection   EntryKind = "mvcollection"
+	MvProceedings  EntryKind = "mvproceedings"
+	MvReference    EntryKind = "mvreference"
+	Online         EntryKind = "online"
+	Patent         EntryKind = "patent"
+	Periodical     EntryKind = "periodical"
+	Reference      EntryKind = "reference"
+	Report         EntryKind = "report"
+	Set            EntryKind = "set"
+	Software       EntryKind = "software"
+	SuppBook       EntryKind = "suppbook"
+	SuppCollection EntryKind = "suppcollection"
+	SuppPeriodical EntryKind = "suppperiodical"
+	Thesis         EntryKind = "thesis"
+	XData          EntryKind = "xdata"
 )
 
 // identToKind maps a (lowercase) string into the EntryKind type.
@@ -60,6 +80,27 @@ var identToKind = map[string]EntryKind{
 	"proceedings":   Proceedings,
 	"techreport":    TechReport,
 	"unpublished":   Unpublished,
+
+	"bookinbook":     BookInBook,
+	"collection":     Collection,
+	"dataset":        Dataset,
+	"inreference":    InReference,
+	"mvbook":         MvBook,
+	"mvcollection":   MvCollection,
+	"mvproceedings":  MvProceedings,
+	"mvreference":    MvReference,
+	"online":         Online,
+	"patent":         Patent,
+	"periodical":     Periodical,
+	"reference":      Reference,
+	"report":         Report,
+	"set":            Set,
+	"software":       Software,
+	"suppbook":       SuppBook,
+	"suppcollection": SuppCollection,
+	"suppperiodical": SuppPeriodical,
+	"thesis":         Thesis,
+	"xdata":          XData,
 }
 
 // required lists the required fields for each EntryKind type.
@@ -128,6 +169,9 @@ var predefinedSymbols = map[string]string{
 	"dec": "December",
 }
 
+// monthSymbols lists the predefined month symbols in order.
+var monthSymbols = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+
 // toEntryKind coverts a string to an EntryKind.
 func toEntryKind(s string) EntryKind {
 	if k, ok := identToKind[strings.ToLower(s)]; ok {
@@ -484,8 +528,8 @@ func writeTagValue(w io.Writer, tag string, value *Value) {
 // writeEntry writes an entire entry to w. If the kind of the entry is
 // String or Preamble, the formatting will *not* be correct. The fields
 // will be ordered by first required, then optional, then blessed, then
-// everything else.
-func writeEntry(w io.Writer, e *Entry) {
+// everything else, as given by the dialect d.
+func writeEntry(w io.Writer, e *Entry, d *Dialect) {
 	fmt.Fprintf(w, "\n@%s{%s,\n",
 		strings.ToLower(e.EntryString),
 		e.Key)
@@ -493,7 +537,8 @@ func writeEntry(w io.Writer, e *Entry) {
 	// if this entry kind has a list of required fields,
 	// print each of the required fields in order
 	printed := make(map[string]bool)
-	if req, ok := required[e.Kind]; ok {
+	kind := d.KindOf(e)
+	if req, ok := d.Required[kind]; ok {
 		for _, r := range req {
 			for _, s := range strings.Split(r, "/") {
 				if v, ok := e.Fields[s]; ok {
@@ -505,17 +550,19 @@ func writeEntry(w io.Writer, e *Entry) {
 	}
 
 	// print the known optional fields
-	if opt, ok := optional[e.Kind]; ok {
+	if opt, ok := d.Optional[kind]; ok {
 		for _, r := range opt {
-			if v, ok := e.Fields[r]; ok {
-				writeTagValue(w, r, v)
-				printed[r] = true
+			for _, s := range strings.Split(r, "/") {
+				if v, ok := e.Fields[s]; ok && !printed[s] {
+					writeTagValue(w, s, v)
+					printed[s] = true
+				}
 			}
 		}
 	}
 
 	// print the blessed fields
-	for _, tag := range blessed {
+	for _, tag := range d.Blessed {
 		if v, ok := e.Fields[tag]; ok {
 			if _, ok := printed[tag]; !ok {
 				writeTagValue(w, tag, v)
@@ -580,7 +627,7 @@ func (db *Database) WriteDatabase(w io.Writer) {
 	}
 
 	for _, e := range db.Pubs {
-		writeEntry(w, e)
+		writeEntry(w, e, db.dialect())
 	}
 }
 
@@ -599,7 +646,7 @@ func parseVon(last []string) (string, string) {
 	// last word
 	j := len(last) - 2
 	for ; j >= 0; j-- {
-		if r, _ := utf8.DecodeRuneInString(last[j]); unicode.IsLower(r) {
+		if isNameWordLower(last[j]) {
 			break
 		}
 	}
@@ -628,8 +675,7 @@ func parseNameParts(name string) (string, string, string) {
 	space := ""
 	i := 0
 	for ; i < len(s)-1; i++ {
-		r, _ := utf8.DecodeRuneInString(s[i])
-		if r != utf8.RuneError && unicode.IsUpper(r) {
+		if isNameWordUpper(s[i]) {
 			first = first + space + s[i]
 			space = " "
 		} else {
@@ -682,6 +728,18 @@ func NormalizeName(name string) *Author {
 	return a
 }
 
+// parseNameList parses an "and"-separated list of names, skipping any that
+// are empty.
+func parseNameList(s string) []*Author {
+	list := make([]*Author, 0)
+	for _, name := range splitOnTopLevelString(s, "and", true) {
+		if auth := NormalizeName(name); auth != nil {
+			list = append(list, auth)
+		}
+	}
+	return list
+}
+
 // quoteName surrounds a {} if it contains a top-level "
 func quoteName(s string) string {
 	hastopquote := false
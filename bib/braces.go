@@ -228,6 +228,109 @@ func splitWords(s string) []string {
 	return words
 }
 
+// isMergeableGroup returns true iff bn is a {} group that protects case and
+// so can be merged with its neighbors. Groups that start with a command, like
+// {\"o} or {\LaTeX}, are special characters to BibTeX, and merging them
+// would change how BibTeX changes their case, and would put braces around
+// accents that are inside words, which turns off kerning.
+func (bn *BraceNode) isMergeableGroup() bool {
+	if bn.IsLeaf() {
+		return false
+	}
+	inner := strings.TrimSpace(bn.flatten(true, true))
+	return inner != "" && !strings.HasPrefix(inner, "\\")
+}
+
+// isBraceSeparator returns true iff bn is a leaf holding only whitespace and
+// punctuation, which can be moved inside a {} group without changing how the
+// text is printed. Brackets and quotes aren't separators, so a group never
+// ends between a pair of them.
+func (bn *BraceNode) isBraceSeparator() bool {
+	if !bn.IsLeaf() {
+		return false
+	}
+	for _, r := range bn.Leaf {
+		if !unicode.IsSpace(r) && !strings.ContainsRune(",;:.!?-/~", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeableBraceRuns returns the runs of the children of bn that can be
+// merged into a single {} group: groups that protect case separated only by
+// whitespace or punctuation. Each run is given by the indices of its first
+// and last child; runs contain at least two groups.
+func (bn *BraceNode) mergeableBraceRuns() [][2]int {
+	runs := make([][2]int, 0)
+	kids := bn.Children
+	for i := 0; i < len(kids); i++ {
+		if !kids[i].isMergeableGroup() {
+			continue
+		}
+		end := i
+		for j := i + 1; j < len(kids); j++ {
+			if kids[j].isMergeableGroup() {
+				end = j
+			} else if !kids[j].isBraceSeparator() {
+				break
+			}
+		}
+		if end > i {
+			runs = append(runs, [2]int{i, end})
+		}
+		i = end
+	}
+	return runs
+}
+
+// appendUnbraced appends nodes to group, replacing each group that protects
+// case with its contents, since it's redundant inside group. Groups that
+// start with a command (like {\"o}) are kept.
+func (group *BraceNode) appendUnbraced(nodes []*BraceNode) {
+	for _, n := range nodes {
+		if n.isMergeableGroup() {
+			group.appendUnbraced(n.Children)
+		} else {
+			group.Children = append(group.Children, n)
+		}
+	}
+}
+
+// MergeAdjacentBraces returns a tree in which the adjacent top-level {} groups
+// that are separated only by whitespace or punctuation are merged into one
+// group, so {mRNA,} {DNA} are great becomes {mRNA, DNA} are great. Groups
+// nested inside the merged ones are removed, so {({RNA})} {SNP} becomes
+// {(RNA) SNP}. Groups that start with a command (like {\"o}) are never
+// merged.
+func (bn *BraceNode) MergeAdjacentBraces() *BraceNode {
+	runs := bn.mergeableBraceRuns()
+	if len(runs) == 0 {
+		return bn
+	}
+	merged := &BraceNode{Children: make([]*BraceNode, 0)}
+	i := 0
+	for _, run := range runs {
+		merged.Children = append(merged.Children, bn.Children[i:run[0]]...)
+		group := &BraceNode{Children: make([]*BraceNode, 0)}
+		group.appendUnbraced(bn.Children[run[0] : run[1]+1])
+		merged.Children = append(merged.Children, group)
+		i = run[1] + 1
+	}
+	merged.Children = append(merged.Children, bn.Children[i:]...)
+	return merged
+}
+
+// mergeBraces merges the adjacent {} groups in s (see MergeAdjacentBraces).
+// Strings with unbalanced braces are returned unchanged.
+func mergeBraces(s string) string {
+	bn, size := ParseBraceTree(s)
+	if size != len(s) {
+		return s
+	}
+	return bn.MergeAdjacentBraces().flatten(true, true)
+}
+
 // ContainsNoBraces returns true if the tree contains no {}-delimitated substrings.
 func (bn *BraceNode) ContainsNoBraces() bool {
 	return len(bn.Children) == 1 && bn.Children[0].IsLeaf()
@@ -239,6 +342,17 @@ func (bn *BraceNode) ContainsNoBraces() bool {
 // user didn't put any thought into it: specifically, only if the entire string
 // is {] or none of the string is {}.
 func (bn *BraceNode) FlattenToMinBraces() string {
+	return bn.flattenBracingWords(func(w string) string {
+		if IsStrangeCase(w) || HasQuote(w) {
+			return "{" + w + "}"
+		}
+		return w
+	})
+}
+
+// flattenBracingWords is like Flatten, but passes each word that isn't inside
+// {} through brace, which returns the word with the braces it needs.
+func (bn *BraceNode) flattenBracingWords(brace func(string) string) string {
 	if bn.Children != nil {
 		words := make([]string, 0)
 
@@ -246,11 +360,7 @@ func (bn *BraceNode) FlattenToMinBraces() string {
 			// for leaf children, we iterate through the words
 			if c.IsLeaf() {
 				for _, w := range splitWords(c.Leaf) {
-					if IsStrangeCase(w) || HasQuote(w) {
-						words = append(words, "{"+w+"}")
-					} else {
-						words = append(words, w)
-					}
+					words = append(words, brace(w))
 				}
 				// for non-leaf children, we just flatten as normal
 			} else {
@@ -358,14 +468,14 @@ func splitOnTopLevelWithProtected(s string) ([]string, []bool) {
 }
 
 // IsStrangeCase returns true iff s has a capital letter someplace other than
-// the first position and not preceded by a - (so Whole-Genome is not in
-// strange case. We also ignore punctuation at the start, so "(Whole-Genome" is
-// also not in strange case. mRNA is.
+// the first position and not preceded by a - or an em-dash (so Whole-Genome
+// and Yeast—A are not in strange case). We also ignore punctuation at the
+// start, so "(Whole-Genome" is also not in strange case. mRNA is.
 func IsStrangeCase(s string) bool {
 	p := 0
 	prevRune := ' '
 	for _, r := range s {
-		if p > 0 && prevRune != '-' && unicode.IsUpper(r) {
+		if p > 0 && prevRune != '-' && prevRune != '—' && unicode.IsUpper(r) {
 			return true
 		}
 		prevRune = r
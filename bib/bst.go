@@ -0,0 +1,246 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+/*=====================================================================================
+ * BibTeX style (.bst) files
+ *
+ * A style's ENTRY command lists the fields it reads, and BibTeX formats each
+ * entry by calling the FUNCTION named after its entry type (or default.type
+ * if there isn't one). That's all biblint needs to know to decide which
+ * fields and entry types matter to the style.
+ *====================================================================================*/
+
+// Style holds the fields and entry-type functions of a .bst file.
+type Style struct {
+	Name string
+	// Fields lists the fields in the style's ENTRY command, lowercased
+	Fields []string
+	// Functions holds the names of the style's FUNCTIONs, lowercased
+	Functions map[string]bool
+}
+
+// bstScanner splits a .bst file into tokens: "{", "}", quoted strings, and
+// words. Comments run from % to the end of the line.
+type bstScanner struct {
+	r    *bufio.Reader
+	line int
+}
+
+// next returns the next token, or "" at the end of the file.
+func (s *bstScanner) next() (string, error) {
+	for {
+		c, _, err := s.r.ReadRune()
+		if err == io.EOF {
+			return "", nil
+		} else if err != nil {
+			return "", err
+		}
+		switch {
+		case c == '\n':
+			s.line++
+		case unicode.IsSpace(c):
+		case c == '%':
+			if _, err := s.r.ReadString('\n'); err != nil && err != io.EOF {
+				return "", err
+			}
+			s.line++
+		case c == '{' || c == '}':
+			return string(c), nil
+		case c == '"':
+			str, err := s.r.ReadString('"')
+			if err == io.EOF {
+				return "", fmt.Errorf("line %d: unterminated string", s.line)
+			}
+			s.line += strings.Count(str, "\n")
+			return `"` + str, err
+		default:
+			var b strings.Builder
+			b.WriteRune(c)
+			for {
+				c, _, err := s.r.ReadRune()
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					return "", err
+				}
+				if unicode.IsSpace(c) || c == '{' || c == '}' || c == '%' || c == '"' {
+					s.r.UnreadRune()
+					break
+				}
+				b.WriteRune(c)
+			}
+			return b.String(), nil
+		}
+	}
+}
+
+// group reads a {}-delimited group and returns the tokens inside it,
+// including those of nested groups.
+func (s *bstScanner) group(cmd string) ([]string, error) {
+	tok, err := s.next()
+	if err != nil {
+		return nil, err
+	}
+	if tok != "{" {
+		return nil, fmt.Errorf("line %d: expected { after %s, found %q", s.line+1, cmd, tok)
+	}
+	tokens := make([]string, 0)
+	for depth := 1; ; {
+		tok, err := s.next()
+		switch {
+		case err != nil:
+			return nil, err
+		case tok == "":
+			return nil, fmt.Errorf("line %d: missing } in %s", s.line+1, cmd)
+		case tok == "{":
+			depth++
+		case tok == "}":
+			depth--
+			if depth == 0 {
+				return tokens, nil
+			}
+		}
+		tokens = append(tokens, tok)
+	}
+}
+
+// bstArgs gives the number of {} arguments of each .bst command.
+var bstArgs = map[string]int{
+	"entry": 3, "function": 2, "macro": 2, "integers": 1, "strings": 1,
+	"execute": 1, "iterate": 1, "reverse": 1, "read": 0, "sort": 0,
+}
+
+// ReadStyle parses a .bst file, returning the fields and functions it
+// defines. name is used to refer to the style in messages.
+func ReadStyle(r io.Reader, name string) (*Style, error) {
+	s := &bstScanner{r: bufio.NewReader(r)}
+	style := &Style{Name: name, Fields: make([]string, 0), Functions: make(map[string]bool)}
+	for {
+		cmd, err := s.next()
+		if err != nil {
+			return nil, err
+		} else if cmd == "" {
+			break
+		}
+		cmd = strings.ToLower(cmd)
+		n, ok := bstArgs[cmd]
+		if !ok {
+			return nil, fmt.Errorf("line %d: unknown command %q", s.line+1, cmd)
+		}
+		args := make([][]string, n)
+		for i := range args {
+			if args[i], err = s.group(cmd); err != nil {
+				return nil, err
+			}
+		}
+		switch cmd {
+		case "entry":
+			for _, f := range args[0] {
+				style.Fields = append(style.Fields, strings.ToLower(f))
+			}
+		case "function":
+			if len(args[0]) == 1 {
+				style.Functions[strings.ToLower(args[0][0])] = true
+			}
+		}
+	}
+	if len(style.Fields) == 0 {
+		return nil, fmt.Errorf("no ENTRY command")
+	}
+	return style, nil
+}
+
+// uses returns true if the style reads the field. crossref is always read by
+// BibTeX, and the biblint options are kept regardless of the style.
+func (s *Style) uses(field string) bool {
+	if field == "crossref" || field == BiblintOptionsTag {
+		return true
+	}
+	for _, f := range s.Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// usedFields returns the fields in list (each possibly "a/b") that the style
+// reads.
+func (s *Style) usedFields(list []string) []string {
+	used := make([]string, 0, len(list))
+	for _, r := range list {
+		alts := make([]string, 0)
+		for _, f := range strings.Split(r, "/") {
+			if s.uses(f) {
+				alts = append(alts, f)
+			}
+		}
+		if len(alts) > 0 {
+			used = append(used, strings.Join(alts, "/"))
+		}
+	}
+	return used
+}
+
+// Dialect returns the BibTeX dialect as seen by the style, and named after
+// it: the fields the style doesn't read are dropped from the required and
+// optional fields, and the blessed fields are those the style reads.
+func (s *Style) Dialect() *Dialect {
+	d := &Dialect{
+		Name:        s.Name,
+		Required:    make(map[EntryKind][]string),
+		Optional:    make(map[EntryKind][]string),
+		Blessed:     append([]string{"crossref"}, s.Fields...),
+		KindAliases: BibTeXDialect.KindAliases,
+		NameFields:  BibTeXDialect.NameFields,
+	}
+	d.Blessed = append(d.Blessed, BiblintOptionsTag)
+	for k, list := range BibTeXDialect.Required {
+		d.Required[k] = s.usedFields(list)
+	}
+	for k, list := range BibTeXDialect.Optional {
+		d.Optional[k] = s.usedFields(list)
+	}
+	return d
+}
+
+// CheckStyleTypes reports entries whose type has no function in the style,
+// which BibTeX formats with the style's default.type function.
+func (db *Database) CheckStyleTypes(s *Style) {
+	for _, e := range db.Pubs {
+		t := strings.ToLower(e.EntryString)
+		if !s.Functions[t] {
+			db.addError(e, "", fmt.Sprintf("style %s has no function for @%s; BibTeX will format it with default.type", s.Name, t))
+		}
+	}
+}
+
+// CheckNonBlessedFields reports the fields that RemoveNonBlessedFields would
+// remove.
+func (db *Database) CheckNonBlessedFields(additional []string) {
+	blessed := knownFields(db.dialect())
+	for _, f := range additional {
+		blessed[f] = true
+	}
+	for _, e := range db.Pubs {
+		unused := make([]string, 0)
+		for tag := range e.Fields {
+			if !blessed[tag] {
+				unused = append(unused, tag)
+			}
+		}
+		sort.Strings(unused)
+		for _, tag := range unused {
+			db.addError(e, tag, fmt.Sprintf("field %q isn't used by %s", tag, db.dialect().Name))
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"strings"
+	"testing"
+)
+
+const testBst = `% a cut-down plain.bst
+ENTRY
+  { address author booktitle journal pages title volume year }
+  {}
+  { label }
+INTEGERS { output.state }
+STRINGS { s }
+MACRO {jan} {"January"}
+FUNCTION {emphasize}
+{ duplicate$ empty$
+    { pop$ "" }
+    { "{\em " swap$ * "}" * }  % braces in strings don't count
+  if$
+}
+FUNCTION {Article} { "100%" pop$ }
+FUNCTION {default.type} { fin.entry }
+READ
+ITERATE {call.type$}
+`
+
+func TestReadStyle(t *testing.T) {
+	s, err := ReadStyle(strings.NewReader(testBst), "test.bst")
+	if err != nil {
+		t.Fatalf("couldn't read style: %v", err)
+	}
+	if strings.Join(s.Fields, " ") != "address author booktitle journal pages title volume year" {
+		t.Errorf("wrong fields: %v", s.Fields)
+	}
+	for _, f := range []string{"emphasize", "article", "default.type"} {
+		if !s.Functions[f] {
+			t.Errorf("missing function %s", f)
+		}
+	}
+
+	for _, bad := range []string{
+		"ENTRY { author } {} {} FUNCTION {x} { \"unterminated }",
+		"ENTRY { author } {} {} FUNCTION {x} { { }",
+		"ENTRY { author } {} {} BOGUS {x}",
+		"FUNCTION {x} { }",
+	} {
+		if _, err := ReadStyle(strings.NewReader(bad), "bad.bst"); err == nil {
+			t.Errorf("no error for %q", bad)
+		}
+	}
+}
+
+func TestStyleDialect(t *testing.T) {
+	s, _ := ReadStyle(strings.NewReader(testBst), "test.bst")
+	db := NewParser(strings.NewReader(`@article{a, author={A}, title={T}, journal={J}, year=2020, doi={x}, crossref={b}}
+@misc{m, author={A}, title={T}, year=2020, howpublished={web}}
+`)).ParseBibTeX()
+	db.Dialect = s.Dialect()
+
+	if req := strings.Join(db.Dialect.Required[Article], " "); req != "author title journal year volume" {
+		t.Errorf("article requires %s", req)
+	}
+	db.CheckStyleTypes(s)
+	db.CheckNonBlessedFields(nil)
+	reported := make([]string, 0)
+	for _, err := range db.Errors {
+		reported = append(reported, err.BadEntry.Key+":"+err.Tag)
+	}
+	if strings.Join(reported, " ") != "m: a:doi m:howpublished" {
+		t.Errorf("reported %v", reported)
+	}
+
+	db.RemoveNonBlessedFields(nil)
+	if _, ok := db.Pubs[0].Fields["doi"]; ok {
+		t.Errorf("unused field wasn't removed")
+	}
+	if _, ok := db.Pubs[0].Fields["crossref"]; !ok {
+		t.Errorf("crossref was removed")
+	}
+}
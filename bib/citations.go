@@ -0,0 +1,283 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+/*=====================================================================================
+ * Citation cross-referencing
+ *====================================================================================*/
+
+// Citations records the keys cited by a LaTeX document. A key is "cited" if
+// it appears in any \cite-like command; it is a "nocite" if it only ever
+// appears in \nocite. If the document uses \nocite{*}, then All is true.
+type Citations struct {
+	Keys   []string
+	All    bool
+	cited  map[string]bool
+	nocite map[string]bool
+}
+
+// NewCitations creates an empty set of citations.
+func NewCitations() *Citations {
+	return &Citations{
+		Keys:   make([]string, 0),
+		cited:  make(map[string]bool),
+		nocite: make(map[string]bool),
+	}
+}
+
+// add records a citation of key. If nocite is true, the key was cited via
+// \nocite.
+func (c *Citations) add(key string, nocite bool) {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return
+	}
+	if key == "*" {
+		c.All = true
+		return
+	}
+	if !c.cited[key] && !c.nocite[key] {
+		c.Keys = append(c.Keys, key)
+	}
+	if nocite {
+		c.nocite[key] = true
+	} else {
+		c.cited[key] = true
+	}
+}
+
+// addList records each key in the comma-separated list keys.
+func (c *Citations) addList(keys string, nocite bool) {
+	for _, k := range strings.Split(keys, ",") {
+		c.add(k, nocite)
+	}
+}
+
+// IsCited returns true iff key was cited by a \cite-like command.
+func (c *Citations) IsCited(key string) bool {
+	return c.cited[key]
+}
+
+// IsNoCite returns true iff key was cited only via \nocite.
+func (c *Citations) IsNoCite(key string) bool {
+	return c.nocite[key] && !c.cited[key]
+}
+
+// stripTeXComment removes everything from the first unescaped % to the end
+// of the line.
+func stripTeXComment(line string) string {
+	escape := false
+	for i, r := range line {
+		switch r {
+		case '\\':
+			escape = !escape
+			continue
+		case '%':
+			if !escape {
+				return line[:i]
+			}
+		}
+		escape = false
+	}
+	return line
+}
+
+var (
+	texCite    = regexp.MustCompile(`\\([a-zA-Z]*cite[a-zA-Z]*)\*?\s*(?:\[[^\]]*\]\s*){0,2}\{([^}]*)\}`)
+	texInclude = regexp.MustCompile(`\\(?:input|include|subfile)\s*\{([^}]*)\}`)
+	auxCite    = regexp.MustCompile(`\\citation\{([^}]*)\}`)
+	auxInclude = regexp.MustCompile(`\\@input\{([^}]*)\}`)
+)
+
+// texNonCiteCommands are commands matched by texCite that don't cite anything.
+var texNonCiteCommands = map[string]bool{
+	"citestyle":      true,
+	"citesetup":      true,
+	"citeindexfalse": true,
+	"citeindextrue":  true,
+}
+
+// AddTeX reads the citations from a LaTeX source file. It returns the names
+// of the files included via \input, \include or \subfile so that the caller
+// can read those too. Comments are removed line by line, and then the
+// commands are matched against the whole file, so a list of keys can span
+// several lines.
+func (c *Citations) AddTeX(r io.Reader) []string {
+	var text strings.Builder
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		text.WriteString(stripTeXComment(scanner.Text()))
+		text.WriteByte('\n')
+	}
+
+	includes := make([]string, 0)
+	for _, m := range texCite.FindAllStringSubmatch(text.String(), -1) {
+		if texNonCiteCommands[m[1]] {
+			continue
+		}
+		c.addList(m[2], m[1] == "nocite")
+	}
+	for _, m := range texInclude.FindAllStringSubmatch(text.String(), -1) {
+		includes = append(includes, strings.TrimSpace(m[1]))
+	}
+	return includes
+}
+
+// AddAux reads the citations from a BibTeX .aux file. The .aux file doesn't
+// distinguish \nocite from \cite, so all keys are recorded as cited. It
+// returns the names of the .aux files included via \@input.
+func (c *Citations) AddAux(r io.Reader) []string {
+	includes := make([]string, 0)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		for _, m := range auxCite.FindAllStringSubmatch(line, -1) {
+			c.addList(m[1], false)
+		}
+		for _, m := range auxInclude.FindAllStringSubmatch(line, -1) {
+			includes = append(includes, strings.TrimSpace(m[1]))
+		}
+	}
+	return includes
+}
+
+// AddBcf reads the citations from a biber .bcf control file. Keys cited via
+// \nocite are marked with a nocite="1" attribute in the file.
+func (c *Citations) AddBcf(r io.Reader) error {
+	d := xml.NewDecoder(r)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if se, ok := tok.(xml.StartElement); ok && se.Name.Local == "citekey" {
+			nocite := false
+			for _, a := range se.Attr {
+				if a.Name.Local == "nocite" && a.Value == "1" {
+					nocite = true
+				}
+			}
+			var key string
+			if err := d.DecodeElement(&key, &se); err != nil {
+				return err
+			}
+			c.add(key, nocite)
+		}
+	}
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	ra := []rune(a)
+	rb := []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// maxKeyDistance returns the largest edit distance at which we will suggest
+// a key as a near miss for a key of the given length.
+func maxKeyDistance(key string) int {
+	if d := utf8.RuneCountInString(key) / 5; d > 1 {
+		return d
+	}
+	return 1
+}
+
+// suggestKeys returns the keys in db that are near misses for key: those
+// that are equal ignoring case, or failing that, those within a small edit
+// distance. At most 3 suggestions are returned, closest first.
+func (db *Database) suggestKeys(key string) []string {
+	type candidate struct {
+		key  string
+		dist int
+	}
+	cands := make([]candidate, 0)
+	seen := make(map[string]bool)
+	for _, e := range db.Pubs {
+		if seen[e.Key] {
+			continue
+		}
+		seen[e.Key] = true
+		if strings.EqualFold(e.Key, key) {
+			cands = append(cands, candidate{e.Key, 0})
+		} else if d := editDistance(strings.ToLower(e.Key), strings.ToLower(key)); d <= maxKeyDistance(key) {
+			cands = append(cands, candidate{e.Key, d})
+		}
+	}
+	sort.SliceStable(cands, func(i, j int) bool {
+		if cands[i].dist != cands[j].dist {
+			return cands[i].dist < cands[j].dist
+		}
+		return cands[i].key < cands[j].key
+	})
+	out := make([]string, 0)
+	for i := 0; i < len(cands) && i < 3; i++ {
+		out = append(out, cands[i].key)
+	}
+	return out
+}
+
+// CheckCitations reports entries that are never cited, entries that are cited
+// only via \nocite, and cited keys that have no entry in the database (along
+// with near-miss suggestions for them). BibTeX keys are matched exactly.
+func (db *Database) CheckCitations(c *Citations) {
+	keys := make(map[string]bool)
+	for _, e := range db.Pubs {
+		keys[e.Key] = true
+		switch {
+		case c.IsCited(e.Key):
+		case c.IsNoCite(e.Key):
+			db.addError(e, "", "entry is only cited via \\nocite")
+		case !c.All:
+			db.addError(e, "", "entry is never cited")
+		}
+	}
+
+	for _, k := range c.Keys {
+		if keys[k] {
+			continue
+		}
+		msg := fmt.Sprintf("citation %q has no entry", k)
+		if sugg := db.suggestKeys(k); len(sugg) > 0 {
+			for i, s := range sugg {
+				sugg[i] = strconv.Quote(s)
+			}
+			msg += fmt.Sprintf(" (did you mean %s?)", strings.Join(sugg, " or "))
+		}
+		db.addError(nil, "", msg)
+	}
+}
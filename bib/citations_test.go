@@ -0,0 +1,70 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAddTeX(t *testing.T) {
+	const in = `\cite{a,b} \citep[see][p.~2]{c} % \cite{commented}
+\nocite{d}\nocite{a} 50\% of \textcite{e}
+\input{chapter1}`
+	c := NewCitations()
+	inc := c.AddTeX(strings.NewReader(in))
+	if len(inc) != 1 || inc[0] != "chapter1" {
+		t.Errorf("includes = %v, expected [chapter1]", inc)
+	}
+	if strings.Join(c.Keys, ",") != "a,b,c,d,e" {
+		t.Errorf("keys = %v", c.Keys)
+	}
+	if !c.IsNoCite("d") || c.IsNoCite("a") || c.IsCited("d") {
+		t.Errorf("wrong nocite status")
+	}
+
+	// key lists and options that continue on the next line
+	const multi = `as shown by \cite{a,
+  b, % the second one
+  c} and \citep[see
+][]{d,
+e}.`
+	c = NewCitations()
+	c.AddTeX(strings.NewReader(multi))
+	if strings.Join(c.Keys, ",") != "a,b,c,d,e" {
+		t.Errorf("multi-line keys = %v", c.Keys)
+	}
+}
+
+func TestAddBcf(t *testing.T) {
+	const in = `<?xml version="1.0" encoding="UTF-8"?>
+<bcf:controlfile xmlns:bcf="https://sourceforge.net/projects/biblatex">
+  <bcf:section number="0">
+    <bcf:citekey order="1" intorder="1">a</bcf:citekey>
+    <bcf:citekey order="2" intorder="1" nocite="1">b</bcf:citekey>
+  </bcf:section>
+</bcf:controlfile>`
+	c := NewCitations()
+	if err := c.AddBcf(strings.NewReader(in)); err != nil {
+		t.Fatal(err)
+	}
+	if !c.IsCited("a") || !c.IsNoCite("b") {
+		t.Errorf("wrong citations: %v", c.Keys)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		d    int
+	}{
+		{"", "", 0},
+		{"smith2020", "smyth2020", 1},
+		{"kitten", "sitting", 3},
+		{"abc", "", 3},
+	}
+	for _, tt := range tests {
+		if d := editDistance(tt.a, tt.b); d != tt.d {
+			t.Errorf("editDistance(%q, %q) = %d, expected %d", tt.a, tt.b, d, tt.d)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*=====================================================================================
+ * Crossref and xdata inheritance
+ *
+ * An entry with a crossref field inherits the fields it lacks from the entry
+ * it names. BibTeX copies them as they are, and follows only one level of
+ * crossref. biblatex follows crossrefs to any depth, maps some fields to new
+ * names (the title of a @book becomes the booktitle of an @inbook, the title
+ * of an @mvbook the maintitle, and so on), and also inherits every field of
+ * the @xdata entries named in an xdata field.
+ *====================================================================================*/
+
+// noInherit lists the fields that biblatex never inherits.
+var noInherit = map[string]bool{
+	"ids": true, "crossref": true, "xref": true, "xdata": true, "entryset": true,
+	"entrysubtype": true, "execute": true, "label": true, "options": true, "presort": true,
+	"related": true, "relatedoptions": true, "relatedstring": true, "relatedtype": true,
+	"shorthand": true, "shorthandintro": true, "sortkey": true, BiblintOptionsTag: true,
+}
+
+// inheritRule maps fields of a parent of one of the from types to fields of a
+// child of one of the to types. A field mapped to "" isn't inherited.
+type inheritRule struct {
+	from, to []EntryKind
+	fields   [][2]string
+}
+
+// fields of a parent title that map to the title fields of the child with the
+// given prefix (e.g. "main" or "book")
+func titleFields(prefix string) [][2]string {
+	return [][2]string{
+		{"title", prefix + "title"},
+		{"subtitle", prefix + "subtitle"},
+		{"titleaddon", prefix + "titleaddon"},
+		{"shorttitle", ""},
+		{"sorttitle", ""},
+		{"indextitle", ""},
+		{"indexsorttitle", ""},
+	}
+}
+
+// inheritRules are biblatex's default inheritance rules (biblatex manual,
+// appendix B).
+var inheritRules = []inheritRule{
+	{[]EntryKind{MvBook, Book}, []EntryKind{InBook, BookInBook, SuppBook},
+		[][2]string{{"author", "author"}, {"author", "bookauthor"}}},
+	{[]EntryKind{MvBook}, []EntryKind{Book, InBook, BookInBook, SuppBook}, titleFields("main")},
+	{[]EntryKind{MvCollection, MvReference}, []EntryKind{Collection, Reference, InCollection, InReference, SuppCollection}, titleFields("main")},
+	{[]EntryKind{MvProceedings}, []EntryKind{Proceedings, InProceedings}, titleFields("main")},
+	{[]EntryKind{Book}, []EntryKind{InBook, BookInBook, SuppBook}, titleFields("book")},
+	{[]EntryKind{Collection, Reference}, []EntryKind{InCollection, InReference, SuppCollection}, titleFields("book")},
+	{[]EntryKind{Proceedings}, []EntryKind{InProceedings}, titleFields("book")},
+	{[]EntryKind{Periodical}, []EntryKind{Article, SuppPeriodical}, titleFields("journal")},
+}
+
+// hasKind returns true if k is in kinds.
+func hasKind(kinds []EntryKind, k EntryKind) bool {
+	for _, kind := range kinds {
+		if kind == k {
+			return true
+		}
+	}
+	return false
+}
+
+// inheritedFields returns the biblatex mappings of the fields of a parent of
+// kind from to a child of kind to, as a map from parent field to child fields.
+func inheritedFields(from, to EntryKind) map[string][]string {
+	fields := make(map[string][]string)
+	for _, rule := range inheritRules {
+		if hasKind(rule.from, from) && hasKind(rule.to, to) {
+			for _, f := range rule.fields {
+				fields[f[0]] = append(fields[f[0]], f[1])
+			}
+		}
+	}
+	return fields
+}
+
+// Resolver computes the fields of entries including those they inherit
+// through crossref and xdata fields, following the rules of the database's
+// dialect.
+type Resolver struct {
+	db       *Database
+	biblatex bool
+	byKey    map[string]*Entry
+	resolved map[*Entry]*Entry
+}
+
+// NewResolver returns a Resolver for the entries currently in the database.
+func (db *Database) NewResolver() *Resolver {
+	r := &Resolver{
+		db:       db,
+		biblatex: db.dialect() == BibLaTeXDialect,
+		byKey:    make(map[string]*Entry),
+		resolved: make(map[*Entry]*Entry),
+	}
+	for _, e := range db.Pubs {
+		if _, ok := r.byKey[strings.ToLower(e.Key)]; !ok {
+			r.byKey[strings.ToLower(e.Key)] = e
+		}
+	}
+	return r
+}
+
+// Lookup returns the entry with the given key, ignoring case, or nil.
+func (r *Resolver) Lookup(key string) *Entry {
+	return r.byKey[strings.ToLower(strings.TrimSpace(key))]
+}
+
+// refKeys returns the keys named in the tag field of e: the crossref, or the
+// comma-separated list of xdata entries.
+func (r *Resolver) refKeys(e *Entry, tag string) []string {
+	v, ok := e.Fields[tag]
+	if !ok {
+		return nil
+	}
+	keys := make([]string, 0)
+	for _, k := range strings.Split(displayValue(r.db.SymbolValue(v, 10)), ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// Resolve returns e with the fields it inherits filled in. If e inherits
+// nothing, e itself is returned; otherwise, the result is a copy and e is
+// unchanged.
+func (r *Resolver) Resolve(e *Entry) *Entry {
+	if res, ok := r.resolved[e]; ok {
+		return res
+	}
+	// guard against cycles
+	r.resolved[e] = e
+
+	res := e
+	inherit := func(tag string, v *Value) {
+		if _, ok := res.Fields[tag]; ok {
+			return
+		}
+		if res == e {
+			res = &Entry{
+				Kind:        e.Kind,
+				EntryString: e.EntryString,
+				Key:         e.Key,
+				Fields:      make(map[string]*Value, len(e.Fields)),
+				AuthorList:  e.AuthorList,
+				NameLists:   copyNameLists(e.NameLists),
+				LineNo:      e.LineNo,
+			}
+			for t, v := range e.Fields {
+				res.Fields[t] = v
+			}
+		}
+		res.Fields[tag] = v
+	}
+
+	if r.biblatex {
+		for _, k := range r.refKeys(e, "xdata") {
+			if parent := r.Lookup(k); parent != nil {
+				for tag, v := range r.Resolve(parent).Fields {
+					if !noInherit[tag] {
+						inherit(tag, v)
+					}
+				}
+			}
+		}
+	}
+	if keys := r.refKeys(e, "crossref"); len(keys) == 1 {
+		if parent := r.Lookup(keys[0]); parent != nil {
+			if r.biblatex {
+				parent = r.Resolve(parent)
+				d := r.db.dialect()
+				mapped := inheritedFields(d.KindOf(parent), d.KindOf(e))
+				for tag, v := range parent.Fields {
+					if to, ok := mapped[tag]; ok {
+						for _, t := range to {
+							if t != "" {
+								inherit(t, v)
+							}
+						}
+					} else if !noInherit[tag] {
+						inherit(tag, v)
+					}
+				}
+			} else {
+				for tag, v := range parent.Fields {
+					if tag != "crossref" {
+						inherit(tag, v)
+					}
+				}
+			}
+			for _, tag := range r.db.dialect().NameFields {
+				if e.NameList(tag) == nil && e.Fields[tag] == nil && res.Fields[tag] != nil && parent.NameList(tag) != nil {
+					res.setNameList(tag, parent.NameList(tag))
+				}
+			}
+		}
+	}
+	r.resolved[e] = res
+	return res
+}
+
+// Resolved returns a copy of the database whose entries have the fields they
+// inherit filled in. @xdata entries, which only hold fields for other
+// entries, are left out. The symbols and preamble are shared with db.
+func (db *Database) Resolved() *Database {
+	r := db.NewResolver()
+	out := &Database{
+		Pubs:     make([]*Entry, 0, len(db.Pubs)),
+		Symbols:  db.Symbols,
+		Preamble: db.Preamble,
+		Dialect:  db.Dialect,
+	}
+	for _, e := range db.Pubs {
+		if e.Kind != XData {
+			out.Pubs = append(out.Pubs, r.Resolve(e))
+		}
+	}
+	return out
+}
+
+// InlineCrossrefs copies the fields each entry inherits into the entry and
+// removes its crossref and xdata fields, so that the entries don't depend on
+// each other. @xdata entries are removed. The parents of crossrefs are kept,
+// since they may be cited themselves.
+func (db *Database) InlineCrossrefs() {
+	r := db.NewResolver()
+	resolved := make([]*Entry, len(db.Pubs))
+	for i, e := range db.Pubs {
+		resolved[i] = r.Resolve(e)
+	}
+	ndel := 0
+	for i, e := range db.Pubs {
+		if e.Kind == XData {
+			e.Kind = Deleted
+			ndel++
+			continue
+		}
+		e.Fields = resolved[i].Fields
+		e.AuthorList = resolved[i].AuthorList
+		e.NameLists = resolved[i].NameLists
+		delete(e.Fields, "crossref")
+		delete(e.Fields, "xdata")
+	}
+	db.removeDeleted(ndel)
+}
+
+// OrderCrossrefs moves each entry that is cross-referenced to just after the
+// last entry that cross-references it, since BibTeX only inherits fields from
+// entries that come later in the file. The other entries keep their order.
+func (db *Database) OrderCrossrefs() {
+	// each pass moves parents after their children; nested crossrefs may
+	// need more than one pass, and cycles can't be ordered at all
+	for pass := 0; pass < len(db.Pubs); pass++ {
+		r := db.NewResolver()
+		pos := make(map[*Entry]int, len(db.Pubs))
+		for i, e := range db.Pubs {
+			pos[e] = i
+		}
+		lastChild := make(map[*Entry]int)
+		for i, e := range db.Pubs {
+			for _, k := range r.refKeys(e, "crossref") {
+				if p := r.Lookup(k); p != nil && p != e {
+					if last, ok := lastChild[p]; !ok || i > last {
+						lastChild[p] = i
+					}
+				}
+			}
+		}
+
+		moved := false
+		order := make([]*Entry, 0, len(db.Pubs))
+		after := make(map[int][]*Entry)
+		for i, e := range db.Pubs {
+			if last, ok := lastChild[e]; ok && last > pos[e] {
+				after[last] = append(after[last], e)
+				moved = true
+			} else {
+				order = append(order, e)
+			}
+			order = append(order, after[i]...)
+		}
+		db.Pubs = order
+		if !moved {
+			return
+		}
+	}
+}
+
+// CheckCrossrefs reports crossref and xdata fields that name entries that
+// aren't in the database and, for BibTeX, crossref'd entries that come before
+// an entry that cross-references them.
+func (db *Database) CheckCrossrefs() {
+	r := db.NewResolver()
+	pos := make(map[*Entry]int, len(db.Pubs))
+	for i, e := range db.Pubs {
+		pos[e] = i
+	}
+	for i, e := range db.Pubs {
+		for _, k := range r.refKeys(e, "crossref") {
+			p := r.Lookup(k)
+			switch {
+			case p == nil:
+				db.addError(e, "crossref", fmt.Sprintf("crossref %q isn't in the database", k))
+			case !r.biblatex && pos[p] < i:
+				db.addError(e, "crossref",
+					fmt.Sprintf("crossref %q comes before this entry, but BibTeX only inherits from entries that come after it", k))
+			}
+		}
+		if !r.biblatex {
+			continue
+		}
+		for _, k := range r.refKeys(e, "xdata") {
+			if r.Lookup(k) == nil {
+				db.addError(e, "xdata", fmt.Sprintf("xdata %q isn't in the database", k))
+			}
+		}
+	}
+}
+
+// copyNameLists returns a copy of an entry's NameLists, so that a resolved
+// entry can add inherited lists without changing the original.
+func copyNameLists(lists map[string][]*Author) map[string][]*Author {
+	if lists == nil {
+		return nil
+	}
+	c := make(map[string][]*Author, len(lists))
+	for tag, list := range lists {
+		c[tag] = list
+	}
+	return c
+}
@@ -0,0 +1,103 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"strings"
+	"testing"
+)
+
+const crossrefTestBib = `@inbook{ch, author={Doe, Jane}, title={Chapter}, crossref={bk}, pages={1--10}}
+@book{bk, author={Roe, Rick}, title={The Book}, subtitle={Sub}, crossref={mv}, publisher={P}, shorttitle={TB}}
+@mvbook{mv, title={Collected Works}, date={2020}, xdata={pub}, ids={mvalias}}
+@xdata{pub, location={Pittsburgh}}
+`
+
+func TestResolveBibLaTeX(t *testing.T) {
+	db := NewParser(strings.NewReader(crossrefTestBib)).ParseBibTeX()
+	db.Dialect = BibLaTeXDialect
+	r := db.NewResolver()
+	ch := r.Resolve(db.Pubs[0])
+	exp := map[string]string{
+		"title":        "Chapter",
+		"author":       "Doe, Jane",
+		"bookauthor":   "Roe, Rick",
+		"booktitle":    "The Book",
+		"booksubtitle": "Sub",
+		"maintitle":    "Collected Works",
+		"publisher":    "P",
+		"date":         "2020",
+		"location":     "Pittsburgh",
+	}
+	for tag, v := range exp {
+		if got := db.fieldText(ch, tag); got != v {
+			t.Errorf("%s = %q, expected %q", tag, got, v)
+		}
+	}
+	for _, tag := range []string{"shorttitle", "subtitle", "ids", "xdata"} {
+		if _, ok := ch.Fields[tag]; ok {
+			t.Errorf("%s shouldn't be inherited", tag)
+		}
+	}
+	if _, ok := db.Pubs[0].Fields["booktitle"]; ok {
+		t.Errorf("resolving changed the entry")
+	}
+
+	db.InlineCrossrefs()
+	if len(db.Pubs) != 3 {
+		t.Errorf("expected the @xdata entry to be removed, have %d entries", len(db.Pubs))
+	}
+	if _, ok := db.Pubs[0].Fields["crossref"]; ok || db.fieldText(db.Pubs[0], "booktitle") != "The Book" {
+		t.Errorf("crossref wasn't inlined")
+	}
+}
+
+func TestResolveBibTeX(t *testing.T) {
+	db := NewParser(strings.NewReader(`@inproceedings{a, author={A}, title={T}, crossref={proc}}
+@proceedings{proc, title={Proc}, booktitle={Proc}, year=2020}
+@inproceedings{b, author={B}, title={T}, crossref={nope}}
+`)).ParseBibTeX()
+	r := db.NewResolver()
+	a := r.Resolve(db.Pubs[0])
+	if db.fieldText(a, "booktitle") != "Proc" || db.fieldText(a, "title") != "T" || db.fieldText(a, "year") != "2020" {
+		t.Errorf("fields weren't inherited: %v", a.Fields)
+	}
+	db.CheckRequiredFields()
+	for _, err := range db.Errors {
+		if err.BadEntry.Key == "a" {
+			t.Errorf("inherited field reported missing: %s", err.Msg)
+		}
+	}
+}
+
+func TestCheckAndOrderCrossrefs(t *testing.T) {
+	db := NewParser(strings.NewReader(`@proceedings{proc, title={Proc}, year=2020}
+@inproceedings{a, title={A}, crossref={proc}}
+@misc{m, title={M}}
+@inproceedings{b, title={B}, crossref={proc}}
+@inproceedings{c, title={C}, crossref={nope}}
+`)).ParseBibTeX()
+	db.CheckCrossrefs()
+	reported := make([]string, 0)
+	for _, err := range db.Errors {
+		reported = append(reported, err.BadEntry.Key)
+	}
+	if strings.Join(reported, " ") != "a b c" {
+		t.Errorf("reported %v, expected a b c", reported)
+	}
+
+	db.OrderCrossrefs()
+	keys := make([]string, 0)
+	for _, e := range db.Pubs {
+		keys = append(keys, e.Key)
+	}
+	if strings.Join(keys, " ") != "a m b proc c" {
+		t.Errorf("ordered as %v, expected a m b proc c", keys)
+	}
+
+	db.Errors = nil
+	db.Dialect = BibLaTeXDialect
+	db.CheckCrossrefs()
+	if len(db.Errors) != 1 || db.Errors[0].BadEntry.Key != "c" {
+		t.Errorf("biblatex should only report the dangling crossref")
+	}
+}
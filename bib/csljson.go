@@ -0,0 +1,576 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*=====================================================================================
+ * CSL-JSON import and export
+ *
+ * CSL-JSON is the bibliographic data format used by citeproc, Pandoc and
+ * Zotero. See https://citeproc-js.readthedocs.io/en/latest/csl-json/markup.html
+ *====================================================================================*/
+
+// kindToCSL maps entry kinds to CSL item types.
+var kindToCSL = map[EntryKind]string{
+	Article:       "article-journal",
+	Book:          "book",
+	Booklet:       "pamphlet",
+	InBook:        "chapter",
+	InCollection:  "chapter",
+	InProceedings: "paper-conference",
+	Manual:        "report",
+	MastersThesis: "thesis",
+	Misc:          "document",
+	PhdThesis:     "thesis",
+	Proceedings:   "book",
+	TechReport:    "report",
+	Unpublished:   "manuscript",
+}
+
+// cslToKind maps CSL item types to entry kinds. Types that aren't listed
+// become Misc.
+var cslToKind = map[string]EntryKind{
+	"article":           Article,
+	"article-journal":   Article,
+	"article-magazine":  Article,
+	"article-newspaper": Article,
+	"book":              Book,
+	"pamphlet":          Booklet,
+	"chapter":           InCollection,
+	"paper-conference":  InProceedings,
+	"report":            TechReport,
+	"thesis":            PhdThesis,
+	"manuscript":        Unpublished,
+	"document":          Misc,
+}
+
+// cslFields maps BibTeX fields to the CSL variables that hold the same
+// information. Fields that are handled specially (names, dates, pages,
+// containers and publishers) are not listed.
+var cslFields = map[string]string{
+	"title":    "title",
+	"volume":   "volume",
+	"number":   "issue",
+	"edition":  "edition",
+	"series":   "collection-title",
+	"chapter":  "chapter-number",
+	"address":  "publisher-place",
+	"location": "publisher-place",
+	"doi":      "DOI",
+	"url":      "URL",
+	"isbn":     "ISBN",
+	"issn":     "ISSN",
+	"pmid":     "PMID",
+	"pmc":      "PMCID",
+	"note":     "note",
+	"abstract": "abstract",
+	"keywords": "keyword",
+	"type":     "genre",
+}
+
+// cslVerbatim lists the fields whose values are not LaTeX and so are copied
+// without conversion.
+var cslVerbatim = map[string]bool{
+	"doi":    true,
+	"url":    true,
+	"eprint": true,
+	"file":   true,
+	"pmid":   true,
+	"pmc":    true,
+}
+
+// cslPublisherFields lists the fields that become the CSL publisher, in
+// order of preference.
+var cslPublisherFields = []string{"publisher", "school", "institution", "organization"}
+
+// publisherField returns the field that holds the publisher of an entry
+// of the given kind.
+func publisherField(kind EntryKind) string {
+	switch kind {
+	case PhdThesis, MastersThesis:
+		return "school"
+	case TechReport:
+		return "institution"
+	case Manual:
+		return "organization"
+	}
+	return "publisher"
+}
+
+// cslName is a CSL name object.
+type cslName struct {
+	Family              string `json:"family,omitempty"`
+	Given               string `json:"given,omitempty"`
+	DroppingParticle    string `json:"dropping-particle,omitempty"`
+	NonDroppingParticle string `json:"non-dropping-particle,omitempty"`
+	Suffix              string `json:"suffix,omitempty"`
+	Literal             string `json:"literal,omitempty"`
+}
+
+// cslDate is a CSL date object.
+type cslDate struct {
+	DateParts [][]interface{} `json:"date-parts,omitempty"`
+	Raw       string          `json:"raw,omitempty"`
+	Literal   string          `json:"literal,omitempty"`
+}
+
+// isoDate matches an ISO 8601 date (or a year or year and month).
+var isoDate = regexp.MustCompile(`^\s*(\d{4})(?:-(\d{1,2})(?:-(\d{1,2}))?)?\s*$`)
+
+// monthNumber returns the number of the month named by v (a predefined
+// symbol, a number, or a month name or abbreviation), or 0.
+func (db *Database) monthNumber(v *Value) int {
+	if v.T == SymbolType {
+		if _, ok := predefinedSymbols[strings.ToLower(v.S)]; !ok {
+			v = db.SymbolValue(v, 10)
+		}
+	}
+	if v.T == NumberType {
+		if 1 <= v.I && v.I <= 12 {
+			return v.I
+		}
+		return 0
+	}
+	s := strings.ToLower(normalizedMonth(strings.TrimSuffix(strings.TrimSpace(flattenForFilter(v.S)), ".")))
+	for i, m := range monthSymbols {
+		if strings.ToLower(predefinedSymbols[m]) == s {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// cslDateParts converts an ISO 8601 date into CSL date parts.
+func cslDateParts(s string) []interface{} {
+	m := isoDate.FindStringSubmatch(s)
+	if m == nil {
+		return nil
+	}
+	parts := make([]interface{}, 0, 3)
+	for _, p := range m[1:] {
+		if p == "" {
+			break
+		}
+		i, _ := strconv.Atoi(p)
+		parts = append(parts, i)
+	}
+	return parts
+}
+
+// cslIssued returns the CSL issued date of e, from its date field (which
+// may be a range start/end) or its year and month fields.
+func (db *Database) cslIssued(e *Entry) *cslDate {
+	if v, ok := e.Fields["date"]; ok {
+		raw := strings.TrimSpace(displayValue(db.SymbolValue(v, 10)))
+		d := &cslDate{}
+		for _, part := range strings.Split(raw, "/") {
+			if dp := cslDateParts(part); dp != nil {
+				d.DateParts = append(d.DateParts, dp)
+			} else {
+				return &cslDate{Raw: raw}
+			}
+		}
+		return d
+	}
+
+	v, ok := e.Fields["year"]
+	if !ok {
+		return nil
+	}
+	v = db.SymbolValue(v, 10)
+	var year int
+	if v.T == NumberType {
+		year = v.I
+	} else if y, err := strconv.Atoi(strings.TrimSpace(flattenForFilter(v.S))); err == nil {
+		year = y
+	} else {
+		return &cslDate{Literal: latexToText(v.S)}
+	}
+
+	parts := []interface{}{year}
+	if m, ok := e.Fields["month"]; ok {
+		if n := db.monthNumber(m); n > 0 {
+			parts = append(parts, n)
+		}
+	}
+	return &cslDate{DateParts: [][]interface{}{parts}}
+}
+
+// isCorporateName returns true iff the name is a single {}-protected unit,
+// which is how BibTeX protects institutional authors.
+func isCorporateName(a *Author) bool {
+	bn, size := ParseBraceTree(a.Last)
+	return a.First == "" && a.Von == "" && a.Jr == "" && size == len(a.Last) && bn.IsEntireStringBraced()
+}
+
+// cslNames converts a BibTeX name list into CSL names.
+func cslNames(s string) []cslName {
+	names := make([]cslName, 0)
+	for _, a := range parseNameList(s) {
+		switch {
+		case a.Others:
+			names = append(names, cslName{Literal: "others"})
+		case isCorporateName(a):
+			names = append(names, cslName{Literal: latexToText(a.Last)})
+		default:
+			names = append(names, cslName{
+				Family:              latexToText(a.Last),
+				Given:               latexToText(a.First),
+				NonDroppingParticle: latexToText(a.Von),
+				Suffix:              latexToText(a.Jr),
+			})
+		}
+	}
+	return names
+}
+
+// cslItem converts an entry to a CSL item. Fields that have no CSL variable
+// are kept in the "custom" object so that they survive a round trip.
+func (db *Database) cslItem(e *Entry) map[string]interface{} {
+	item := make(map[string]interface{})
+	custom := make(map[string]string)
+	item["id"] = e.Key
+
+	cslType, ok := kindToCSL[e.Kind]
+	if !ok {
+		cslType = "document"
+	}
+	item["type"] = cslType
+	// the genre tells master's theses apart from PhD theses
+	if cslToKind[cslType] != e.Kind && e.Kind != MastersThesis {
+		custom["bibtex-type"] = strings.ToLower(e.EntryString)
+	}
+	switch e.Kind {
+	case PhdThesis:
+		item["genre"] = "PhD thesis"
+	case MastersThesis:
+		item["genre"] = "Master's thesis"
+	}
+
+	text := func(tag string) string {
+		s := displayValue(db.SymbolValue(e.Fields[tag], 10))
+		if cslVerbatim[tag] {
+			return s
+		}
+		return latexToText(s)
+	}
+
+	publisher := ""
+	if _, ok := e.Fields[publisherField(e.Kind)]; ok {
+		publisher = publisherField(e.Kind)
+	}
+	for _, tag := range cslPublisherFields {
+		if _, ok := e.Fields[tag]; ok && publisher == "" {
+			publisher = tag
+			custom["publisher-field"] = tag
+		}
+	}
+
+	for _, tag := range e.Tags() {
+		switch {
+		case tag == "author" || tag == "editor":
+			item[tag] = cslNames(displayValue(db.SymbolValue(e.Fields[tag], 10)))
+		case tag == "year" || tag == "month" || tag == "date":
+			// handled by cslIssued
+		case tag == "pages":
+			item["page"] = strings.ReplaceAll(text(tag), "–", "-")
+		case tag == "journal" || tag == "journaltitle" || tag == "booktitle":
+			if _, ok := item["container-title"]; ok {
+				custom[tag] = text(tag)
+			} else {
+				item["container-title"] = text(tag)
+			}
+		case tag == publisher:
+			item["publisher"] = text(tag)
+		case cslFields[tag] != "" && item[cslFields[tag]] == nil:
+			item[cslFields[tag]] = text(tag)
+		default:
+			custom[tag] = displayValue(db.SymbolValue(e.Fields[tag], 10))
+		}
+	}
+	if d := db.cslIssued(e); d != nil {
+		item["issued"] = d
+	}
+	if len(custom) > 0 {
+		item["custom"] = custom
+	}
+	return item
+}
+
+// WriteCSLJSON writes the database to w as a CSL-JSON array. Symbols are
+// expanded, inherited fields are filled in, and LaTeX is converted to Unicode
+// text. The preamble and @xdata entries are not written.
+func (db *Database) WriteCSLJSON(w io.Writer) error {
+	db = db.Resolved()
+	items := make([]map[string]interface{}, 0, len(db.Pubs))
+	for _, e := range db.Pubs {
+		items = append(items, db.cslItem(e))
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(items)
+}
+
+/*-------------------------------------------------------------------------------------
+ * Reading CSL-JSON
+ *------------------------------------------------------------------------------------*/
+
+// escapeLaTeX escapes the characters in plain text that are special to
+// BibTeX and LaTeX.
+func escapeLaTeX(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '&', '%', '$', '#', '_', '{', '}':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// cslString converts a CSL value (a string or a number) to a string.
+func cslString(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case json.Number:
+		return x.String()
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// cslValue converts a CSL value into a field value, escaping LaTeX special
+// characters unless the field is verbatim.
+func cslValue(tag string, v interface{}) *Value {
+	s := strings.TrimSpace(cslString(v))
+	if i, err := strconv.Atoi(s); err == nil && tag != "pages" {
+		return &Value{T: NumberType, I: i}
+	}
+	if !cslVerbatim[tag] {
+		s = escapeLaTeX(s)
+	}
+	return &Value{T: StringType, S: s}
+}
+
+// cslNamesToAuthors converts CSL names into authors.
+func cslNamesToAuthors(names []cslName) []*Author {
+	authors := make([]*Author, 0, len(names))
+	for _, n := range names {
+		switch {
+		case n.Literal == "others":
+			authors = append(authors, &Author{Others: true})
+		case n.Literal != "":
+			authors = append(authors, &Author{Last: "{" + escapeLaTeX(n.Literal) + "}"})
+		default:
+			von := strings.TrimSpace(n.DroppingParticle + " " + n.NonDroppingParticle)
+			authors = append(authors, &Author{
+				First: escapeLaTeX(n.Given),
+				Von:   escapeLaTeX(von),
+				Last:  escapeLaTeX(n.Family),
+				Jr:    escapeLaTeX(n.Suffix),
+			})
+		}
+	}
+	return authors
+}
+
+// cslDateFields sets the year and month (or date, for ranges and full dates)
+// fields of e from a CSL date.
+func cslDateFields(e *Entry, d *cslDate) {
+	switch {
+	case len(d.DateParts) == 1 && len(d.DateParts[0]) <= 2:
+		parts := d.DateParts[0]
+		if len(parts) >= 1 {
+			e.Fields["year"] = cslValue("year", parts[0])
+		}
+		if len(parts) == 2 {
+			if m, err := strconv.Atoi(cslString(parts[1])); err == nil && 1 <= m && m <= 12 {
+				e.Fields["month"] = &Value{T: SymbolType, S: monthSymbols[m-1]}
+			}
+		}
+	case len(d.DateParts) > 0:
+		dates := make([]string, 0)
+		for _, parts := range d.DateParts {
+			date := make([]string, 0)
+			for i, p := range parts {
+				if i == 0 {
+					date = append(date, cslString(p))
+				} else if n, err := strconv.Atoi(cslString(p)); err == nil {
+					date = append(date, fmt.Sprintf("%02d", n))
+				}
+			}
+			dates = append(dates, strings.Join(date, "-"))
+		}
+		e.Fields["date"] = &Value{T: StringType, S: strings.Join(dates, "/")}
+	case d.Raw != "":
+		e.Fields["date"] = &Value{T: StringType, S: d.Raw}
+	case d.Literal != "":
+		e.Fields["year"] = &Value{T: StringType, S: escapeLaTeX(d.Literal)}
+	}
+}
+
+// cslEntry converts a CSL item into an entry.
+func cslEntry(item map[string]json.RawMessage) (*Entry, error) {
+	e := newEntry()
+
+	var cslType, genre string
+	custom := make(map[string]string)
+	for _, k := range []struct {
+		name string
+		dest interface{}
+	}{{"id", &e.Key}, {"type", &cslType}, {"genre", &genre}, {"custom", &custom}} {
+		if raw, ok := item[k.name]; ok {
+			if err := json.Unmarshal(raw, k.dest); err != nil {
+				// ids may be numbers
+				var v interface{}
+				if json.Unmarshal(raw, &v) != nil || k.name != "id" {
+					return nil, fmt.Errorf("bad %q: %v", k.name, err)
+				}
+				e.Key = cslString(v)
+			}
+		}
+	}
+
+	kind, ok := cslToKind[cslType]
+	if !ok {
+		kind = Misc
+	}
+	switch {
+	case custom["bibtex-type"] != "":
+		kind = toEntryKind(custom["bibtex-type"])
+		e.EntryString = custom["bibtex-type"]
+	case kind == PhdThesis && strings.Contains(strings.ToLower(genre), "master"):
+		kind = MastersThesis
+	}
+	e.Kind = kind
+	if e.EntryString == "" {
+		e.EntryString = string(kind)
+	}
+	delete(custom, "bibtex-type")
+
+	// the inverse of cslFields, using the first field in sorted order for
+	// variables that more than one field maps to
+	inverse := make(map[string]string)
+	tags := make([]string, 0, len(cslFields))
+	for tag := range cslFields {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	for _, tag := range tags {
+		if _, ok := inverse[cslFields[tag]]; !ok {
+			inverse[cslFields[tag]] = tag
+		}
+	}
+	inverse["genre"] = ""
+
+	for name, raw := range item {
+		switch name {
+		case "id", "type", "custom":
+		case "author", "editor":
+			var names []cslName
+			if err := json.Unmarshal(raw, &names); err != nil {
+				return nil, fmt.Errorf("bad %q in %s: %v", name, e.Key, err)
+			}
+			authors := cslNamesToAuthors(names)
+			strs := make([]string, 0, len(authors))
+			for _, a := range authors {
+				strs = append(strs, a.String())
+			}
+			e.Fields[name] = &Value{T: StringType, S: strings.Join(strs, " and ")}
+			if name == "author" {
+				e.AuthorList = authors
+			}
+		case "issued":
+			var d cslDate
+			if err := json.Unmarshal(raw, &d); err != nil {
+				return nil, fmt.Errorf("bad %q in %s: %v", name, e.Key, err)
+			}
+			cslDateFields(e, &d)
+		default:
+			var v interface{}
+			if err := json.Unmarshal(raw, &v); err != nil {
+				return nil, fmt.Errorf("bad %q in %s: %v", name, e.Key, err)
+			}
+			var tag string
+			switch name {
+			case "page":
+				tag = "pages"
+				v = strings.ReplaceAll(cslString(v), "-", "--")
+			case "container-title":
+				switch e.Kind {
+				case Article:
+					tag = "journal"
+				case InBook, InCollection, InProceedings:
+					tag = "booktitle"
+				default:
+					tag = "journal"
+				}
+			case "publisher":
+				tag = publisherField(e.Kind)
+				if custom["publisher-field"] != "" {
+					tag = custom["publisher-field"]
+				}
+			case "genre":
+				if e.Kind == PhdThesis || e.Kind == MastersThesis {
+					continue
+				}
+				tag = "type"
+			default:
+				if t, ok := inverse[name]; ok {
+					tag = t
+				} else {
+					tag = strings.ToLower(name)
+				}
+			}
+			// other dates and structured variables have no BibTeX field
+			switch v.(type) {
+			case string, float64:
+				if cslString(v) != "" {
+					e.Fields[tag] = cslValue(tag, v)
+				}
+			}
+		}
+	}
+
+	delete(custom, "publisher-field")
+	for tag, s := range custom {
+		e.Fields[tag] = &Value{T: StringType, S: s}
+		if i, err := strconv.Atoi(s); err == nil {
+			e.Fields[tag] = &Value{T: NumberType, I: i}
+		}
+	}
+	return e, nil
+}
+
+// ReadCSLJSON reads a CSL-JSON array of items and returns a database with
+// an entry for each item. Text is escaped for LaTeX but is otherwise left as
+// Unicode.
+func ReadCSLJSON(r io.Reader) (*Database, error) {
+	var items []map[string]json.RawMessage
+	if err := json.NewDecoder(r).Decode(&items); err != nil {
+		return nil, err
+	}
+	db := NewDatabase()
+	for _, item := range items {
+		e, err := cslEntry(item)
+		if err != nil {
+			return nil, err
+		}
+		db.Pubs = append(db.Pubs, e)
+	}
+	return db, nil
+}
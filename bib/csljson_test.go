@@ -0,0 +1,140 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestLaTeXToText(t *testing.T) {
+	tests := []struct{ in, out string }{
+		{`Sch{\"o}n \"{U}ber Stra{\ss}e`, "Schön Über Straße"},
+		{`Mar\c{c}ais \'{\i}`, "Marçais í"},
+		{`1--5 --- Big \& {DNA} 50\%`, "1–5 — Big & DNA 50%"},
+		{`\emph{E. coli}`, "E. coli"},
+	}
+	for _, tc := range tests {
+		if got := latexToText(tc.in); got != tc.out {
+			t.Errorf("latexToText(%q) = %q, expected %q", tc.in, got, tc.out)
+		}
+	}
+}
+
+func TestWriteCSLJSON(t *testing.T) {
+	const in = `@string{jcb = "J. Comput. Biol."}
+@article{a1, author={M{\"u}ller, J{\"o}rg and de la Cruz, Jr., Ana and {The Consortium} and others},
+  title={The {DNA} of \emph{E. coli}}, journal=jcb, year=2019, month=mar, pages={1--10}, abstract={foo}}
+`
+	db := NewParser(strings.NewReader(in)).ParseBibTeX()
+	var out bytes.Buffer
+	if err := db.WriteCSLJSON(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	var items []map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &items); err != nil {
+		t.Fatalf("bad JSON: %v", err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("got %d items, expected 1", len(items))
+	}
+	item := items[0]
+	expected := map[string]string{
+		"id":              "a1",
+		"type":            "article-journal",
+		"title":           "The DNA of E. coli",
+		"container-title": "J. Comput. Biol.",
+		"page":            "1-10",
+	}
+	for k, v := range expected {
+		if item[k] != v {
+			t.Errorf("%s = %v, expected %q", k, item[k], v)
+		}
+	}
+
+	authors := item["author"].([]interface{})
+	if len(authors) != 4 {
+		t.Fatalf("got %d authors, expected 4", len(authors))
+	}
+	a0 := authors[0].(map[string]interface{})
+	if a0["family"] != "Müller" || a0["given"] != "Jörg" {
+		t.Errorf("first author = %v", a0)
+	}
+	a1 := authors[1].(map[string]interface{})
+	if a1["non-dropping-particle"] != "de la" || a1["suffix"] != "Jr." {
+		t.Errorf("second author = %v", a1)
+	}
+	if a2 := authors[2].(map[string]interface{}); a2["literal"] != "The Consortium" {
+		t.Errorf("third author = %v", a2)
+	}
+
+	issued := item["issued"].(map[string]interface{})["date-parts"].([]interface{})[0].([]interface{})
+	if len(issued) != 2 || issued[0] != 2019.0 || issued[1] != 3.0 {
+		t.Errorf("issued = %v, expected [2019 3]", issued)
+	}
+	if item["abstract"] != "foo" || item["custom"] != nil {
+		t.Errorf("abstract = %v, custom = %v", item["abstract"], item["custom"])
+	}
+}
+
+func TestCSLJSONRoundTrip(t *testing.T) {
+	const in = `@mastersthesis{t1, author={Smith, Bob}, title={A 50\% Thesis}, school={CMU}, date={2020-05-02/2020-06}}
+@manual{m1, title={Manual}, organization={ACME}, year=2001, note={x}}
+@inproceedings{p1, author={Li, X}, title={P}, booktitle={Proc. X}, year=2021, pages={3--4}, address={NY}}
+`
+	db := NewParser(strings.NewReader(in)).ParseBibTeX()
+	var out bytes.Buffer
+	if err := db.WriteCSLJSON(&out); err != nil {
+		t.Fatal(err)
+	}
+	db2, err := ReadCSLJSON(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := Diff(db, db2); !d.IsEmpty() {
+		var b bytes.Buffer
+		d.Write(&b)
+		t.Errorf("round trip changed the database:\n%s", b.String())
+	}
+}
+
+func TestReadCSLJSON(t *testing.T) {
+	const in = `[{"id": 7, "type": "paper-conference", "title": "R&D_1",
+  "author": [{"family": "Doe", "given": "Jane", "dropping-particle": "van"}],
+  "container-title": "Proc", "page": "5-9", "publisher": "IEEE",
+  "issued": {"date-parts": [[2018, 11]]}, "accessed": {"date-parts": [[2020]]}}]`
+	db, err := ReadCSLJSON(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(db.Pubs) != 1 {
+		t.Fatalf("got %d entries, expected 1", len(db.Pubs))
+	}
+	e := db.Pubs[0]
+	if e.Key != "7" || e.Kind != InProceedings {
+		t.Errorf("key, kind = %q, %q", e.Key, e.Kind)
+	}
+	expected := map[string]string{
+		"title":     `R\&D\_1`,
+		"author":    "van Doe, Jane",
+		"booktitle": "Proc",
+		"pages":     "5--9",
+		"publisher": "IEEE",
+	}
+	for tag, s := range expected {
+		if v, ok := e.Fields[tag]; !ok || v.S != s {
+			t.Errorf("%s = %v, expected %q", tag, v, s)
+		}
+	}
+	if e.Fields["year"].I != 2018 || e.Fields["month"].S != "nov" {
+		t.Errorf("year, month = %v, %v", e.Fields["year"], e.Fields["month"])
+	}
+	if _, ok := e.Fields["accessed"]; ok {
+		t.Errorf("accessed should be dropped")
+	}
+	if len(e.AuthorList) != 1 || e.AuthorList[0].Von != "van" {
+		t.Errorf("author list = %v", e.AuthorList)
+	}
+}
@@ -110,21 +110,43 @@ func (db *Database) SymbolValue(symb *Value, depth int) *Value {
 	return symb
 }
 
-// Less returns true iff v1 < v2.
-func (db *Database) Less(v1 *Value, v2 *Value) bool {
+// sortString returns the string used to compare s when sorting: {} are
+// removed and accents are folded, so {\"o}, \"{o} and ö all sort as o.
+func sortString(s string) string {
+	bt, _ := ParseBraceTree(foldAccents(s))
+	return bt.FlattenForSorting()
+}
+
+// compareStrings compares two strings for sorting. Strings are compared
+// ignoring case, accents, and {}; ties are broken by a case-sensitive
+// comparison.
+func compareStrings(s1, s2 string) int {
+	s1 = sortString(s1)
+	s2 = sortString(s2)
+	if c := strings.Compare(strings.ToLower(s1), strings.ToLower(s2)); c != 0 {
+		return c
+	}
+	return strings.Compare(s1, s2)
+}
+
+// Compare returns -1, 0 or 1 depending on whether v1 is less than, equal to,
+// or greater than v2. Symbols are expanded, strings are compared using
+// compareStrings, and if an int and a string are compared, the int is
+// converted to a string.
+func (db *Database) Compare(v1 *Value, v2 *Value) int {
 
 	// expand the symbols, if appropriate (nop otherwise)
 	v1 = db.SymbolValue(v1, 10)
 	v2 = db.SymbolValue(v2, 10)
 
-	if (v1.T == StringType || v1.T == SymbolType) && (v2.T == StringType || v2.T == SymbolType) {
-		bt1, _ := ParseBraceTree(v1.S)
-		bt2, _ := ParseBraceTree(v2.S)
-		return bt1.FlattenForSorting() < bt2.FlattenForSorting()
-	}
-
 	if v1.T == NumberType && v2.T == NumberType {
-		return v1.I < v2.I
+		switch {
+		case v1.I < v2.I:
+			return -1
+		case v1.I > v2.I:
+			return 1
+		}
+		return 0
 	}
 
 	vs1 := v1.S
@@ -135,10 +157,14 @@ func (db *Database) Less(v1 *Value, v2 *Value) bool {
 	vs2 := v2.S
 	if v2.T == NumberType {
 		vs2 = strconv.Itoa(v2.I)
-
 	}
 
-	return vs1 < vs2
+	return compareStrings(vs1, vs2)
+}
+
+// Less returns true iff v1 < v2.
+func (db *Database) Less(v1 *Value, v2 *Value) bool {
+	return db.Compare(v1, v2) < 0
 }
 
 // Equals returns true if v1 == v2.
@@ -175,7 +201,31 @@ type Entry struct {
 	Key         string
 	Fields      map[string]*Value
 	AuthorList  []*Author
-	LineNo      int
+	// NameLists holds the parsed names of the name-list fields other than
+	// author (which are in AuthorList), set by NormalizeAuthors
+	NameLists map[string][]*Author
+	LineNo    int
+}
+
+// NameList returns the parsed names of the name-list field tag, or nil if
+// they haven't been parsed.
+func (e *Entry) NameList(tag string) []*Author {
+	if tag == "author" {
+		return e.AuthorList
+	}
+	return e.NameLists[tag]
+}
+
+// setNameList sets the parsed names of the name-list field tag.
+func (e *Entry) setNameList(tag string, names []*Author) {
+	if tag == "author" {
+		e.AuthorList = names
+		return
+	}
+	if e.NameLists == nil {
+		e.NameLists = make(map[string][]*Author)
+	}
+	e.NameLists[tag] = names
 }
 
 // IsSubset returns true if this entry is a subset of the given one. An e1 is
@@ -229,6 +279,10 @@ type Database struct {
 	Symbols  map[string]*Value
 	Preamble []string
 	Errors   []*BibTeXError
+
+	// Dialect gives the entry types and fields that the database is
+	// checked and written against. If nil, BibTeXDialect is used.
+	Dialect *Dialect
 }
 
 // NewDatabase creates a new empty database
@@ -245,78 +299,225 @@ func NewDatabase() *Database {
  * Sorting
  *==============================================================================*/
 
-type pubSorter struct {
-	pubs []*Entry
-	by   func(*Entry, *Entry) bool
+// SortKey is one of the keys used to sort the database. Field is either the
+// name of a field or one of the built-in keys "key" (the entry's key), "kind"
+// (the entry type), or "firstauthor" (the first name in the author list).
+type SortKey struct {
+	Field      string
+	Descending bool
+}
+
+// ParseSortKeys parses a comma-separated list of sort keys, each of the form
+// field, field:asc or field:desc. Keys without a direction are descending iff
+// reverse is true. The special list "none" returns no keys.
+func ParseSortKeys(spec string, reverse bool) ([]SortKey, error) {
+	keys := make([]SortKey, 0)
+	if strings.TrimSpace(spec) == "none" {
+		return keys, nil
+	}
+	for _, k := range strings.Split(spec, ",") {
+		field, dir, _ := strings.Cut(k, ":")
+		key := SortKey{
+			Field:      strings.ToLower(strings.TrimSpace(field)),
+			Descending: reverse,
+		}
+		if key.Field == "" {
+			return nil, fmt.Errorf("empty sort key in %q", spec)
+		}
+		switch strings.ToLower(strings.TrimSpace(dir)) {
+		case "":
+		case "asc":
+			key.Descending = false
+		case "desc":
+			key.Descending = true
+		default:
+			return nil, fmt.Errorf("unknown sort direction %q for %q", dir, field)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// sortNames returns the list of names in the given field of e with symbols
+// expanded, or false if e has no such field. If the names of the field have
+// been parsed, they are used.
+func (db *Database) sortNames(e *Entry, field string) ([]*Author, bool) {
+	if list := e.NameList(field); list != nil {
+		return list, true
+	}
+	v, ok := e.Fields[field]
+	if !ok {
+		return nil, false
+	}
+	v = db.SymbolValue(v, 10)
+	if v.T == NumberType {
+		return nil, false
+	}
+	return parseNameList(v.S), true
+}
+
+// compareAuthors compares two names by von and last name, then first name,
+// then jr. "others" sorts after every name.
+func compareAuthors(a1, a2 *Author) int {
+	switch {
+	case a1.Others && a2.Others:
+		return 0
+	case a1.Others:
+		return 1
+	case a2.Others:
+		return -1
+	}
+	for _, p := range [][2]string{
+		{a1.Last, a2.Last},
+		{a1.Von, a2.Von},
+		{a1.First, a2.First},
+		{a1.Jr, a2.Jr},
+	} {
+		if c := compareStrings(p[0], p[1]); c != 0 {
+			return c
+		}
+	}
+	return 0
 }
 
-func (ps *pubSorter) Len() int {
-	return len(ps.pubs)
-}
+// compareNameLists compares two lists of names name by name. If one list is
+// a prefix of the other, the shorter list is smaller.
+func compareNameLists(l1, l2 []*Author) int {
+	for i := 0; i < len(l1) && i < len(l2); i++ {
+		if c := compareAuthors(l1[i], l2[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(l1) < len(l2):
+		return -1
+	case len(l1) > len(l2):
+		return 1
+	}
+	return 0
+}
+
+// compareMissing orders entries by whether they have a value: entries that
+// are missing a value come first. done is true if either value is missing.
+func compareMissing(ok1, ok2 bool) (c int, done bool) {
+	switch {
+	case !ok1 && ok2:
+		return -1, true
+	case ok1 && !ok2:
+		return 1, true
+	case !ok1 && !ok2:
+		return 0, true
+	}
+	return 0, false
+}
+
+// sortValue returns the value of field in e, or false if e has no such
+// field. In biblatex, an entry without a year sorts by the year of its date.
+func (db *Database) sortValue(e *Entry, field string) (*Value, bool) {
+	v, ok := e.Fields[field]
+	if !ok && field == "year" && db.dialect() == BibLaTeXDialect {
+		if d, hasDate := e.Fields["date"]; hasDate {
+			if m := yearPrefix.FindStringSubmatch(displayValue(db.SymbolValue(d, 10))); m != nil {
+				year, _ := strconv.Atoi(m[1])
+				return &Value{T: NumberType, I: year}, true
+			}
+		}
+	}
+	return v, ok
+}
+
+// compareByKey compares two entries using a single sort key, ignoring its
+// direction.
+func (db *Database) compareByKey(e1, e2 *Entry, field string) int {
+	switch field {
+	case "key":
+		return compareStrings(e1.Key, e2.Key)
+	case "kind":
+		return compareStrings(strings.ToLower(e1.EntryString), strings.ToLower(e2.EntryString))
+	case "firstauthor", "author", "editor":
+		name := field
+		if field == "firstauthor" {
+			name = "author"
+		}
+		l1, ok1 := db.sortNames(e1, name)
+		l2, ok2 := db.sortNames(e2, name)
+		if field == "firstauthor" {
+			ok1 = ok1 && len(l1) > 0
+			ok2 = ok2 && len(l2) > 0
+		}
+		if c, done := compareMissing(ok1, ok2); done {
+			return c
+		}
+		if field == "firstauthor" {
+			return compareAuthors(l1[0], l2[0])
+		}
+		return compareNameLists(l1, l2)
+	}
 
-func (ps *pubSorter) Less(i, j int) bool {
-	return ps.by(ps.pubs[i], ps.pubs[j])
+	v1, ok1 := db.sortValue(e1, field)
+	v2, ok2 := db.sortValue(e2, field)
+	if c, done := compareMissing(ok1, ok2); done {
+		return c
+	}
+	return db.Compare(v1, v2)
 }
 
-func (ps *pubSorter) Swap(i, j int) {
-	ps.pubs[i], ps.pubs[j] = ps.pubs[j], ps.pubs[i]
+// SortByKeys sorts the database by each of the given keys in turn: entries
+// that compare equal under the first key are ordered by the second, and so
+// on. Entries missing a field come before those that have it (after, for
+// descending keys); in biblatex, the year key falls back to the year of the
+// date field. The sort is stable, so entries that are equal under every key
+// stay in the order they were in. Entries are compared by their fields
+// including those they inherit, and cross-referenced entries are then moved
+// after the entries that refer to them, as BibTeX requires.
+func (db *Database) SortByKeys(keys []SortKey) {
+	if len(keys) == 0 {
+		return
+	}
+	resolver := db.NewResolver()
+	sort.SliceStable(db.Pubs, func(i, j int) bool {
+		for _, k := range keys {
+			c := db.compareByKey(resolver.Resolve(db.Pubs[i]), resolver.Resolve(db.Pubs[j]), k.Field)
+			if k.Descending {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	db.OrderCrossrefs()
 }
 
-// SortByField sorts the database by the given field. Missing fields will come
-// before non-missing fields. Within the missing fields, entries will be sorted
-// by Key. Uses the value.Less function to determine the order. If reverse is
-// true, this order will be reversed.
+// SortByField sorts the database by the given field (or `none` to leave the
+// database unsorted). If reverse is true, the order is reversed.
 func (db *Database) SortByField(field string, reverse bool) {
 	if field == "none" {
 		return
 	}
-	ps := &pubSorter{
-		pubs: db.Pubs,
-		by: func(e1, e2 *Entry) bool {
-			v1, ok1 := e1.Fields[field]
-			v2, ok2 := e2.Fields[field]
-			ans := false
-			switch {
-			case !ok1 && ok2:
-				ans = true
-			case ok1 && !ok2:
-				ans = false
-			case !ok1 && !ok2:
-				ans = (e1.Key < e2.Key)
-			case ok1 && ok2:
-				ans = db.Less(v1, v2)
-			}
-
-			if reverse {
-				ans = !ans
-			}
-			return ans
-		},
-	}
-	sort.Sort(ps)
+	db.SortByKeys([]SortKey{{Field: field, Descending: reverse}})
 }
 
-// NormalizeAuthors parses every listed author and puts them into normal form.
-// It also populates the Authors field of each entry with the list of *Authors.
-// Call this function before working with the Authors field.
+// NormalizeAuthors parses every listed name in the dialect's name-list fields
+// (author, editor, ...) and puts them into normal form. It also populates the
+// AuthorList and NameLists fields of each entry with the lists of *Authors.
+// Call this function before working with those fields.
 func (db *Database) NormalizeAuthors() {
 	for _, e := range db.Pubs {
-		// if there is an author field that is a string
-		if authors, ok := e.Fields["author"]; ok && authors.T == StringType {
-			// normalize each name
-			e.AuthorList = make([]*Author, 0)
-			names := make([]string, 0)
-
-			a := splitOnTopLevelString(authors.S, "and", true)
-			for _, name := range a {
-				auth := NormalizeName(name)
-				if auth != nil {
-					e.AuthorList = append(e.AuthorList, auth)
+		for _, tag := range db.dialect().NameFields {
+			// if there is a name field that is a string
+			if v, ok := e.Fields[tag]; ok && v.T == StringType {
+				// normalize each name
+				list := parseNameList(v.S)
+				e.setNameList(tag, list)
+				names := make([]string, 0)
+				for _, auth := range list {
 					names = append(names, auth.String())
 				}
-			}
 
-			e.Fields["author"].S = strings.Join(names, " and ")
+				e.Fields[tag].S = strings.Join(names, " and ")
+			}
 		}
 	}
 }
@@ -428,7 +629,6 @@ func (db *Database) ReplaceAbbrMonths() {
 		"nov":  "nov",
 		"dec":  "dec",
 	}
-	monthsnum := []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
 	db.TransformField("month",
 		func(tag string, value *Value) *Value {
 			switch value.T {
@@ -440,7 +640,7 @@ func (db *Database) ReplaceAbbrMonths() {
 			case NumberType:
 				if 1 <= value.I && value.I <= 12 {
 					value.T = SymbolType
-					value.S = monthsnum[value.I-1]
+					value.S = monthSymbols[value.I-1]
 				}
 			}
 			return value
@@ -448,30 +648,11 @@ func (db *Database) ReplaceAbbrMonths() {
 }
 
 // RemoveNonBlessedFields removes any field that isn't 'blessed'. The blessed
-// fields are (a) any fields in the required or optional global variables, any
-// that are in the blessed global variable, plus any fields listed in the
-// additional parameter.
+// fields are (a) any fields that are required or optional for some entry type
+// in the database's dialect, any that are blessed by the dialect, plus any
+// fields listed in the additional parameter.
 func (db *Database) RemoveNonBlessedFields(additional []string) {
-	blessedFields := make(map[string]bool, 0)
-
-	for _, f := range required {
-		for _, r := range f {
-			for _, s := range strings.Split(r, "/") {
-				blessedFields[s] = true
-			}
-		}
-	}
-
-	for _, f := range optional {
-		for _, r := range f {
-			blessedFields[r] = true
-		}
-	}
-
-	for _, f := range blessed {
-		blessedFields[f] = true
-	}
-
+	blessedFields := knownFields(db.dialect())
 	for _, f := range additional {
 		blessedFields[f] = true
 	}
@@ -498,16 +679,18 @@ func (db *Database) RemoveEmptyFields() {
 }
 
 // ReplaceAuthorEtAl changes a terminnating "et al." to the
-// correct "and others" inside of author fields.
+// correct "and others" inside of author, editor and other name-list fields.
 func (db *Database) ReplaceAuthorEtAl() {
 	etal := regexp.MustCompile(`\s[eE][tT]\s+[aA][lL]\.?$`)
-	db.TransformField("author",
-		func(tag string, v *Value) *Value {
-			if v.T == StringType {
-				v.S = etal.ReplaceAllString(v.S, " and others")
-			}
-			return v
-		})
+	for _, tag := range db.dialect().NameFields {
+		db.TransformField(tag,
+			func(tag string, v *Value) *Value {
+				if v.T == StringType {
+					v.S = etal.ReplaceAllString(v.S, " and others")
+				}
+				return v
+			})
+	}
 }
 
 // BraceQuotes replaces any word foo"bar with {foo"bar"}. the most common
@@ -517,20 +700,65 @@ func (db *Database) ReplaceAuthorEtAl() {
 func (db *Database) CanonicalBrace() {
 	db.TransformEachField(
 		func(tag string, v *Value) *Value {
-			if v.T == StringType && tag != "author" {
+			if v.T == StringType && !db.dialect().isNameField(tag) {
 				v.S = canonicalBrace(v.S)
 			}
 			return v
 		})
 }
 
+// UnmappedChar records a non-ASCII character that has no LaTeX equivalent.
+type UnmappedChar struct {
+	Key  string
+	Tag  string
+	Char rune
+}
+
+// ConvertUnicodeToLaTeX replaces the non-ASCII characters in every field
+// (except verbatim fields like url and doi) with LaTeX: accented letters
+// become {\'e} or {\c{c}}, special letters become {\ss}, {\o}, ..., and
+// dashes, quotes, symbols and Greek letters become their LaTeX equivalents.
+// It returns the characters that have no LaTeX equivalent, which are left
+// unchanged.
+func (db *Database) ConvertUnicodeToLaTeX() []UnmappedChar {
+	unmapped := make([]UnmappedChar, 0)
+	for _, e := range db.Pubs {
+		for _, tag := range e.Tags() {
+			v := e.Fields[tag]
+			if v.T != StringType || cslVerbatim[tag] || tag == BiblintOptionsTag {
+				continue
+			}
+			s, missing := unicodeToLaTeX(v.S)
+			v.S = s
+			for _, r := range missing {
+				unmapped = append(unmapped, UnmappedChar{e.Key, tag, r})
+			}
+		}
+	}
+	return unmapped
+}
+
+// ConvertLaTeXToUnicode replaces the LaTeX accents, special letters, dashes,
+// quotes and symbols in every field with Unicode, for files read by biber. See
+// LaTeXToUnicode. Verbatim fields like url and doi are left alone, as are
+// pages, where biber expects ranges to be written with --.
+func (db *Database) ConvertLaTeXToUnicode() {
+	for _, e := range db.Pubs {
+		for tag, v := range e.Fields {
+			if v.T == StringType && !cslVerbatim[tag] && tag != "pages" && tag != BiblintOptionsTag {
+				v.S = LaTeXToUnicode(v.S)
+			}
+		}
+	}
+}
+
 // RemoveWholeFieldBraces removes the braces from fields that look like:
 // {{foo bar baz}}.
 func (db *Database) RemoveWholeFieldBraces() {
 	db.TransformEachField(
 		func(tag string, v *Value) *Value {
-			// we only transform non-author, string-type fields
-			if v.T == StringType && tag != "author" {
+			// we only transform string-type fields that aren't name lists
+			if v.T == StringType && !db.dialect().isNameField(tag) {
 				if bn, size := ParseBraceTree(v.S); size == len(v.S) {
 					if bn.IsEntireStringBraced() {
 						v.S = bn.Children[0].Flatten()
@@ -543,20 +771,34 @@ func (db *Database) RemoveWholeFieldBraces() {
 		})
 }
 
-// ConvertTitlesToMinBraces makes sure that all strange-case words are in {}
+// ConvertTitlesToMinBraces makes sure that all strange-case words are in {},
+// merging adjacent braced words into one group.
 func (db *Database) ConvertTitlesToMinBraces() {
 	db.TransformEachField(
 		func(tag string, v *Value) *Value {
-			// we only transform non-author, string-type fields
+			// we only transform string-type title and booktitle fields
 			if v.T == StringType && (tag == "title" || tag == "booktitle") {
 				if bn, size := ParseBraceTree(v.S); size == len(v.S) {
-					v.S = bn.FlattenToMinBraces()
+					v.S = mergeBraces(bn.FlattenToMinBraces())
 				}
 			}
 			return v
 		})
 }
 
+// MergeAdjacentBraces merges the adjacent {} groups in title and booktitle
+// that are separated only by whitespace or punctuation into one group. See
+// BraceNode.MergeAdjacentBraces.
+func (db *Database) MergeAdjacentBraces() {
+	db.TransformEachField(
+		func(tag string, v *Value) *Value {
+			if v.T == StringType && (tag == "title" || tag == "booktitle") {
+				v.S = mergeBraces(v.S)
+			}
+			return v
+		})
+}
+
 // Removes unneeded "." from the end of the titles. The . must be the last character
 // and it must be preceded by a lowercase letter.
 func (db *Database) RemovePeriodFromTitles() {
@@ -758,21 +1000,21 @@ func isAllLower(s string) bool {
 }
 
 // CheckAuthorLast checks for authors where the last name parsed like "J H" or "JH" or "J.H."
-// or if the last name is all lowercase. Must have called db.NormalizeAuthors(), otherwise
-// this is a no-op.
+// or if the last name is all lowercase. Names protected by braces, like "{NIH}", are
+// skipped. Must have called db.NormalizeAuthors(), otherwise this is a no-op.
 func (db *Database) CheckAuthorLast() {
 	for _, e := range db.Pubs {
-		if e.AuthorList != nil {
-			for _, a := range e.AuthorList {
-				if a.Others == true {
+		for _, tag := range db.dialect().NameFields {
+			for _, a := range e.NameList(tag) {
+				if a.Others == true || a.isProtected() {
 					continue
 				}
 				if strings.TrimSpace(a.Last) == "" {
-					db.addError(e, "author", fmt.Sprintf("name %v has empty last name", a))
+					db.addError(e, tag, fmt.Sprintf("name %v has empty last name", a))
 				} else if isAllCaps(a.Last) {
-					db.addError(e, "author", fmt.Sprintf("name %v has no lowercase in last name", a))
+					db.addError(e, tag, fmt.Sprintf("name %v has no lowercase in last name", a))
 				} else if isAllLower(a.Last) {
-					db.addError(e, "author", fmt.Sprintf("last name in %v is all lowercase", a.Last))
+					db.addError(e, tag, fmt.Sprintf("last name in %v is all lowercase", a.Last))
 				}
 			}
 		}
@@ -792,17 +1034,20 @@ func (db *Database) CheckYearsAreInt() {
 		})
 }
 
-// CheckEtAl reports the error of using "et al" within a author list.
+// CheckEtAl reports the error of using "et al" within a author, editor or
+// other name list.
 func (db *Database) CheckEtAl() {
 	etal := regexp.MustCompile(` [eE][tT]\s+[aA][lL]`)
-	db.CheckField("author",
-		func(v *Value) string {
-			if v.T == StringType && etal.MatchString(v.S) {
-				return "author contains et al"
-			} else {
-				return ""
-			}
-		})
+	for _, tag := range db.dialect().NameFields {
+		db.CheckField(tag,
+			func(v *Value) string {
+				if v.T == StringType && etal.MatchString(v.S) {
+					return tag + " contains et al"
+				} else {
+					return ""
+				}
+			})
+	}
 }
 
 // CheckAllFields is a helper that runs the given check function for each field.
@@ -931,6 +1176,27 @@ func (db *Database) CheckWholeFieldBraces() {
 		})
 }
 
+// CheckFragmentedBraces finds titles and booktitles with adjacent {} groups
+// separated only by whitespace or punctuation, like {mRNA,} {DNA}, that
+// could be one group.
+func (db *Database) CheckFragmentedBraces() {
+	db.CheckAllFields(
+		func(tag string, v *Value) string {
+			if v.T == StringType && (tag == "title" || tag == "booktitle") {
+				if bn, size := ParseBraceTree(v.S); size == len(v.S) {
+					runs := make([]string, 0)
+					for _, run := range bn.mergeableBraceRuns() {
+						runs = append(runs, (&BraceNode{Children: bn.Children[run[0] : run[1]+1]}).flatten(true, true))
+					}
+					if len(runs) > 0 {
+						return fmt.Sprintf("adjacent braced words could be one {} group: %s", strings.Join(runs, "; "))
+					}
+				}
+			}
+			return ""
+		})
+}
+
 // CheckDuplicateKeys finds entries with duplicate keys.
 func (db *Database) CheckDuplicateKeys() {
 	keys := make(map[string]bool)
@@ -948,21 +1214,26 @@ func (db *Database) CheckDuplicateKeys() {
 	}
 }
 
-// CheckRequiredFields reports any missing required fields.
+// CheckRequiredFields reports any missing required fields, as given by the
+// database's dialect. Fields inherited through crossref or xdata count.
 func (db *Database) CheckRequiredFields() {
+	d := db.dialect()
+	resolver := db.NewResolver()
 	for _, e := range db.Pubs {
-		if _, ok := required[e.Kind]; ok {
-			for _, req := range required[e.Kind] {
+		kind := d.KindOf(e)
+		if _, ok := d.Required[kind]; ok {
+			fields := resolver.Resolve(e).Fields
+			for _, req := range d.Required[kind] {
 				found := false
 				for _, r := range strings.Split(req, "/") {
-					if _, ok := e.Fields[r]; ok {
+					if _, ok := fields[r]; ok {
 						found = true
 						break
 					}
 				}
 				if !found {
 					db.addError(e, req,
-						fmt.Sprintf("missing required field %q in %s", req, e.Kind))
+						fmt.Sprintf("missing required field %q in %s", req, kind))
 				}
 			}
 		}
@@ -0,0 +1,130 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFoldAccents(t *testing.T) {
+	tests := map[string]string{
+		`{\"o}`:         "{o}",
+		`\"{o}`:         "o",
+		`\"o`:           "o",
+		`Sch\"{o}n`:     "Schon",
+		`Mar{\c c}ais`:  "Mar{c}ais",
+		`\'{\i}`:        "i",
+		`Stra{\ss}e`:    "Stra{ss}e",
+		`\ss{} x`:       "ss x",
+		`Gödel Ørsted`:  "Godel Orsted",
+		`\cite{foo}`:    `\cite{foo}`,
+		`{\o}ystein`:    "{o}ystein",
+		`\v{C}ech \H o`: "Cech o",
+	}
+	for in, exp := range tests {
+		if out := foldAccents(in); out != exp {
+			t.Errorf("foldAccents(%q) = %q, expected %q", in, out, exp)
+		}
+	}
+}
+
+func TestLaTeXToUnicode(t *testing.T) {
+	tests := map[string]string{
+		`Sch\"{o}n`:             "Schön",
+		`{\"O}zt{\"u}rk`:        "Öztürk",
+		`\"o and \'\i`:          "ö and í",
+		`{\"{O}}`:               "Ö",
+		`{\v{C}}ech`:            "Čech",
+		`Stra\ss{}e {\ss}`:      "Straße ß",
+		`Mar{\c c}ais \c{c}`:    "Marçais ç",
+		`{DNA} and {Sch\"o}n`:   "{DNA} and {Schö}n",
+		"a---b 1--2 ``q''":      "a—b 1–2 “q”",
+		`$\alpha$-helix $x^2$`:  "α-helix $x^2$",
+		`R\&D{\ldots} \emph{X}`: `R\&D… \emph{X}`,
+		`100\% \{\"o`:           `100\% \{ö`,
+	}
+	for in, exp := range tests {
+		if out := LaTeXToUnicode(in); out != exp {
+			t.Errorf("LaTeXToUnicode(%q) = %q, expected %q", in, out, exp)
+		}
+	}
+}
+
+func TestConvertUnicodeToLaTeX(t *testing.T) {
+	const in = `@article{a, author={Pérez, José and Müßig, Jürgen and Ørsted, Hans},
+  title={α-helices — a “study” of ﬁne çedilla, ı and 中},
+  pages={1–10}, url={http://ex.com/é}}
+`
+	db := NewParser(strings.NewReader(in)).ParseBibTeX()
+	unmapped := db.ConvertUnicodeToLaTeX()
+
+	e := db.Pubs[0]
+	tests := map[string]string{
+		"author": `P{\'e}rez, Jos{\'e} and M{\"u}{\ss}ig, J{\"u}rgen and {\O}rsted, Hans`,
+		"title":  "$\\alpha$-helices --- a ``study'' of fine {\\c{c}}edilla, {\\i} and 中",
+		"pages":  "1--10",
+		"url":    "http://ex.com/é",
+	}
+	for tag, exp := range tests {
+		if got := e.Fields[tag].S; got != exp {
+			t.Errorf("%s = %q, expected %q", tag, got, exp)
+		}
+	}
+	if len(unmapped) != 1 || unmapped[0] != (UnmappedChar{"a", "title", '中'}) {
+		t.Errorf("unmapped = %v, expected one '中' in title", unmapped)
+	}
+}
+
+func TestSortByKeys(t *testing.T) {
+	const in = `@article{b, author={{\"O}zt{\"u}rk, A}, year=2010, title={B}}
+@article{a, author={Zhang, B}, year=2012, title={A}}
+@article{c, author={Ozturk, A and Smith, J}, year=2010, title={C}}
+@misc{d, title={D}}
+@article{e, author={Oak, Q}, year=2010, title={E}}
+`
+	db := NewParser(strings.NewReader(in)).ParseBibTeX()
+
+	tests := []struct {
+		spec string
+		keys string
+	}{
+		{"year:desc,author:asc", "a,e,b,c,d"},
+		{"year:desc,title:desc", "a,e,c,b,d"},
+		{"firstauthor", "d,e,c,b,a"},
+		{"kind:desc", "d,e,c,b,a"},
+		{"key", "a,b,c,d,e"},
+	}
+	for _, tt := range tests {
+		keys, err := ParseSortKeys(tt.spec, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.SortByKeys(keys)
+		sorted := make([]string, 0)
+		for _, e := range db.Pubs {
+			sorted = append(sorted, e.Key)
+		}
+		if strings.Join(sorted, ",") != tt.keys {
+			t.Errorf("sort %q gave %v, expected %s", tt.spec, sorted, tt.keys)
+		}
+	}
+
+	// in biblatex, an entry with only a date sorts by its year
+	db = NewParser(strings.NewReader(`@online{a, title={A}, date={2020-05}}
+@article{b, title={B}, year=2021}
+@article{c, title={C}, year=2019}
+`)).ParseBibTeX()
+	db.Dialect = BibLaTeXDialect
+	db.SortByKeys([]SortKey{{Field: "year"}})
+	sorted := make([]string, 0)
+	for _, e := range db.Pubs {
+		sorted = append(sorted, e.Key)
+	}
+	if strings.Join(sorted, ",") != "c,a,b" {
+		t.Errorf("biblatex sort by year gave %v, expected c,a,b", sorted)
+	}
+
+	if _, err := ParseSortKeys("year:sideways", false); err == nil {
+		t.Errorf("expected error for bad direction")
+	}
+}
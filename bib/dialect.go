@@ -0,0 +1,285 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"sort"
+	"strings"
+)
+
+/*=====================================================================================
+ * Dialects
+ *
+ * A dialect gives the entry types and fields understood by the program that
+ * will read the .bib file: classic BibTeX, or biblatex with biber. Fields
+ * written "a/b" can be given by either field (e.g. "year/date", or a biblatex
+ * field and its BibTeX alias).
+ *====================================================================================*/
+
+// Dialect holds the entry types and fields of a flavor of BibTeX.
+type Dialect struct {
+	Name string
+	// Required and Optional list the fields of each entry type, in the
+	// order they are written
+	Required map[EntryKind][]string
+	Optional map[EntryKind][]string
+	// Blessed lists the fields that are kept for any entry type
+	Blessed []string
+	// KindAliases maps entry type names that the dialect treats as another
+	// type (e.g. @electronic for @online) to that type
+	KindAliases map[string]EntryKind
+	// NameFields lists the fields that hold "and"-separated lists of names
+	NameFields []string
+}
+
+// KindOf returns the kind of the entry as understood by the dialect,
+// resolving aliased entry types.
+func (d *Dialect) KindOf(e *Entry) EntryKind {
+	if k, ok := d.KindAliases[strings.ToLower(e.EntryString)]; ok {
+		return k
+	}
+	return e.Kind
+}
+
+// isNameField returns true if the field holds a list of names.
+func (d *Dialect) isNameField(tag string) bool {
+	for _, f := range d.NameFields {
+		if f == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// BibTeXDialect is classic BibTeX, as understood by the standard styles.
+var BibTeXDialect = &Dialect{
+	Name:        "bibtex",
+	Required:    required,
+	Optional:    optional,
+	Blessed:     blessed,
+	KindAliases: map[string]EntryKind{},
+	NameFields:  []string{"author", "editor"},
+}
+
+// fieldList concatenates lists of fields.
+func fieldList(lists ...[]string) []string {
+	fields := make([]string, 0)
+	for _, l := range lists {
+		fields = append(fields, l...)
+	}
+	return fields
+}
+
+// groups of biblatex fields shared by many entry types
+var (
+	blxTitle   = []string{"subtitle", "titleaddon"}
+	blxMain    = []string{"maintitle", "mainsubtitle", "maintitleaddon"}
+	blxBook    = []string{"booksubtitle", "booktitleaddon"}
+	blxEditors = []string{"editora", "editorb", "editorc", "translator", "annotator", "commentator", "introduction", "foreword", "afterword"}
+	blxEvent   = []string{"eventtitle", "eventtitleaddon", "eventdate", "venue"}
+	blxLang    = []string{"language", "origlanguage"}
+	blxSeries  = []string{"volume", "part", "edition", "volumes", "series", "number", "note"}
+	blxPub     = []string{"publisher", "location/address", "isbn", "eid", "chapter", "pages"}
+	blxEnd     = []string{"addendum", "pubstate", "doi", "eprint", "eprintclass", "eprinttype", "url", "urldate"}
+)
+
+// biblatexRequired lists the required fields of the biblatex entry types.
+var biblatexRequired = map[EntryKind][]string{
+	Other:          {},
+	String:         {},
+	Preamble:       {},
+	Article:        {"author", "title", "journaltitle/journal", "year/date"},
+	Book:           {"author", "title", "year/date"},
+	MvBook:         {"author", "title", "year/date"},
+	InBook:         {"author", "title", "booktitle", "year/date"},
+	BookInBook:     {"author", "title", "booktitle", "year/date"},
+	SuppBook:       {"author", "title", "booktitle", "year/date"},
+	Booklet:        {"author/editor", "title", "year/date"},
+	Collection:     {"editor", "title", "year/date"},
+	MvCollection:   {"editor", "title", "year/date"},
+	InCollection:   {"author", "title", "booktitle", "year/date"},
+	SuppCollection: {"author", "title", "booktitle", "year/date"},
+	Dataset:        {"author/editor", "title", "year/date"},
+	Manual:         {"author/editor", "title", "year/date"},
+	Misc:           {"author/editor", "title", "year/date"},
+	Online:         {"author/editor", "title", "year/date", "doi/eprint/url"},
+	Patent:         {"author", "title", "number", "year/date"},
+	Periodical:     {"editor", "title", "year/date"},
+	SuppPeriodical: {"author", "title", "journaltitle/journal", "year/date"},
+	Proceedings:    {"title", "year/date"},
+	MvProceedings:  {"title", "year/date"},
+	InProceedings:  {"author", "title", "booktitle", "year/date"},
+	Reference:      {"editor", "title", "year/date"},
+	MvReference:    {"editor", "title", "year/date"},
+	InReference:    {"author", "title", "booktitle", "year/date"},
+	Report:         {"author", "title", "type", "institution", "year/date"},
+	Set:            {"entryset"},
+	Software:       {"author/editor", "title", "year/date"},
+	Thesis:         {"author", "title", "type", "institution/school", "year/date"},
+	Unpublished:    {"author", "title", "year/date"},
+	XData:          {},
+
+	// BibTeX types that biblatex treats as aliases of @thesis and @report,
+	// with the type implied
+	MastersThesis: {"author", "title", "institution/school", "year/date"},
+	PhdThesis:     {"author", "title", "institution/school", "year/date"},
+	TechReport:    {"author", "title", "institution", "year/date"},
+}
+
+// biblatexOptional lists the optional fields of the biblatex entry types.
+var biblatexOptional = map[EntryKind][]string{
+	Other:    {},
+	String:   {},
+	Preamble: {},
+	Article: fieldList([]string{"translator", "annotator", "commentator"}, blxTitle,
+		[]string{"editor", "editora", "editorb", "editorc", "journalsubtitle", "journaltitleaddon",
+			"issuetitle", "issuesubtitle", "issuetitleaddon"}, blxLang,
+		[]string{"series", "volume", "number", "eid", "issue", "month", "pages", "version", "note", "issn"}, blxEnd),
+	Book:   fieldList([]string{"editor"}, blxEditors, blxTitle, blxMain, blxLang, blxSeries, blxPub, []string{"pagetotal"}, blxEnd),
+	MvBook: fieldList([]string{"editor"}, blxEditors, blxTitle, blxLang, []string{"edition", "volumes", "series", "number", "note", "publisher", "location/address", "isbn", "pagetotal"}, blxEnd),
+	InBook: fieldList([]string{"bookauthor", "editor"}, blxEditors, blxTitle, blxMain, blxBook, blxLang, blxSeries, blxPub, blxEnd),
+	Booklet: fieldList(blxTitle, []string{"language", "howpublished", "type", "note", "location/address", "eid", "chapter", "pages", "pagetotal", "month"},
+		blxEnd),
+	Collection:   fieldList(blxEditors, blxTitle, blxMain, blxLang, blxSeries, blxPub, []string{"pagetotal"}, blxEnd),
+	MvCollection: fieldList(blxEditors, blxTitle, blxLang, []string{"edition", "volumes", "series", "number", "note", "publisher", "location/address", "isbn", "pagetotal"}, blxEnd),
+	InCollection: fieldList([]string{"editor"}, blxEditors, blxTitle, blxMain, blxBook, blxLang, blxSeries, blxPub, blxEnd),
+	Dataset: fieldList(blxTitle, []string{"language", "edition", "type", "series", "number", "version", "note",
+		"organization", "publisher", "location/address", "month"}, blxEnd),
+	Manual: fieldList(blxTitle, []string{"language", "edition", "type", "series", "number", "version", "note",
+		"organization", "publisher", "location/address", "isbn", "eid", "chapter", "pages", "pagetotal", "month"}, blxEnd),
+	Misc: fieldList(blxTitle, []string{"language", "howpublished", "type", "version", "note", "organization",
+		"location/address", "month"}, blxEnd),
+	Online: fieldList(blxTitle, []string{"language", "version", "note", "organization", "month"}, blxEnd),
+	Patent: fieldList([]string{"holder"}, blxTitle, []string{"type", "version", "location/address", "note", "month"}, blxEnd),
+	Periodical: fieldList([]string{"editora", "editorb", "editorc"}, blxTitle,
+		[]string{"issuetitle", "issuesubtitle", "issuetitleaddon", "language", "series", "volume", "number",
+			"issue", "month", "note", "issn"}, blxEnd),
+	Proceedings: fieldList([]string{"editor"}, blxTitle, blxMain, blxEvent, []string{"language", "volume", "part", "volumes",
+		"series", "number", "note", "organization", "publisher", "location/address", "month", "isbn", "eid", "chapter",
+		"pages", "pagetotal"}, blxEnd),
+	MvProceedings: fieldList([]string{"editor"}, blxTitle, blxEvent, []string{"language", "volumes", "series", "number",
+		"note", "organization", "publisher", "location/address", "month", "isbn", "pagetotal"}, blxEnd),
+	InProceedings: fieldList([]string{"editor"}, blxTitle, blxMain, blxBook, blxEvent, []string{"language", "volume",
+		"part", "volumes", "series", "number", "note", "organization", "publisher", "location/address", "month", "isbn",
+		"eid", "chapter", "pages"}, blxEnd),
+	Report: fieldList(blxTitle, []string{"language", "number", "version", "note", "location/address", "month", "isrn",
+		"eid", "chapter", "pages", "pagetotal"}, blxEnd),
+	Set: {},
+	Thesis: fieldList(blxTitle, []string{"language", "note", "location/address", "month", "isbn", "eid", "chapter",
+		"pages", "pagetotal"}, blxEnd),
+	Unpublished: fieldList(blxTitle, []string{"type"}, blxEvent, []string{"language", "howpublished", "note",
+		"location/address", "isbn", "month"}, blxEnd),
+	XData: {},
+}
+
+func init() {
+	// types that take the fields of another type
+	for kind, like := range map[EntryKind]EntryKind{
+		BookInBook:     InBook,
+		SuppBook:       InBook,
+		SuppCollection: InCollection,
+		SuppPeriodical: Article,
+		Reference:      Collection,
+		MvReference:    MvCollection,
+		InReference:    InCollection,
+		Software:       Misc,
+		MastersThesis:  Thesis,
+		PhdThesis:      Thesis,
+		TechReport:     Report,
+	} {
+		biblatexOptional[kind] = biblatexOptional[like]
+	}
+	// the implied type can be overridden
+	for _, kind := range []EntryKind{MastersThesis, PhdThesis, TechReport} {
+		biblatexOptional[kind] = append([]string{"type"}, biblatexOptional[kind]...)
+	}
+}
+
+// biblatexBlessed lists the biblatex fields that can be used in any entry
+// type: the special fields used for sorting, labels, cross-referencing and
+// language handling, the identifiers, and the BibTeX names of fields that
+// biber accepts as aliases. Annotations, abstracts and attached files are not
+// part of the citation and aren't blessed.
+var biblatexBlessed = []string{
+	"key", "note", "url", "doi", "pmc", "pmid", "crossref", "xref", "xdata", "entryset", "ids",
+	"keywords", "issn", "isbn", "isrn", "ismn", "isan", "iswc", "date", "urldate", "eventdate",
+	"origdate", "origtitle", "origlocation", "origpublisher", "nameaddon", "langid", "langidopts",
+	"hyphenation", "options", "presort", "sortkey", "sortname", "sorttitle", "sortyear",
+	"sortshorthand", "shorthand", "shorthandintro", "shorttitle", "shortauthor", "shorteditor",
+	"shortjournal", "shortseries", "label", "indexsorttitle", "indextitle", "related",
+	"relatedtype", "relatedstring", "relatedoptions", "execute", "gender", "pagination",
+	"bookpagination", "eprint", "eprinttype", "eprintclass",
+	"address", "journal", "school", "archiveprefix", "primaryclass",
+	BiblintOptionsTag,
+}
+
+// BibLaTeXDialect is biblatex, as read by biber, with its full set of entry
+// types and fields. The BibTeX types and fields that biber accepts as
+// aliases (e.g. @phdthesis, @conference, journal, address) are understood.
+var BibLaTeXDialect = &Dialect{
+	Name:     "biblatex",
+	Required: biblatexRequired,
+	Optional: biblatexOptional,
+	Blessed:  biblatexBlessed,
+	KindAliases: map[string]EntryKind{
+		"conference": InProceedings,
+		"electronic": Online,
+		"www":        Online,
+		// types that the standard styles print as @misc
+		"artwork":      Misc,
+		"audio":        Misc,
+		"bibnote":      Misc,
+		"commentary":   Misc,
+		"image":        Misc,
+		"jurisdiction": Misc,
+		"legislation":  Misc,
+		"legal":        Misc,
+		"letter":       Misc,
+		"movie":        Misc,
+		"music":        Misc,
+		"performance":  Misc,
+		"review":       Misc,
+		"standard":     Misc,
+		"video":        Misc,
+		"customa":      Misc,
+		"customb":      Misc,
+		"customc":      Misc,
+		"customd":      Misc,
+		"custome":      Misc,
+		"customf":      Misc,
+	},
+	NameFields: []string{
+		"author", "bookauthor", "editor", "editora", "editorb", "editorc", "translator",
+		"annotator", "commentator", "introduction", "foreword", "afterword", "holder",
+	},
+}
+
+// dialects are the known dialects, by name.
+var dialects = map[string]*Dialect{
+	BibTeXDialect.Name:   BibTeXDialect,
+	BibLaTeXDialect.Name: BibLaTeXDialect,
+}
+
+// LookupDialect returns the dialect with the given name, ignoring case.
+func LookupDialect(name string) (*Dialect, bool) {
+	d, ok := dialects[strings.ToLower(strings.TrimSpace(name))]
+	return d, ok
+}
+
+// DialectNames returns the names of the known dialects, sorted and joined
+// with ", ".
+func DialectNames() string {
+	names := make([]string, 0, len(dialects))
+	for name := range dialects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// dialect returns the dialect of the database, which is BibTeX unless set.
+func (db *Database) dialect() *Dialect {
+	if db.Dialect == nil {
+		return BibTeXDialect
+	}
+	return db.Dialect
+}
@@ -0,0 +1,128 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const biblatexTestBib = `@online{web, author={Doe, Jane}, title={A Page}, urldate={2020-01-01},
+  date={2020}, url={http://x.org}, abstract={A}, eprinttype={arxiv}, subtitle={Sub}}
+@thesis{th, author={Doe, Jane}, title={T}, institution={CMU}, date={2019}}
+@phdthesis{ph, author={Doe, Jane}, title={T}, school={CMU}, year=2019, address={Pittsburgh}}
+@article{ar, author={Doe, Jane}, title={T}, journal={J}, year=2019}
+@electronic{el, title={E}, year=2020}
+`
+
+func TestDialectRequiredFields(t *testing.T) {
+	tests := []struct {
+		dialect *Dialect
+		missing []string
+	}{
+		{BibTeXDialect, []string{"ar:volume"}},
+		{BibLaTeXDialect, []string{"th:type", "el:author/editor", "el:doi/eprint/url"}},
+	}
+	for _, tc := range tests {
+		db := NewParser(strings.NewReader(biblatexTestBib)).ParseBibTeX()
+		db.Dialect = tc.dialect
+		db.CheckRequiredFields()
+		missing := make([]string, 0)
+		for _, err := range db.Errors {
+			missing = append(missing, err.BadEntry.Key+":"+err.Tag)
+		}
+		if strings.Join(missing, " ") != strings.Join(tc.missing, " ") {
+			t.Errorf("%s: missing %v, expected %v", tc.dialect.Name, missing, tc.missing)
+		}
+	}
+}
+
+func TestDialectBlessedFields(t *testing.T) {
+	db := NewParser(strings.NewReader(biblatexTestBib)).ParseBibTeX()
+	db.Dialect = BibLaTeXDialect
+	db.RemoveNonBlessedFields(nil)
+	web := db.Pubs[0]
+	for _, tag := range []string{"urldate", "eprinttype", "subtitle", "date"} {
+		if _, ok := web.Fields[tag]; !ok {
+			t.Errorf("biblatex field %q was removed", tag)
+		}
+	}
+	if _, ok := web.Fields["abstract"]; ok {
+		t.Errorf("abstract was kept")
+	}
+	if _, ok := db.Pubs[2].Fields["address"]; !ok {
+		t.Errorf("address (an alias of location) was removed")
+	}
+
+	db = NewParser(strings.NewReader(biblatexTestBib)).ParseBibTeX()
+	db.RemoveNonBlessedFields(nil)
+	if _, ok := db.Pubs[0].Fields["urldate"]; ok {
+		t.Errorf("urldate was kept for bibtex")
+	}
+}
+
+func TestDialectFieldOrder(t *testing.T) {
+	db := NewParser(strings.NewReader(biblatexTestBib)).ParseBibTeX()
+	db.Dialect = BibLaTeXDialect
+	db.Pubs = db.Pubs[:1]
+	var b bytes.Buffer
+	db.WriteDatabase(&b)
+	tags := make([]string, 0)
+	for _, line := range strings.Split(b.String(), "\n") {
+		if f := strings.Fields(line); len(f) > 1 && f[1] == "=" {
+			tags = append(tags, f[0])
+		}
+	}
+	exp := "author title date url subtitle eprinttype urldate abstract"
+	if strings.Join(tags, " ") != exp {
+		t.Errorf("fields written in order %v, expected %s", tags, exp)
+	}
+
+	if k := BibLaTeXDialect.KindOf(&Entry{Kind: Other, EntryString: "Electronic"}); k != Online {
+		t.Errorf("@electronic is %s, expected online", k)
+	}
+}
+
+func TestDialectNameFields(t *testing.T) {
+	in := `@book{b, author={Jane Doe}, editor={Carl Kingsford et al.}, translator={Rob patro and J H}, title={T}, date={2020}}`
+	tests := []struct {
+		dialect *Dialect
+		errors  []string
+		lists   []string
+	}{
+		{BibTeXDialect, []string{"editor"}, []string{"editor"}},
+		{BibLaTeXDialect, []string{"editor", "translator", "translator"}, []string{"editor", "translator"}},
+	}
+	for _, tc := range tests {
+		db := NewParser(strings.NewReader(in)).ParseBibTeX()
+		db.Dialect = tc.dialect
+		db.CheckEtAl()
+		db.ReplaceAuthorEtAl()
+		db.NormalizeAuthors()
+		db.CheckAuthorLast()
+		tags := make([]string, 0)
+		for _, err := range db.Errors {
+			tags = append(tags, err.Tag)
+		}
+		if strings.Join(tags, " ") != strings.Join(tc.errors, " ") {
+			t.Errorf("%s: errors in %v, expected %v", tc.dialect.Name, tags, tc.errors)
+		}
+
+		e := db.Pubs[0]
+		if len(e.AuthorList) != 1 || e.AuthorList[0].Last != "Doe" {
+			t.Errorf("%s: author list = %v", tc.dialect.Name, e.AuthorList)
+		}
+		lists := make([]string, 0)
+		for _, tag := range []string{"editor", "translator"} {
+			if e.NameList(tag) != nil {
+				lists = append(lists, tag)
+			}
+		}
+		if strings.Join(lists, " ") != strings.Join(tc.lists, " ") {
+			t.Errorf("%s: parsed %v, expected %v", tc.dialect.Name, lists, tc.lists)
+		}
+		if exp := "Kingsford, Carl and others"; e.Fields["editor"].S != exp {
+			t.Errorf("%s: editor = %q, expected %q", tc.dialect.Name, e.Fields["editor"].S, exp)
+		}
+	}
+}
@@ -0,0 +1,391 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*=====================================================================================
+ * Converting between dialects
+ *
+ * biblatex renames some BibTeX fields (journal → journaltitle, address →
+ * location, school → institution), replaces year and month by an ISO 8601
+ * date, and folds @phdthesis, @mastersthesis and @techreport into @thesis and
+ * @report with a type field. Converting to BibTeX undoes this, and maps the
+ * biblatex-only entry types to their nearest BibTeX type. Anything that can't
+ * be carried over exactly is reported as an error on the entry.
+ *====================================================================================*/
+
+// ConvertToDialect rewrites the entries of the database to use the entry
+// types and fields of the given dialect, and makes it the database's dialect.
+// Lossy conversions are added to db.Errors.
+func (db *Database) ConvertToDialect(d *Dialect) {
+	for _, e := range db.Pubs {
+		switch d {
+		case BibLaTeXDialect:
+			db.toBibLaTeX(e)
+		case BibTeXDialect:
+			db.toBibTeX(e)
+		}
+	}
+	db.Dialect = d
+}
+
+// setKind changes the entry type of e.
+func setKind(e *Entry, k EntryKind) {
+	e.Kind = k
+	e.EntryString = string(k)
+}
+
+// fieldText returns the text of the tag field of e, with symbols expanded,
+// or "" if it isn't set.
+func (db *Database) fieldText(e *Entry, tag string) string {
+	v, ok := e.Fields[tag]
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(displayValue(db.SymbolValue(v, 10)))
+}
+
+// renameField moves the from field of e to the to field. If both are set, to
+// is kept, and the loss of from is reported if they differ.
+func (db *Database) renameField(e *Entry, from, to string) {
+	v, ok := e.Fields[from]
+	if !ok {
+		return
+	}
+	delete(e.Fields, from)
+	if _, ok := e.Fields[to]; !ok {
+		e.Fields[to] = v
+	} else if db.fieldText(e, to) != strings.TrimSpace(displayValue(db.SymbolValue(v, 10))) {
+		db.addError(e, from, fmt.Sprintf("both %s and %s are set; dropped %s = %q", from, to, from, displayValue(v)))
+	}
+}
+
+/*-------------------------------------------------------------------------------------
+ * To biblatex
+ *-----------------------------------------------------------------------------------*/
+
+// biblatexRenames lists the BibTeX fields that biblatex renames.
+var biblatexRenames = [][2]string{
+	{"journal", "journaltitle"},
+	{"address", "location"},
+	{"school", "institution"},
+}
+
+// thesisTypes gives the biblatex type keys of the BibTeX thesis types.
+var thesisTypes = map[EntryKind]string{
+	PhdThesis:     "phdthesis",
+	MastersThesis: "mathesis",
+}
+
+// urlHowPublished matches a howpublished field that holds only a URL.
+var urlHowPublished = regexp.MustCompile(`^\s*(?:\\url\{([^{}]*)\}|(https?://\S+))\s*$`)
+
+// toBibLaTeX converts e from BibTeX to biblatex conventions.
+func (db *Database) toBibLaTeX(e *Entry) {
+	switch e.Kind {
+	case PhdThesis, MastersThesis:
+		if _, ok := e.Fields["type"]; !ok {
+			e.Fields["type"] = &Value{T: StringType, S: thesisTypes[e.Kind]}
+		}
+		setKind(e, Thesis)
+	case TechReport:
+		if _, ok := e.Fields["type"]; !ok {
+			e.Fields["type"] = &Value{T: StringType, S: "techreport"}
+		}
+		setKind(e, Report)
+	case Misc:
+		m := urlHowPublished.FindStringSubmatch(db.fieldText(e, "howpublished"))
+		if m == nil {
+			break
+		}
+		url := m[1] + m[2]
+		if db.fieldText(e, "url") == "" {
+			e.Fields["url"] = &Value{T: StringType, S: url}
+		} else if db.fieldText(e, "url") != url {
+			db.addError(e, "howpublished", fmt.Sprintf("both howpublished and url are set; dropped howpublished = %q", url))
+		}
+		delete(e.Fields, "howpublished")
+		setKind(e, Online)
+	}
+	if e.Kind == Other && BibLaTeXDialect.KindOf(e) == Online {
+		setKind(e, Online)
+	}
+
+	for _, r := range biblatexRenames {
+		db.renameField(e, r[0], r[1])
+	}
+	db.yearToDate(e)
+}
+
+// yearToDate replaces the year and month fields of e by a date field. If the
+// year isn't a number or the month isn't a month, the fields are left alone.
+func (db *Database) yearToDate(e *Entry) {
+	year, ok := e.Fields["year"]
+	if !ok {
+		if _, ok := e.Fields["month"]; ok && e.Fields["date"] == nil {
+			db.addError(e, "month", "month without a year can't be converted to a date")
+		}
+		return
+	}
+	if _, ok := e.Fields["date"]; ok {
+		if !strings.HasPrefix(db.fieldText(e, "date"), db.fieldText(e, "year")) {
+			db.addError(e, "year", fmt.Sprintf("both date and year are set; dropped year = %q", displayValue(year)))
+		}
+		delete(e.Fields, "year")
+		delete(e.Fields, "month")
+		return
+	}
+
+	y := db.fieldText(e, "year")
+	if m := isoDate.FindStringSubmatch(y); m == nil || m[2] != "" {
+		db.addError(e, "year", fmt.Sprintf("year %q isn't a four-digit year; left as year", y))
+		return
+	}
+	date := y
+	if month, ok := e.Fields["month"]; ok {
+		n := db.monthNumber(month)
+		if n == 0 {
+			db.addError(e, "month", fmt.Sprintf("month %q isn't a month; left as year and month", displayValue(month)))
+			return
+		}
+		date = fmt.Sprintf("%s-%02d", y, n)
+	}
+	e.Fields["date"] = &Value{T: StringType, S: date}
+	delete(e.Fields, "year")
+	delete(e.Fields, "month")
+}
+
+/*-------------------------------------------------------------------------------------
+ * To BibTeX
+ *-----------------------------------------------------------------------------------*/
+
+// bibtexKinds gives the nearest BibTeX entry type of the biblatex types that
+// BibTeX doesn't have. @thesis, @report and @online are handled separately.
+var bibtexKinds = map[EntryKind]EntryKind{
+	BookInBook:     InBook,
+	SuppBook:       InBook,
+	Collection:     Book,
+	MvBook:         Book,
+	MvCollection:   Book,
+	Reference:      Book,
+	MvReference:    Book,
+	InReference:    InCollection,
+	SuppCollection: InCollection,
+	MvProceedings:  Proceedings,
+	Periodical:     Misc,
+	SuppPeriodical: Article,
+	Dataset:        Misc,
+	Patent:         Misc,
+	Software:       Misc,
+}
+
+// typeKeyNames gives the text of the biblatex type keys that BibTeX doesn't
+// understand.
+var typeKeyNames = map[string]string{
+	"candthesis": "Candidate thesis",
+	"bathesis":   "Bachelor's thesis",
+	"resreport":  "Research report",
+	"software":   "Computer software",
+	"datacd":     "CD-ROM",
+	"audiocd":    "Audio CD",
+	"patent":     "Patent",
+	"patentus":   "U.S. patent",
+	"patentde":   "German patent",
+	"patenteu":   "European patent",
+	"patentfr":   "French patent",
+	"patentuk":   "British patent",
+	"patreq":     "Patent request",
+	"patrequs":   "U.S. patent request",
+}
+
+// bibtexRenames lists the biblatex fields that BibTeX calls something else.
+// institution is only renamed for theses.
+var bibtexRenames = [][2]string{
+	{"journaltitle", "journal"},
+	{"location", "address"},
+}
+
+// bibtexFields and biblatexFields are the sets of fields known to each
+// dialect.
+var (
+	bibtexFields   = knownFields(BibTeXDialect)
+	biblatexFields = knownFields(BibLaTeXDialect)
+)
+
+// knownFields returns the set of fields named by the dialect.
+func knownFields(d *Dialect) map[string]bool {
+	fields := make(map[string]bool)
+	add := func(list []string) {
+		for _, f := range list {
+			for _, s := range strings.Split(f, "/") {
+				fields[s] = true
+			}
+		}
+	}
+	for _, list := range d.Required {
+		add(list)
+	}
+	for _, list := range d.Optional {
+		add(list)
+	}
+	add(d.Blessed)
+	return fields
+}
+
+// toBibTeX converts e from biblatex to BibTeX conventions.
+func (db *Database) toBibTeX(e *Entry) {
+	orig := e.EntryString
+	kind := BibLaTeXDialect.KindOf(e)
+	switch {
+	case kind == Thesis:
+		db.thesisToBibTeX(e)
+	case kind == Report:
+		if strings.EqualFold(db.fieldText(e, "type"), "techreport") {
+			delete(e.Fields, "type")
+		} else {
+			db.typeKeyToText(e)
+		}
+		setKind(e, TechReport)
+	case kind == Online:
+		db.onlineToMisc(e)
+	case kind == Misc && e.Kind == Other:
+		setKind(e, Misc)
+		db.addError(e, "", fmt.Sprintf("@%s has no BibTeX entry type; converted to @misc", strings.ToLower(orig)))
+	case kind == InProceedings && e.Kind == Other:
+		setKind(e, InProceedings)
+	case bibtexKinds[kind] != "":
+		setKind(e, bibtexKinds[kind])
+		db.addError(e, "", fmt.Sprintf("@%s has no BibTeX entry type; converted to @%s", kind, e.Kind))
+	case kind == Set || kind == XData:
+		db.addError(e, "", fmt.Sprintf("@%s has no BibTeX equivalent; left as is", kind))
+	}
+
+	for _, r := range bibtexRenames {
+		db.renameField(e, r[0], r[1])
+	}
+	if e.Kind == PhdThesis || e.Kind == MastersThesis {
+		db.renameField(e, "institution", "school")
+	}
+	db.dateToYear(e)
+	db.appendSubtitle(e, "subtitle", "title")
+	db.appendSubtitle(e, "booksubtitle", "booktitle")
+
+	unknown := make([]string, 0)
+	for tag := range e.Fields {
+		if biblatexFields[tag] && !bibtexFields[tag] {
+			unknown = append(unknown, tag)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		db.addError(e, "", fmt.Sprintf("biblatex-only fields are ignored by BibTeX: %s", strings.Join(unknown, ", ")))
+	}
+}
+
+// thesisToBibTeX converts a @thesis to a @phdthesis or @mastersthesis.
+func (db *Database) thesisToBibTeX(e *Entry) {
+	t := strings.ToLower(db.fieldText(e, "type"))
+	switch {
+	case t == "phdthesis":
+		delete(e.Fields, "type")
+		setKind(e, PhdThesis)
+	case t == "mathesis":
+		delete(e.Fields, "type")
+		setKind(e, MastersThesis)
+	case t == "":
+		setKind(e, PhdThesis)
+		db.addError(e, "", "@thesis has no type; converted to @phdthesis")
+	case strings.Contains(t, "phd") || strings.Contains(t, "doctor") || strings.Contains(t, "dissertation"):
+		setKind(e, PhdThesis)
+	default:
+		db.typeKeyToText(e)
+		setKind(e, MastersThesis)
+	}
+}
+
+// typeKeyToText replaces a biblatex type key in the type field of e by its
+// text, since BibTeX prints the type field as is.
+func (db *Database) typeKeyToText(e *Entry) {
+	if name, ok := typeKeyNames[strings.ToLower(db.fieldText(e, "type"))]; ok {
+		e.Fields["type"] = &Value{T: StringType, S: name}
+	}
+}
+
+// onlineToMisc converts an @online (or @electronic or @www) entry to a @misc
+// with its URL moved to howpublished, unless howpublished is already set, and
+// its access date in note.
+func (db *Database) onlineToMisc(e *Entry) {
+	setKind(e, Misc)
+	if url := db.fieldText(e, "url"); url != "" && db.fieldText(e, "howpublished") == "" {
+		e.Fields["howpublished"] = &Value{T: StringType, S: `\url{` + url + `}`}
+		delete(e.Fields, "url")
+	}
+	if urldate := db.fieldText(e, "urldate"); urldate != "" {
+		accessed := "Accessed " + urldate
+		if note := db.fieldText(e, "note"); note != "" {
+			accessed = note + ". " + accessed
+		}
+		e.Fields["note"] = &Value{T: StringType, S: accessed}
+		delete(e.Fields, "urldate")
+	}
+}
+
+// appendSubtitle appends the subtitle field of e to the title field as
+// "Title: Subtitle".
+func (db *Database) appendSubtitle(e *Entry, subtitle, title string) {
+	sub := db.fieldText(e, subtitle)
+	if sub == "" {
+		return
+	}
+	if t := db.fieldText(e, title); t != "" {
+		sub = t + ": " + sub
+	}
+	e.Fields[title] = &Value{T: StringType, S: sub}
+	delete(e.Fields, subtitle)
+}
+
+// dateQualifiers matches the uncertainty markers of an extended ISO 8601
+// date.
+var dateQualifiers = regexp.MustCompile(`[~?%]`)
+
+// dateToYear replaces the date field of e by year and month fields, reporting
+// the parts of the date (day, end of a range, uncertainty) that BibTeX can't
+// hold. Dates that aren't ISO 8601 are left alone.
+func (db *Database) dateToYear(e *Entry) {
+	date := db.fieldText(e, "date")
+	if date == "" {
+		return
+	}
+	if dateQualifiers.MatchString(date) {
+		db.addError(e, "date", fmt.Sprintf("date %q is marked uncertain or approximate, which BibTeX can't show", date))
+	}
+	parts := strings.SplitN(dateQualifiers.ReplaceAllString(date, ""), "/", 2)
+	m := isoDate.FindStringSubmatch(parts[0])
+	if m == nil {
+		db.addError(e, "date", fmt.Sprintf("date %q isn't an ISO 8601 date; left as date", date))
+		return
+	}
+	if len(parts) == 2 && strings.TrimSpace(parts[1]) != strings.TrimSpace(parts[0]) {
+		db.addError(e, "date", fmt.Sprintf("the end of the date range %q can't be written in BibTeX; dropped", date))
+	}
+	if m[3] != "" {
+		db.addError(e, "date", fmt.Sprintf("the day of date %q can't be written in BibTeX; dropped", date))
+	}
+
+	if y := db.fieldText(e, "year"); y != "" && y != m[1] {
+		db.addError(e, "year", fmt.Sprintf("both date and year are set; dropped year = %q", y))
+	}
+	year, _ := strconv.Atoi(m[1])
+	e.Fields["year"] = &Value{T: NumberType, I: year}
+	delete(e.Fields, "month")
+	if n, err := strconv.Atoi(m[2]); err == nil && 1 <= n && n <= 12 {
+		e.Fields["month"] = &Value{T: SymbolType, S: monthSymbols[n-1]}
+	}
+	delete(e.Fields, "date")
+}
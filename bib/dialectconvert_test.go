@@ -0,0 +1,97 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConvertToBibLaTeX(t *testing.T) {
+	db := NewParser(strings.NewReader(`@phdthesis{ph, title={T}, school={CMU}, year=2019, month=mar, address={Pittsburgh}}
+@techreport{tr, title={T}, institution={CMU}, year={2019}, month={Sept.}}
+@misc{web, title={Site}, howpublished={\url{https://x.org}}, year={n.d.}}
+@article{ar, title={T}, journal={J}, year=2020}
+`)).ParseBibTeX()
+	db.ConvertToDialect(BibLaTeXDialect)
+	tests := []struct {
+		key, kind string
+		fields    map[string]string
+	}{
+		{"ph", "thesis", map[string]string{"type": "phdthesis", "institution": "CMU", "location": "Pittsburgh", "date": "2019-03"}},
+		{"tr", "report", map[string]string{"type": "techreport", "date": "2019-09"}},
+		{"web", "online", map[string]string{"url": "https://x.org", "year": "n.d."}},
+		{"ar", "article", map[string]string{"journaltitle": "J", "date": "2020"}},
+	}
+	checkConverted(t, db, tests)
+	for _, tag := range []string{"school", "address", "journal", "month", "howpublished"} {
+		for _, e := range db.Pubs {
+			if _, ok := e.Fields[tag]; ok {
+				t.Errorf("%s: %s wasn't converted", e.Key, tag)
+			}
+		}
+	}
+	if len(db.Errors) != 1 || db.Errors[0].BadEntry.Key != "web" {
+		t.Errorf("expected only the year of web to be reported, got %d errors", len(db.Errors))
+	}
+}
+
+func TestConvertToBibTeX(t *testing.T) {
+	db := NewParser(strings.NewReader(`@thesis{ba, title={T}, subtitle={S}, institution={CMU}, date={2019-03-04/2019-05}, type={bathesis}}
+@thesis{ma, title={T}, institution={CMU}, date={2019}, type={mathesis}}
+@online{web, title={Site}, url={https://x.org}, urldate={2021-01-02}, date={2020~}}
+@online{web2, title={Site}, url={https://y.org}, howpublished={Online}, date={2020}}
+@software{sw, title={Tool}, date={2020}, version={1.2}}
+@report{rp, title={T}, institution={CMU}, date={2018-11}, type={techreport}, location={Here}}
+`)).ParseBibTeX()
+	db.ConvertToDialect(BibTeXDialect)
+	tests := []struct {
+		key, kind string
+		fields    map[string]string
+	}{
+		{"ba", "mastersthesis", map[string]string{"title": "T: S", "school": "CMU", "year": "2019", "month": "March", "type": "Bachelor's thesis"}},
+		{"ma", "mastersthesis", map[string]string{"school": "CMU", "year": "2019"}},
+		{"web", "misc", map[string]string{"howpublished": `\url{https://x.org}`, "note": "Accessed 2021-01-02", "year": "2020"}},
+		{"web2", "misc", map[string]string{"howpublished": "Online", "url": "https://y.org"}},
+		{"sw", "misc", map[string]string{"year": "2020"}},
+		{"rp", "techreport", map[string]string{"institution": "CMU", "address": "Here", "month": "November"}},
+	}
+	checkConverted(t, db, tests)
+	for _, e := range db.Pubs {
+		if _, ok := e.Fields["date"]; ok {
+			t.Errorf("%s: date wasn't converted", e.Key)
+		}
+	}
+	if _, ok := db.Pubs[1].Fields["type"]; ok {
+		t.Errorf("type mathesis wasn't dropped")
+	}
+	if _, ok := db.Pubs[2].Fields["url"]; ok {
+		t.Errorf("url wasn't moved to howpublished")
+	}
+
+	reported := make([]string, 0)
+	for _, err := range db.Errors {
+		reported = append(reported, err.BadEntry.Key+":"+err.Tag)
+	}
+	exp := "ba:date ba:date web:date sw: sw:"
+	if strings.Join(reported, " ") != exp {
+		t.Errorf("reported %v, expected %s", reported, exp)
+	}
+}
+
+func checkConverted(t *testing.T, db *Database, tests []struct {
+	key, kind string
+	fields    map[string]string
+}) {
+	t.Helper()
+	for i, tc := range tests {
+		e := db.Pubs[i]
+		if e.Key != tc.key || string(e.Kind) != tc.kind || e.EntryString != tc.kind {
+			t.Errorf("%s: converted to @%s (%s), expected @%s", tc.key, e.EntryString, e.Kind, tc.kind)
+		}
+		for tag, exp := range tc.fields {
+			if v := db.fieldText(e, tag); v != exp {
+				t.Errorf("%s: %s = %q, expected %q", tc.key, tag, v, exp)
+			}
+		}
+	}
+}
@@ -0,0 +1,290 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/*=====================================================================================
+ * Semantic diff between two databases
+ *====================================================================================*/
+
+// FieldChange records a field whose value differs between two matched entries.
+// Old is empty if the field was added, and New is empty if it was removed.
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+}
+
+// EntryDiff records an entry that was removed, added, or that appears in both
+// databases. MatchedBy says how a matched pair was found: "key", "key
+// (ignoring case)", the name of an identifier field (e.g. "doi"), or "title".
+type EntryDiff struct {
+	OldKey    string        `json:"old_key,omitempty"`
+	NewKey    string        `json:"new_key,omitempty"`
+	Title     string        `json:"title,omitempty"`
+	MatchedBy string        `json:"matched_by,omitempty"`
+	Changes   []FieldChange `json:"changes,omitempty"`
+}
+
+// Renamed returns true iff the entry is in both databases under different keys.
+func (ed *EntryDiff) Renamed() bool {
+	return ed.OldKey != "" && ed.NewKey != "" && ed.OldKey != ed.NewKey
+}
+
+// DatabaseDiff is the difference between two databases.
+type DatabaseDiff struct {
+	Removed []*EntryDiff `json:"removed"`
+	Added   []*EntryDiff `json:"added"`
+	Matched []*EntryDiff `json:"matched"`
+}
+
+// diffIdentifiers lists the fields that identify a publication, in the order
+// they are tried when matching entries with different keys.
+var diffIdentifiers = []string{"doi", "pmid", "pmc", "eprint", "isbn"}
+
+var (
+	diffSpaces = regexp.MustCompile(`\s+`)
+	diffDashes = regexp.MustCompile(`\s*-+\s*`)
+)
+
+// displayValue returns v as it would appear in a bib file, without the
+// delimiting {}.
+func displayValue(v *Value) string {
+	if v.T == NumberType {
+		return strconv.Itoa(v.I)
+	}
+	return v.S
+}
+
+// normalizedValue returns the value of the tag field of e in a normal form, so
+// that values that differ only in ways that don't change their meaning
+// (symbols vs. their definitions, {}, whitespace, the format of names, - vs.
+// -- in pages, abbreviated months, and the case and URL prefix of DOIs)
+// compare equal.
+func (db *Database) normalizedValue(e *Entry, tag string) string {
+	v := db.SymbolValue(e.Fields[tag], 10)
+	s := displayValue(v)
+	s = strings.TrimSpace(diffSpaces.ReplaceAllString(s, " "))
+
+	switch {
+	case db.dialect().isNameField(tag):
+		names := make([]string, 0)
+		for _, a := range parseNameList(s) {
+			names = append(names, a.String())
+		}
+		s = strings.Join(names, " and ")
+	case tag == "pages":
+		s = diffDashes.ReplaceAllString(s, "--")
+	case tag == "month":
+		s = normalizedMonth(s)
+	case tag == "doi":
+		s = strings.ToLower(s)
+		for _, prefix := range []string{"https://doi.org/", "http://doi.org/", "http://dx.doi.org/", "doi:"} {
+			s = strings.TrimPrefix(s, prefix)
+		}
+	}
+
+	bt, _ := ParseBraceTree(s)
+	return bt.FlattenForSorting()
+}
+
+// normalizedMonth returns the full name of the month if s is a month number,
+// abbreviation or name, and s otherwise.
+func normalizedMonth(s string) string {
+	ls := strings.ToLower(s)
+	if i, err := strconv.Atoi(ls); err == nil && 1 <= i && i <= 12 {
+		ls = monthSymbols[i-1]
+	}
+	if len(ls) >= 3 {
+		if full, ok := predefinedSymbols[ls[:3]]; ok {
+			if ls == ls[:3] || ls == "sept" || ls == strings.ToLower(full) {
+				return full
+			}
+		}
+	}
+	return s
+}
+
+// identifier returns a normalized identifier value for e, or "" if it has none.
+func (db *Database) identifier(e *Entry, tag string) string {
+	if _, ok := e.Fields[tag]; !ok {
+		return ""
+	}
+	return strings.ToLower(db.normalizedValue(e, tag))
+}
+
+// diffEntries returns the list of field changes between two matched entries.
+func diffEntries(oldDB, newDB *Database, e1, e2 *Entry) []FieldChange {
+	changes := make([]FieldChange, 0)
+	if !strings.EqualFold(e1.EntryString, e2.EntryString) {
+		changes = append(changes, FieldChange{
+			Field: "kind",
+			Old:   strings.ToLower(e1.EntryString),
+			New:   strings.ToLower(e2.EntryString),
+		})
+	}
+
+	tags := e1.Tags()
+	for _, tag := range e2.Tags() {
+		if _, ok := e1.Fields[tag]; !ok {
+			tags = append(tags, tag)
+		}
+	}
+	for _, tag := range tags {
+		v1, ok1 := e1.Fields[tag]
+		v2, ok2 := e2.Fields[tag]
+		switch {
+		case ok1 && !ok2:
+			changes = append(changes, FieldChange{Field: tag, Old: displayValue(v1)})
+		case !ok1 && ok2:
+			changes = append(changes, FieldChange{Field: tag, New: displayValue(v2)})
+		case oldDB.normalizedValue(e1, tag) != newDB.normalizedValue(e2, tag):
+			changes = append(changes, FieldChange{Field: tag, Old: displayValue(v1), New: displayValue(v2)})
+		}
+	}
+	return changes
+}
+
+// entryTitle returns the title of e without {}, for display.
+func entryTitle(e *Entry) string {
+	if v, ok := e.Fields["title"]; ok && v.T == StringType {
+		bt, _ := ParseBraceTree(v.S)
+		return bt.FlattenForSorting()
+	}
+	return ""
+}
+
+// Diff compares the entries of oldDB and newDB. Entries are matched first by
+// key, then by key ignoring case, then by identifiers (doi, pmid, pmc,
+// eprint, isbn), and finally by title (using the same title normalization as
+// FindDupsByTitle). Entries that can't be matched are reported as removed or
+// added. Symbols and preambles are not compared, but symbols are expanded
+// when comparing field values.
+func Diff(oldDB, newDB *Database) *DatabaseDiff {
+	matchedNew := make(map[*Entry]*Entry)
+	matchedOld := make(map[*Entry]*Entry)
+	how := make(map[*Entry]string)
+
+	// match runs one round of matching, pairing each unmatched old entry with
+	// the first unmatched new entry that has the same (non-empty) hash.
+	match := func(name string, oldHash, newHash func(*Entry) string) {
+		byHash := make(map[string][]*Entry)
+		for _, e := range newDB.Pubs {
+			if _, ok := matchedNew[e]; !ok {
+				if h := newHash(e); h != "" {
+					byHash[h] = append(byHash[h], e)
+				}
+			}
+		}
+		for _, e := range oldDB.Pubs {
+			if _, ok := matchedOld[e]; ok {
+				continue
+			}
+			h := oldHash(e)
+			if h == "" || len(byHash[h]) == 0 {
+				continue
+			}
+			n := byHash[h][0]
+			byHash[h] = byHash[h][1:]
+			matchedOld[e] = n
+			matchedNew[n] = e
+			how[n] = name
+		}
+	}
+
+	match("key", func(e *Entry) string { return e.Key }, func(e *Entry) string { return e.Key })
+	match("key (ignoring case)",
+		func(e *Entry) string { return strings.ToLower(e.Key) },
+		func(e *Entry) string { return strings.ToLower(e.Key) })
+	for _, id := range diffIdentifiers {
+		tag := id
+		match(tag,
+			func(e *Entry) string { return oldDB.identifier(e, tag) },
+			func(e *Entry) string { return newDB.identifier(e, tag) })
+	}
+	match("title", titleHash, titleHash)
+
+	d := &DatabaseDiff{
+		Removed: make([]*EntryDiff, 0),
+		Added:   make([]*EntryDiff, 0),
+		Matched: make([]*EntryDiff, 0),
+	}
+	for _, e := range oldDB.Pubs {
+		if _, ok := matchedOld[e]; !ok {
+			d.Removed = append(d.Removed, &EntryDiff{OldKey: e.Key, Title: entryTitle(e)})
+		}
+	}
+	for _, e := range newDB.Pubs {
+		o, ok := matchedNew[e]
+		if !ok {
+			d.Added = append(d.Added, &EntryDiff{NewKey: e.Key, Title: entryTitle(e)})
+			continue
+		}
+		d.Matched = append(d.Matched, &EntryDiff{
+			OldKey:    o.Key,
+			NewKey:    e.Key,
+			Title:     entryTitle(e),
+			MatchedBy: how[e],
+			Changes:   diffEntries(oldDB, newDB, o, e),
+		})
+	}
+	return d
+}
+
+// IsEmpty returns true iff the two databases have the same entries.
+func (d *DatabaseDiff) IsEmpty() bool {
+	if len(d.Removed) > 0 || len(d.Added) > 0 {
+		return false
+	}
+	for _, m := range d.Matched {
+		if m.Renamed() || len(m.Changes) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Write writes a human-readable form of the diff to w. Matched entries that
+// are unchanged are not listed.
+func (d *DatabaseDiff) Write(w io.Writer) {
+	for _, ed := range d.Removed {
+		fmt.Fprintf(w, "Removed %q: %q\n", ed.OldKey, ed.Title)
+	}
+	for _, ed := range d.Added {
+		fmt.Fprintf(w, "Added %q: %q\n", ed.NewKey, ed.Title)
+	}
+	for _, ed := range d.Matched {
+		if !ed.Renamed() && len(ed.Changes) == 0 {
+			continue
+		}
+		if ed.Renamed() {
+			fmt.Fprintf(w, "Renamed %q to %q (matched by %s)\n", ed.OldKey, ed.NewKey, ed.MatchedBy)
+		} else {
+			fmt.Fprintf(w, "Changed %q\n", ed.NewKey)
+		}
+		for _, c := range ed.Changes {
+			switch {
+			case c.Old == "":
+				fmt.Fprintf(w, "  %s: added %q\n", c.Field, c.New)
+			case c.New == "":
+				fmt.Fprintf(w, "  %s: removed %q\n", c.Field, c.Old)
+			default:
+				fmt.Fprintf(w, "  %s: %q -> %q\n", c.Field, c.Old, c.New)
+			}
+		}
+	}
+}
+
+// WriteJSON writes the diff to w as JSON.
+func (d *DatabaseDiff) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d)
+}
@@ -0,0 +1,51 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	const oldBib = `@string{nbt={Nature Biotechnology}}
+@article{a1, author={Carl Kingsford}, title={{Fast}}, journal=nbt, pages={1-5}, month={Jan}}
+@article{a2, title={Old title}, doi={10.1/abc}}
+@article{a3, title={The Gone Paper}}
+@misc{a4, title={Same Title Here}}
+`
+	const newBib = `@article{a1, author={Kingsford, Carl}, title={Fast}, journal={Nature Biotechnology}, pages={1--5}, month=jan}
+@article{smith10, title={New title}, doi={https://doi.org/10.1/ABC}}
+@article{b1, title={Brand new}}
+@misc{same, title={Same title: here}}
+`
+	oldDB := NewParser(strings.NewReader(oldBib)).ParseBibTeX()
+	newDB := NewParser(strings.NewReader(newBib)).ParseBibTeX()
+	d := Diff(oldDB, newDB)
+
+	if len(d.Removed) != 1 || d.Removed[0].OldKey != "a3" {
+		t.Errorf("removed = %v, expected a3", d.Removed)
+	}
+	if len(d.Added) != 1 || d.Added[0].NewKey != "b1" {
+		t.Errorf("added = %v, expected b1", d.Added)
+	}
+
+	matched := make(map[string]*EntryDiff)
+	for _, m := range d.Matched {
+		matched[m.OldKey] = m
+	}
+	if m := matched["a1"]; m == nil || len(m.Changes) != 0 {
+		t.Errorf("a1 should match with no changes: %v", m)
+	}
+	if m := matched["a2"]; m == nil || m.NewKey != "smith10" || m.MatchedBy != "doi" || len(m.Changes) != 1 {
+		t.Errorf("a2 should be renamed to smith10 with a title change: %v", m)
+	}
+	if m := matched["a4"]; m == nil || m.NewKey != "same" || m.MatchedBy != "title" {
+		t.Errorf("a4 should be matched by title: %v", m)
+	}
+	if d.IsEmpty() {
+		t.Errorf("diff should not be empty")
+	}
+	if !Diff(oldDB, oldDB).IsEmpty() {
+		t.Errorf("diff with self should be empty")
+	}
+}
@@ -0,0 +1,300 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+/*=====================================================================================
+ * EndNote XML import
+ *
+ * EndNote exports a <xml><records> document with one <record> per reference.
+ * Text is usually wrapped in <style> elements, which are ignored.
+ *====================================================================================*/
+
+// endnoteTypes maps EndNote reference type names to entry kinds.
+var endnoteTypes = map[string]EntryKind{
+	"journal article":         Article,
+	"magazine article":        Article,
+	"newspaper article":       Article,
+	"electronic article":      Article,
+	"book":                    Book,
+	"edited book":             Book,
+	"electronic book":         Book,
+	"book section":            InCollection,
+	"electronic book section": InCollection,
+	"conference paper":        InProceedings,
+	"conference proceedings":  InProceedings,
+	"thesis":                  PhdThesis,
+	"report":                  TechReport,
+	"government document":     TechReport,
+	"unpublished work":        Unpublished,
+	"manuscript":              Unpublished,
+	"pamphlet":                Booklet,
+	"generic":                 Misc,
+	"web page":                Misc,
+	"computer program":        Misc,
+	"dataset":                 Misc,
+	"standard":                Manual,
+}
+
+// endnoteTypeNumbers maps the numbers EndNote uses for reference types to
+// entry kinds, for records whose <ref-type> has no name.
+var endnoteTypeNumbers = map[int]EntryKind{
+	5:  InCollection,
+	6:  Book,
+	10: InProceedings,
+	13: Misc,
+	17: Article,
+	27: TechReport,
+	28: Book,
+	32: PhdThesis,
+	34: Unpublished,
+	47: InProceedings,
+}
+
+// endnoteFields maps EndNote elements that hold a single value to fields.
+var endnoteFields = map[string]string{
+	"volume":                  "volume",
+	"number":                  "number",
+	"edition":                 "edition",
+	"section":                 "chapter",
+	"pub-location":            "address",
+	"electronic-resource-num": "doi",
+	"abstract":                "abstract",
+	"notes":                   "note",
+	"language":                "language",
+	"label":                   "key",
+}
+
+// endnoteIgnored lists the EndNote elements that describe the EndNote
+// library rather than the reference, and so are dropped without a warning.
+var endnoteIgnored = map[string]bool{
+	"database":                 true,
+	"source-app":               true,
+	"rec-number":               true,
+	"foreign-keys":             true,
+	"ref-type":                 true,
+	"work-type":                true,
+	"remote-database-name":     true,
+	"remote-database-provider": true,
+	"access-date":              true,
+	"research-notes":           true,
+}
+
+// endnoteName converts an EndNote name ("Last, First" or "Last, First, Jr.")
+// into an author. EndNote marks corporate names with a trailing comma.
+func endnoteName(s string) *Author {
+	s = strings.TrimSpace(s)
+	if strings.HasSuffix(s, ",") {
+		return &Author{Last: "{" + escapeLaTeX(strings.TrimSpace(strings.TrimSuffix(s, ","))) + "}"}
+	}
+	parts := splitOnTopLevelString(escapeLaTeX(s), ",", false)
+	if len(parts) == 1 {
+		// without a comma, the name is parsed as BibTeX would
+		return NormalizeName(parts[0])
+	}
+	for i, p := range parts {
+		parts[i] = strings.TrimSpace(p)
+	}
+	a := &Author{First: parts[1]}
+	if parts[0] != "" {
+		a.Von, a.Last = parseVon(splitOnTopLevel(parts[0]))
+	}
+	// EndNote puts suffixes last, while BibTeX puts them second
+	a.Jr = strings.Join(parts[2:], " ")
+	if a.Last == "" && a.First == "" {
+		return nil
+	}
+	return a
+}
+
+// monthSymbol returns the predefined symbol for a month given as a number,
+// abbreviation or name, or "" if s isn't a month.
+func monthSymbol(s string) string {
+	full := normalizedMonth(strings.TrimSuffix(strings.TrimSpace(s), "."))
+	for _, sym := range monthSymbols {
+		if predefinedSymbols[sym] == full {
+			return sym
+		}
+	}
+	return ""
+}
+
+// nameListValue joins authors into a BibTeX name list.
+func nameListValue(authors []*Author) *Value {
+	strs := make([]string, 0, len(authors))
+	for _, a := range authors {
+		strs = append(strs, a.String())
+	}
+	return &Value{T: StringType, S: strings.Join(strs, " and ")}
+}
+
+// endnoteKind returns the entry kind of an EndNote record.
+func endnoteKind(rec *xmlNode) EntryKind {
+	rt := rec.child("ref-type")
+	kind, ok := endnoteTypes[strings.ToLower(rt.attr("name"))]
+	if !ok {
+		n, _ := strconv.Atoi(rt.text())
+		if kind, ok = endnoteTypeNumbers[n]; !ok {
+			kind = Misc
+		}
+	}
+	if kind == PhdThesis {
+		wt := strings.ToLower(rec.child("work-type").text())
+		if strings.Contains(wt, "master") || strings.Contains(wt, "m.s") {
+			kind = MastersThesis
+		}
+	}
+	return kind
+}
+
+// endnoteEntry converts an EndNote record into an entry. Elements that have no
+// BibTeX field are reported as errors in db.
+func (db *Database) endnoteEntry(rec *xmlNode) *Entry {
+	e := newEntry()
+	e.Kind = endnoteKind(rec)
+	e.EntryString = string(e.Kind)
+
+	set := func(tag, value string) {
+		if value != "" {
+			if _, ok := e.Fields[tag]; !ok {
+				e.Fields[tag] = cslValue(tag, value)
+			}
+		}
+	}
+	warn := func(name string) {
+		db.addError(e, "", fmt.Sprintf("EndNote element <%s> has no BibTeX field; dropped", name))
+	}
+
+	for _, c := range rec.Children {
+		if c.text() == "" || endnoteIgnored[c.Name] {
+			continue
+		}
+		switch c.Name {
+		case "contributors":
+			for _, group := range c.Children {
+				authors := make([]*Author, 0)
+				for _, n := range group.all("author") {
+					if a := endnoteName(n.text()); a != nil {
+						authors = append(authors, a)
+					}
+				}
+				var tag string
+				switch group.Name {
+				case "authors":
+					tag = "author"
+					e.AuthorList = authors
+				case "secondary-authors":
+					tag = "editor"
+				default:
+					warn("contributors/" + group.Name)
+					continue
+				}
+				if len(authors) > 0 {
+					e.Fields[tag] = nameListValue(authors)
+				}
+			}
+		case "titles":
+			for _, t := range c.Children {
+				switch t.Name {
+				case "title":
+					set("title", t.text())
+				case "secondary-title":
+					if e.Kind == Article {
+						set("journal", t.text())
+					} else {
+						set("booktitle", t.text())
+					}
+				case "tertiary-title":
+					set("series", t.text())
+				default:
+					warn("titles/" + t.Name)
+				}
+			}
+		case "periodical":
+			if e.Kind == Article {
+				set("journal", c.child("full-title").text())
+			} else {
+				warn(c.Name)
+			}
+		case "dates":
+			set("year", c.child("year").text())
+			if d := strings.Fields(c.path("pub-dates", "date").text()); len(d) > 0 {
+				if sym := monthSymbol(d[0]); sym != "" {
+					e.Fields["month"] = &Value{T: SymbolType, S: sym}
+				}
+			}
+		case "keywords":
+			kws := make([]string, 0)
+			for _, k := range c.all("keyword") {
+				kws = append(kws, k.text())
+			}
+			set("keywords", strings.Join(kws, ", "))
+		case "urls":
+			for _, group := range c.Children {
+				for i, u := range group.all("url") {
+					if group.Name == "related-urls" && i == 0 {
+						set("url", u.text())
+					} else {
+						warn("urls/" + group.Name + "/url")
+					}
+				}
+			}
+		case "isbn":
+			if e.Kind == Article {
+				set("issn", c.text())
+			} else {
+				set("isbn", c.text())
+			}
+		case "publisher":
+			set(publisherField(e.Kind), c.text())
+		case "pages":
+			set("pages", diffDashes.ReplaceAllString(c.text(), "--"))
+		default:
+			if tag, ok := endnoteFields[c.Name]; ok {
+				if tag == "key" {
+					e.Key = c.text()
+				} else {
+					set(tag, c.text())
+				}
+			} else {
+				warn(c.Name)
+			}
+		}
+	}
+	return e
+}
+
+// readEndNoteTree converts an EndNote XML document into a database.
+func readEndNoteTree(root *xmlNode) *Database {
+	db := NewDatabase()
+	records := root.all("record")
+	if root.Name == "xml" {
+		records = root.child("records").all("record")
+	}
+	for _, rec := range records {
+		db.Pubs = append(db.Pubs, db.endnoteEntry(rec))
+	}
+	db.assignMissingKeys()
+	return db
+}
+
+// ReadEndNoteXML reads an EndNote XML export and returns a database with an
+// entry for each record. Text is escaped for LaTeX but is otherwise left as
+// Unicode. The <label> element gives the key; records without one get a key
+// made from the first author and year. Elements that have no BibTeX
+// equivalent are reported in the database's errors.
+func ReadEndNoteXML(r io.Reader) (*Database, error) {
+	root, err := parseXMLTree(r)
+	if err != nil {
+		return nil, err
+	}
+	if root.Name != "xml" && root.Name != "records" {
+		return nil, fmt.Errorf("not an EndNote XML document: root element is <%s>", root.Name)
+	}
+	return readEndNoteTree(root), nil
+}
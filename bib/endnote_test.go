@@ -0,0 +1,83 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadEndNoteXML(t *testing.T) {
+	const in = `<?xml version="1.0" encoding="UTF-8"?>
+<xml><records>
+<record><database name="My.enl">My.enl</database><rec-number>1</rec-number>
+<ref-type name="Journal Article">17</ref-type>
+<contributors><authors>
+  <author><style face="normal" font="default" size="100%">Smith, John A.</style></author>
+  <author>World Health Organization,</author>
+  <author>van Gogh, Vincent, Jr.</author>
+</authors></contributors>
+<titles><title><style face="normal">The </style><style face="italic">E. coli</style><style face="normal"> genome &amp; 50% more</style></title>
+<secondary-title>Nature</secondary-title><alt-title>Nat.</alt-title></titles>
+<urls><related-urls><url>http://a.org</url><url>http://b.org</url></related-urls></urls>
+<pages>100-110</pages><volume>5</volume>
+<dates><year>2018</year><pub-dates><date>Mar 3</date></pub-dates></dates>
+<electronic-resource-num>10.1038/x_y</electronic-resource-num>
+<custom1>foo</custom1>
+</record>
+<record><ref-type>32</ref-type><work-type>Masters thesis</work-type>
+<contributors><authors><author>Doe, Jane</author></authors></contributors>
+<titles><title>A thesis</title></titles><periodical><full-title>J</full-title></periodical><dates><year>2020</year></dates>
+<publisher>CMU</publisher><label>doe20</label></record>
+</records></xml>`
+
+	db, err := ReadEndNoteXML(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(db.Pubs) != 2 {
+		t.Fatalf("got %d entries, expected 2", len(db.Pubs))
+	}
+
+	e := db.Pubs[0]
+	if e.Key != "smith2018" || e.Kind != Article {
+		t.Errorf("key, kind = %q, %q", e.Key, e.Kind)
+	}
+	expected := map[string]string{
+		"author":  `Smith, John A. and {World Health Organization} and van Gogh, Jr., Vincent`,
+		"title":   `The E. coli genome \& 50\% more`,
+		"journal": "Nature",
+		"pages":   "100--110",
+		"month":   "mar",
+		"doi":     "10.1038/x_y",
+		"url":     "http://a.org",
+	}
+	for tag, s := range expected {
+		if v, ok := e.Fields[tag]; !ok || v.S != s {
+			t.Errorf("%s = %v, expected %q", tag, v, s)
+		}
+	}
+	if e.Fields["year"].I != 2018 || e.Fields["volume"].I != 5 {
+		t.Errorf("year, volume = %v, %v", e.Fields["year"], e.Fields["volume"])
+	}
+	if a := e.AuthorList[2]; a.Von != "van" || a.Last != "Gogh" || a.First != "Vincent" || a.Jr != "Jr." {
+		t.Errorf("third author = %+v", a)
+	}
+	dropped := []string{"titles/alt-title", "urls/related-urls/url", "custom1", "periodical"}
+	if len(db.Errors) != len(dropped) {
+		t.Fatalf("expected %d errors, got %v", len(dropped), db.Errors)
+	}
+	for i, name := range dropped {
+		if !strings.Contains(db.Errors[i].Msg, "<"+name+">") {
+			t.Errorf("error %d = %q, expected one for <%s>", i, db.Errors[i].Msg, name)
+		}
+	}
+
+	e = db.Pubs[1]
+	if e.Key != "doe20" || e.Kind != MastersThesis || e.Fields["school"] == nil {
+		t.Errorf("thesis = %q, %q, %v", e.Key, e.Kind, e.Fields)
+	}
+
+	if _, err := ReadEndNoteXML(strings.NewReader("<mods/>")); err == nil {
+		t.Errorf("expected an error for a non-EndNote document")
+	}
+}
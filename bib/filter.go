@@ -0,0 +1,428 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*=====================================================================================
+ * Entry filtering
+ *
+ * A filter is a boolean expression over the entries of a database, e.g.:
+ *
+ *    kind==article && year>=2015 && author~"Kingsford"
+ *
+ * The grammar is:
+ *
+ *    expr       := and ("||" and)*
+ *    and        := unary ("&&" unary)*
+ *    unary      := "!" unary | "(" expr ")" | comparison
+ *    comparison := NAME [OP LITERAL]
+ *    OP         := "==" | "!=" | "<" | "<=" | ">" | ">=" | "~" | "!~"
+ *    LITERAL    := NUMBER | "quoted string" | NAME
+ *
+ * A NAME on its own is true iff the entry has that field.
+ *====================================================================================*/
+
+// Filter is a compiled filter expression that can be tested against entries.
+type Filter struct {
+	root filterNode
+	expr string
+}
+
+// filterNode is a node in the parse tree of a filter expression.
+type filterNode interface {
+	eval(db *Database, e *Entry) bool
+}
+
+type orNode struct{ left, right filterNode }
+type andNode struct{ left, right filterNode }
+type notNode struct{ child filterNode }
+type existsNode struct{ name string }
+
+// cmpNode compares the value(s) of name with the literal using op.
+type cmpNode struct {
+	name  string
+	op    string
+	lit   string
+	num   int
+	isNum bool
+	re    *regexp.Regexp
+}
+
+func (n *orNode) eval(db *Database, e *Entry) bool {
+	return n.left.eval(db, e) || n.right.eval(db, e)
+}
+
+func (n *andNode) eval(db *Database, e *Entry) bool {
+	return n.left.eval(db, e) && n.right.eval(db, e)
+}
+
+func (n *notNode) eval(db *Database, e *Entry) bool {
+	return !n.child.eval(db, e)
+}
+
+func (n *existsNode) eval(db *Database, e *Entry) bool {
+	_, ok := db.filterValues(e, n.name)
+	return ok
+}
+
+func (n *cmpNode) eval(db *Database, e *Entry) bool {
+	// != and !~ are true iff no value matches
+	switch n.op {
+	case "!=":
+		return !(&cmpNode{name: n.name, op: "==", lit: n.lit, num: n.num, isNum: n.isNum}).eval(db, e)
+	case "!~":
+		return !(&cmpNode{name: n.name, op: "~", re: n.re}).eval(db, e)
+	}
+
+	values, ok := db.filterValues(e, n.name)
+	if !ok {
+		return false
+	}
+	for _, v := range values {
+		if n.match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// match returns true iff the single value v satisfies the comparison.
+// Values are compared as integers if both sides are integers, and as
+// case-insensitive strings otherwise.
+func (n *cmpNode) match(v string) bool {
+	if n.op == "~" {
+		return n.re.MatchString(v)
+	}
+	c := 0
+	if i, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n.isNum {
+		switch {
+		case i < n.num:
+			c = -1
+		case i > n.num:
+			c = 1
+		}
+	} else {
+		c = strings.Compare(strings.ToLower(v), strings.ToLower(n.lit))
+	}
+	switch n.op {
+	case "==":
+		return c == 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+// filterValues returns the strings that name refers to for entry e. The names
+// "kind" and "key" refer to the entry type and key (unless the entry has a
+// field with that name), the dialect's name-list fields (author, editor, ...)
+// give one value per parsed name (both the full name and the last name), and
+// any other name gives the value of that field with symbols expanded and {}
+// removed. The second return value is false if the entry has no such field.
+func (db *Database) filterValues(e *Entry, name string) ([]string, bool) {
+	name = strings.ToLower(name)
+	v, ok := e.Fields[name]
+	switch {
+	case name == "kind" && !ok:
+		return []string{strings.ToLower(e.EntryString)}, true
+	case name == "key" && !ok:
+		return []string{e.Key}, true
+	case !ok:
+		return nil, false
+	}
+
+	v = db.SymbolValue(v, 10)
+	if v.T == NumberType {
+		return []string{strconv.Itoa(v.I)}, true
+	}
+
+	if db.dialect().isNameField(name) {
+		values := make([]string, 0)
+		for _, a := range parseNameList(v.S) {
+			if a.Others {
+				continue
+			}
+			values = append(values, flattenForFilter(a.String()), flattenForFilter(a.Last))
+		}
+		return values, true
+	}
+	return []string{flattenForFilter(v.S)}, true
+}
+
+// flattenForFilter removes the {} from s.
+func flattenForFilter(s string) string {
+	bn, _ := ParseBraceTree(s)
+	return bn.FlattenForSorting()
+}
+
+/*-------------------------------------------------------------------------------------
+ * Filter parsing
+ *------------------------------------------------------------------------------------*/
+
+// filterToken is a token in a filter expression. kind is one of "name",
+// "number", "string", "op", or "" for the end of the expression.
+type filterToken struct {
+	kind string
+	text string
+	pos  int
+}
+
+// filterOps lists the operators, longest first so they match greedily.
+var filterOps = []string{"&&", "||", "==", "!=", "<=", ">=", "!~", "<", ">", "~", "!", "(", ")"}
+
+// isFilterNameRune returns true iff r can appear in a field name.
+func isFilterNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '.'
+}
+
+// tokenizeFilter splits a filter expression into tokens.
+func tokenizeFilter(s string) ([]filterToken, error) {
+	toks := make([]filterToken, 0)
+	i := 0
+outer:
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r == '"':
+			start := i
+			i += size
+			var lit strings.Builder
+			for i < len(s) && s[i] != '"' {
+				if s[i] == '\\' && i+1 < len(s) && s[i+1] == '"' {
+					i++
+				}
+				lit.WriteByte(s[i])
+				i++
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("unterminated string at position %d", start)
+			}
+			i++
+			toks = append(toks, filterToken{"string", lit.String(), start})
+		case isFilterNameRune(r):
+			start := i
+			for i < len(s) {
+				r, size = utf8.DecodeRuneInString(s[i:])
+				if !isFilterNameRune(r) {
+					break
+				}
+				i += size
+			}
+			kind := "name"
+			if _, err := strconv.Atoi(s[start:i]); err == nil {
+				kind = "number"
+			}
+			toks = append(toks, filterToken{kind, s[start:i], start})
+		default:
+			for _, op := range filterOps {
+				if strings.HasPrefix(s[i:], op) {
+					toks = append(toks, filterToken{"op", op, i})
+					i += len(op)
+					continue outer
+				}
+			}
+			return nil, fmt.Errorf("unexpected %q at position %d", r, i)
+		}
+	}
+	toks = append(toks, filterToken{"", "", len(s)})
+	return toks, nil
+}
+
+// filterParser is a recursive descent parser for filter expressions.
+type filterParser struct {
+	toks []filterToken
+	cur  int
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.toks[p.cur]
+}
+
+func (p *filterParser) next() filterToken {
+	t := p.toks[p.cur]
+	if t.kind != "" {
+		p.cur++
+	}
+	return t
+}
+
+// peekOp returns true iff the next token is the operator op.
+func (p *filterParser) peekOp(op string) bool {
+	t := p.peek()
+	return t.kind == "op" && t.text == op
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekOp("||") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekOp("&&") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	switch {
+	case p.peekOp("!"):
+		p.next()
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{child}, nil
+	case p.peekOp("("):
+		p.next()
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.peekOp(")") {
+			return nil, fmt.Errorf("expected ) at position %d", p.peek().pos)
+		}
+		p.next()
+		return n, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (filterNode, error) {
+	name := p.next()
+	if name.kind != "name" {
+		return nil, fmt.Errorf("expected field name at position %d", name.pos)
+	}
+
+	op := p.peek()
+	if op.kind != "op" {
+		return &existsNode{name.text}, nil
+	}
+	switch op.text {
+	case "==", "!=", "<", "<=", ">", ">=", "~", "!~":
+	default:
+		return &existsNode{name.text}, nil
+	}
+	p.next()
+
+	lit := p.next()
+	if lit.kind != "name" && lit.kind != "number" && lit.kind != "string" {
+		return nil, fmt.Errorf("expected value after %s at position %d", op.text, lit.pos)
+	}
+
+	n := &cmpNode{name: name.text, op: op.text, lit: lit.text}
+	if i, err := strconv.Atoi(lit.text); err == nil {
+		n.num = i
+		n.isNum = true
+	}
+	if op.text == "~" || op.text == "!~" {
+		re, err := regexp.Compile("(?i)" + lit.text)
+		if err != nil {
+			return nil, fmt.Errorf("bad regular expression %q: %v", lit.text, err)
+		}
+		n.re = re
+	}
+	return n, nil
+}
+
+// ParseFilter compiles a filter expression.
+func ParseFilter(expr string) (*Filter, error) {
+	toks, err := tokenizeFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{toks: toks}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != "" {
+		return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+	}
+	return &Filter{root: root, expr: expr}, nil
+}
+
+// String returns the expression the filter was compiled from.
+func (f *Filter) String() string {
+	return f.expr
+}
+
+// Match returns true iff the entry e in db satisfies the filter.
+func (f *Filter) Match(db *Database, e *Entry) bool {
+	return f.root.eval(db, e)
+}
+
+// Filter returns a new database containing the entries that match f, along
+// with the preamble and the symbols those entries use (directly or through
+// other symbols). Entries are shared with db, not copied.
+func (db *Database) Filter(f *Filter) *Database {
+	out := NewDatabase()
+	out.Preamble = append(out.Preamble, db.Preamble...)
+
+	for _, e := range db.Pubs {
+		if f.Match(db, e) {
+			out.Pubs = append(out.Pubs, e)
+		}
+	}
+
+	// copy over the symbols used by the matching entries
+	todo := make([]string, 0)
+	for _, e := range out.Pubs {
+		for _, tag := range e.Tags() {
+			if v := e.Fields[tag]; v.T == SymbolType {
+				todo = append(todo, strings.ToLower(v.S))
+			}
+		}
+	}
+	sort.Strings(todo)
+	for len(todo) > 0 {
+		sym := todo[0]
+		todo = todo[1:]
+		if _, ok := out.Symbols[sym]; ok {
+			continue
+		}
+		if v, ok := db.Symbols[sym]; ok {
+			out.Symbols[sym] = v
+			if v.T == SymbolType {
+				todo = append(todo, strings.ToLower(v.S))
+			}
+		}
+	}
+	return out
+}
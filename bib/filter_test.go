@@ -0,0 +1,48 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	const in = `@string{bioinf = {Bioinformatics}}
+@article{a1, author={Carl Kingsford and Guillaume Marcais}, journal=bioinf, year=2016}
+@article{a2, author={Kingsford, Carl}, journal=bioinf, year=2010}
+@inproceedings{p1, author={Carl Kingsford}, booktitle={RECOMB}, year={2018}}
+@article{a3, author={Smith, J}, journal={Other}, year=2019}
+`
+	db := NewParser(strings.NewReader(in)).ParseBibTeX()
+
+	tests := []struct {
+		expr string
+		keys string
+	}{
+		{`kind==article && year>=2015 && author~"kingsford"`, "a1"},
+		{`journal == "bioinformatics"`, "a1,a2"},
+		{`author == Smith || booktitle`, "p1,a3"},
+		{`!(year < 2016) && kind != inproceedings`, "a1,a3"},
+		{`key ~ "^a[12]$"`, "a1,a2"},
+	}
+	for _, tt := range tests {
+		f, err := ParseFilter(tt.expr)
+		if err != nil {
+			t.Errorf("ParseFilter(%q): %v", tt.expr, err)
+			continue
+		}
+		keys := make([]string, 0)
+		for _, e := range db.Filter(f).Pubs {
+			keys = append(keys, e.Key)
+		}
+		if strings.Join(keys, ",") != tt.keys {
+			t.Errorf("%q matched %v, expected %s", tt.expr, keys, tt.keys)
+		}
+	}
+
+	for _, bad := range []string{"year >=", "(kind==article", "year = 2", `title ~ "("`} {
+		if _, err := ParseFilter(bad); err == nil {
+			t.Errorf("ParseFilter(%q) succeeded, expected error", bad)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/*=====================================================================================
+ * Registry of file formats
+ *====================================================================================*/
+
+// Reader reads a database from a file in some format.
+type Reader interface {
+	Read(r io.Reader) (*Database, error)
+}
+
+// Writer writes a database to a file in some format.
+type Writer interface {
+	Write(w io.Writer, db *Database) error
+}
+
+// LoggingReader is a Reader that recovers from some errors in its input,
+// like BibTeX syntax errors, and can write them to a log as it reads.
+type LoggingReader interface {
+	Reader
+	ReadLogged(r io.Reader, log io.Writer) (*Database, error)
+}
+
+// ReaderFunc adapts a function to a Reader.
+type ReaderFunc func(r io.Reader) (*Database, error)
+
+// Read calls f(r).
+func (f ReaderFunc) Read(r io.Reader) (*Database, error) {
+	return f(r)
+}
+
+// WriterFunc adapts a function to a Writer.
+type WriterFunc func(w io.Writer, db *Database) error
+
+// Write calls f(w, db).
+func (f WriterFunc) Write(w io.Writer, db *Database) error {
+	return f(w, db)
+}
+
+// Format describes a file format. Reader or Writer is nil if the format
+// can't be read or written. Extensions include the leading ".".
+type Format struct {
+	Name        string
+	Aliases     []string
+	Extensions  []string
+	Description string
+	Reader      Reader
+	Writer      Writer
+}
+
+// Read reads a database with the format's reader. If log is not nil and the
+// reader is a LoggingReader, the errors it recovers from are written to log.
+func (f *Format) Read(r io.Reader, log io.Writer) (*Database, error) {
+	if f.Reader == nil {
+		return nil, fmt.Errorf("format %q can't be read", f.Name)
+	}
+	if lr, ok := f.Reader.(LoggingReader); ok && log != nil {
+		return lr.ReadLogged(r, log)
+	}
+	return f.Reader.Read(r)
+}
+
+// BibTeXReader reads BibTeX files. If ErrorLog is not nil, syntax errors are
+// written to it; the entries that could be parsed are returned either way.
+type BibTeXReader struct {
+	ErrorLog io.Writer
+}
+
+// Read parses a BibTeX file.
+func (br *BibTeXReader) Read(r io.Reader) (*Database, error) {
+	return br.ReadLogged(r, br.ErrorLog)
+}
+
+// ReadLogged parses a BibTeX file, writing syntax errors to log if it isn't
+// nil.
+func (br *BibTeXReader) ReadLogged(r io.Reader, log io.Writer) (*Database, error) {
+	p := NewParser(r)
+	db := p.ParseBibTeX()
+	if p.NErrors() > 0 && log != nil {
+		p.PrintErrors(log)
+	}
+	return db, nil
+}
+
+var (
+	formatsByName = make(map[string]*Format)
+	formatsByExt  = make(map[string]*Format)
+)
+
+// RegisterFormat adds a format to the registry, replacing any format with the
+// same name, alias or extension.
+func RegisterFormat(f *Format) {
+	for _, name := range append([]string{f.Name}, f.Aliases...) {
+		formatsByName[strings.ToLower(name)] = f
+	}
+	for _, ext := range f.Extensions {
+		formatsByExt[strings.ToLower(ext)] = f
+	}
+}
+
+// LookupFormat returns the format with the given name or alias, ignoring case.
+func LookupFormat(name string) (*Format, bool) {
+	f, ok := formatsByName[strings.ToLower(strings.TrimSpace(name))]
+	return f, ok
+}
+
+// FormatForFile returns the format of the file named fn, chosen by its
+// extension.
+func FormatForFile(fn string) (*Format, bool) {
+	f, ok := formatsByExt[strings.ToLower(filepath.Ext(fn))]
+	return f, ok
+}
+
+// Formats returns the registered formats, sorted by name.
+func Formats() []*Format {
+	seen := make(map[*Format]bool)
+	list := make([]*Format, 0)
+	for _, f := range formatsByName {
+		if !seen[f] {
+			seen[f] = true
+			list = append(list, f)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// FormatNames returns the names of the registered formats that can be read
+// (if read is true) or written (otherwise), joined with ", ".
+func FormatNames(read bool) string {
+	names := make([]string, 0)
+	for _, f := range Formats() {
+		if (read && f.Reader != nil) || (!read && f.Writer != nil) {
+			names = append(names, f.Name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// ReadFormat reads a database in the named format.
+func ReadFormat(name string, r io.Reader) (*Database, error) {
+	f, ok := LookupFormat(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q", name)
+	}
+	return f.Read(r, nil)
+}
+
+// WriteFormat writes a database in the named format.
+func WriteFormat(name string, w io.Writer, db *Database) error {
+	f, ok := LookupFormat(name)
+	if !ok {
+		return fmt.Errorf("unknown format %q", name)
+	}
+	if f.Writer == nil {
+		return fmt.Errorf("format %q can't be written", f.Name)
+	}
+	return f.Writer.Write(w, db)
+}
+
+func init() {
+	RegisterFormat(&Format{
+		Name:        "bibtex",
+		Aliases:     []string{"bib"},
+		Extensions:  []string{".bib", ".bibtex"},
+		Description: "BibTeX",
+		Reader:      &BibTeXReader{},
+		Writer: WriterFunc(func(w io.Writer, db *Database) error {
+			db.WriteDatabase(w)
+			return nil
+		}),
+	})
+	RegisterFormat(&Format{
+		Name:        "csl-json",
+		Aliases:     []string{"csljson", "json"},
+		Extensions:  []string{".json"},
+		Description: "CSL-JSON, as used by Pandoc, citeproc and Zotero",
+		Reader:      ReaderFunc(ReadCSLJSON),
+		Writer:      WriterFunc(func(w io.Writer, db *Database) error { return db.WriteCSLJSON(w) }),
+	})
+	RegisterFormat(&Format{
+		Name:        "ris",
+		Extensions:  []string{".ris"},
+		Description: "RIS, as used by EndNote, Mendeley and publisher websites",
+		Reader:      ReaderFunc(ReadRIS),
+		Writer:      WriterFunc(func(w io.Writer, db *Database) error { return db.WriteRIS(w) }),
+	})
+	RegisterFormat(&Format{
+		Name:        "endnote-xml",
+		Aliases:     []string{"endnote"},
+		Description: "EndNote XML",
+		Reader:      ReaderFunc(ReadEndNoteXML),
+	})
+	RegisterFormat(&Format{
+		Name:        "mods",
+		Aliases:     []string{"mods-xml"},
+		Extensions:  []string{".mods"},
+		Description: "MODS XML",
+		Reader:      ReaderFunc(ReadMODS),
+	})
+	RegisterFormat(&Format{
+		Name:        "xml",
+		Extensions:  []string{".xml"},
+		Description: "EndNote XML or MODS XML, chosen by the root element",
+		Reader:      ReaderFunc(ReadXML),
+	})
+}
@@ -0,0 +1,81 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestFormatRegistry(t *testing.T) {
+	for fn, name := range map[string]string{
+		"refs.bib": "bibtex",
+		"REFS.BIB": "bibtex",
+		"a/b.json": "csl-json",
+		"x.ris":    "ris",
+		"x.xml":    "xml",
+		"x.mods":   "mods",
+	} {
+		if f, ok := FormatForFile(fn); !ok || f.Name != name {
+			t.Errorf("FormatForFile(%q) = %v, expected %s", fn, f, name)
+		}
+	}
+	if _, ok := FormatForFile("refs.txt"); ok {
+		t.Errorf("refs.txt shouldn't have a format")
+	}
+	if f, ok := LookupFormat("CSLJSON"); !ok || f.Name != "csl-json" {
+		t.Errorf("aliases should be found ignoring case")
+	}
+	if got := FormatNames(false); got != "bibtex, csl-json, ris" {
+		t.Errorf("writable formats = %q", got)
+	}
+
+	RegisterFormat(&Format{
+		Name:       "keys",
+		Extensions: []string{".keys"},
+		Writer: WriterFunc(func(w io.Writer, db *Database) error {
+			for _, e := range db.Pubs {
+				io.WriteString(w, e.Key+"\n")
+			}
+			return nil
+		}),
+	})
+	defer func() {
+		delete(formatsByName, "keys")
+		delete(formatsByExt, ".keys")
+	}()
+
+	db, err := ReadFormat("bibtex", strings.NewReader("@misc{a, title={A}}\n@misc{b, title={B}}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := WriteFormat("keys", &out, db); err != nil || out.String() != "a\nb\n" {
+		t.Errorf("WriteFormat = %q, %v", out.String(), err)
+	}
+	if _, err := ReadFormat("keys", strings.NewReader("")); err == nil {
+		t.Errorf("expected an error reading a write-only format")
+	}
+	if err := WriteFormat("nope", &out, db); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+}
+
+func TestBibTeXReaderErrorLog(t *testing.T) {
+	var log bytes.Buffer
+	db, err := (&BibTeXReader{ErrorLog: &log}).Read(strings.NewReader("@misc{a, title={A}}\n@misc{b title"))
+	if err != nil || len(db.Pubs) == 0 {
+		t.Fatalf("Read = %v, %v", db, err)
+	}
+	if !strings.Contains(log.String(), "error: line") {
+		t.Errorf("expected syntax errors to be logged, got %q", log.String())
+	}
+
+	// the registered reader logs through Format.Read
+	log.Reset()
+	f, _ := LookupFormat("bibtex")
+	if _, err := f.Read(strings.NewReader("@misc{b title"), &log); err != nil || !strings.Contains(log.String(), "error: line") {
+		t.Errorf("Format.Read = %v, logged %q", err, log.String())
+	}
+}
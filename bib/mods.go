@@ -0,0 +1,417 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+/*=====================================================================================
+ * MODS XML import
+ *
+ * MODS (Metadata Object Description Schema) is the Library of Congress XML
+ * format, used by library catalogs and bibutils. A <modsCollection> holds one
+ * <mods> element per reference; the journal or book a work appears in is a
+ * <relatedItem type="host">.
+ *====================================================================================*/
+
+// modsIgnored lists the MODS elements that describe the record rather than
+// the reference, and so are dropped without a warning.
+var modsIgnored = map[string]bool{
+	"recordInfo":          true,
+	"typeOfResource":      true,
+	"physicalDescription": true,
+	"accessCondition":     true,
+	"classification":      true,
+	"targetAudience":      true,
+}
+
+// modsRoleTags maps MODS role terms (text and MARC relator codes) to the
+// field that holds names with that role.
+var modsRoleTags = map[string]string{
+	"author":  "author",
+	"aut":     "author",
+	"creator": "author",
+	"cre":     "author",
+	"editor":  "editor",
+	"edt":     "editor",
+}
+
+// modsGenres returns the lowercased genres of n.
+func modsGenres(n *xmlNode) []string {
+	genres := make([]string, 0)
+	for _, g := range n.all("genre") {
+		genres = append(genres, strings.ToLower(g.text()))
+	}
+	return genres
+}
+
+// hasGenre returns true iff one of the genres contains one of the words.
+func hasGenre(genres []string, words ...string) bool {
+	for _, g := range genres {
+		for _, w := range words {
+			if strings.Contains(g, w) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// modsKind returns the entry kind of a MODS record, from its genre and the
+// genre of the item that contains it.
+func modsKind(m *xmlNode) EntryKind {
+	genres := modsGenres(m)
+	var host *xmlNode
+	for _, r := range m.all("relatedItem") {
+		if r.attr("type") == "host" {
+			host = r
+		}
+	}
+
+	switch {
+	case hasGenre(genres, "master"):
+		return MastersThesis
+	case hasGenre(genres, "thesis", "dissertation"):
+		return PhdThesis
+	case hasGenre(genres, "report"):
+		return TechReport
+	case hasGenre(genres, "unpublished", "manuscript"):
+		return Unpublished
+	}
+
+	if host != nil {
+		hostGenres := modsGenres(host)
+		issuance := strings.ToLower(host.path("originInfo", "issuance").text())
+		switch {
+		case hasGenre(hostGenres, "journal", "periodical", "magazine", "newspaper") || issuance == "continuing" || issuance == "serial":
+			return Article
+		case hasGenre(hostGenres, "conference"):
+			return InProceedings
+		case hasGenre(hostGenres, "book", "collection"):
+			return InCollection
+		case hasGenre(genres, "conference"):
+			return InProceedings
+		case hasGenre(genres, "article"):
+			return Article
+		}
+		return InCollection
+	}
+
+	switch {
+	case hasGenre(genres, "conference"):
+		return Proceedings
+	case hasGenre(genres, "book"):
+		return Book
+	case hasGenre(genres, "article"):
+		return Article
+	}
+	return Misc
+}
+
+// modsName converts a MODS <name> into an author. Typed name parts map
+// directly into the parts of the author's name; a name with a single untyped
+// part is parsed like a BibTeX name.
+func modsName(n *xmlNode) *Author {
+	if n.attr("type") == "corporate" || n.attr("type") == "conference" {
+		parts := make([]string, 0)
+		for _, p := range n.all("namePart") {
+			parts = append(parts, escapeLaTeX(p.text()))
+		}
+		return &Author{Last: "{" + strings.Join(parts, ", ") + "}"}
+	}
+
+	a := &Author{}
+	var given, untyped []string
+	for _, p := range n.all("namePart") {
+		s := escapeLaTeX(p.text())
+		switch p.attr("type") {
+		case "given":
+			given = append(given, s)
+		case "family":
+			a.Von, a.Last = parseVon(splitOnTopLevel(s))
+		case "termsOfAddress":
+			a.Jr = s
+		case "date":
+			// life dates aren't part of the name
+		default:
+			untyped = append(untyped, s)
+		}
+	}
+	a.First = strings.Join(given, " ")
+	if a.Last == "" && len(untyped) > 0 {
+		if parsed := NormalizeName(strings.Join(untyped, " ")); parsed != nil {
+			if a.First == "" {
+				a.First = parsed.First
+			}
+			a.Von, a.Last = parsed.Von, parsed.Last
+			if a.Jr == "" {
+				a.Jr = parsed.Jr
+			}
+		}
+	}
+	if a.Last == "" && a.First == "" {
+		return nil
+	}
+	return a
+}
+
+// modsRole returns the field for the names in n, from its role, or "" if the
+// role isn't one that BibTeX records. Names with no role are authors.
+func modsRole(n *xmlNode) string {
+	terms := n.child("role").all("roleTerm")
+	if len(terms) == 0 {
+		return "author"
+	}
+	for _, t := range terms {
+		if tag, ok := modsRoleTags[strings.ToLower(t.text())]; ok {
+			return tag
+		}
+	}
+	return ""
+}
+
+// modsTitle returns the main title of n, including its non-sorting prefix and
+// subtitle.
+func modsTitle(n *xmlNode) string {
+	for _, ti := range n.all("titleInfo") {
+		if t := ti.attr("type"); t == "abbreviated" || t == "alternative" || t == "translated" || t == "uniform" {
+			continue
+		}
+		title := ti.child("title").text()
+		if ns := ti.child("nonSort").text(); ns != "" {
+			if strings.HasSuffix(ns, "'") {
+				title = ns + title
+			} else {
+				title = ns + " " + title
+			}
+		}
+		if sub := ti.child("subTitle").text(); sub != "" {
+			title += ": " + sub
+		}
+		return title
+	}
+	return ""
+}
+
+// modsEntry converts a MODS record into an entry. Elements that have no
+// BibTeX field are reported as errors in db.
+func (db *Database) modsEntry(m *xmlNode) *Entry {
+	e := newEntry()
+	e.Kind = modsKind(m)
+	e.EntryString = string(e.Kind)
+	e.Key = m.attr("ID")
+
+	set := func(tag, value string) {
+		if value != "" {
+			if _, ok := e.Fields[tag]; !ok {
+				e.Fields[tag] = cslValue(tag, value)
+			}
+		}
+	}
+	warn := func(name string) {
+		db.addError(e, "", fmt.Sprintf("MODS element <%s> has no BibTeX field; dropped", name))
+	}
+	names := make(map[string][]*Author)
+	addNames := func(n *xmlNode, parent string) {
+		for _, name := range n.all("name") {
+			tag := modsRole(name)
+			if parent != "" && tag == "author" {
+				// the authors of the host (e.g. of a book) aren't the
+				// authors of the work
+				tag = ""
+			}
+			if tag == "" {
+				warn(parent + "name with role " + strings.TrimSpace(name.child("role").text()))
+				continue
+			}
+			if a := modsName(name); a != nil {
+				names[tag] = append(names[tag], a)
+			}
+		}
+	}
+
+	// the date, publisher and place of the work, which may instead be given
+	// by its host
+	origin := func(o *xmlNode) {
+		if o == nil {
+			return
+		}
+		date := o.child("dateIssued").text()
+		if date == "" {
+			date = o.child("copyrightDate").text()
+		}
+		if m := isoDate.FindStringSubmatch(date); m != nil {
+			set("year", m[1])
+			if m[2] != "" {
+				if _, ok := e.Fields["month"]; !ok && monthSymbol(m[2]) != "" {
+					e.Fields["month"] = &Value{T: SymbolType, S: monthSymbol(m[2])}
+				}
+			}
+		} else if y := yearPrefix.FindStringSubmatch(date); y != nil {
+			set("year", y[1])
+		}
+		set(publisherField(e.Kind), o.child("publisher").text())
+		set("address", o.path("place", "placeTerm").text())
+		set("edition", o.child("edition").text())
+	}
+
+	// part holds the volume, issue and pages of the work within its host
+	part := func(p *xmlNode) {
+		for _, d := range p.all("detail") {
+			switch d.attr("type") {
+			case "volume":
+				set("volume", d.child("number").text())
+			case "issue", "number":
+				set("number", d.child("number").text())
+			case "chapter":
+				set("chapter", d.child("number").text())
+			default:
+				warn("part/detail type=" + d.attr("type"))
+			}
+		}
+		if x := p.child("extent"); x != nil {
+			start, end := x.child("start").text(), x.child("end").text()
+			switch {
+			case start != "" && end != "":
+				set("pages", start+"--"+end)
+			case start != "":
+				set("pages", start)
+			case x.child("list").text() != "":
+				set("pages", diffDashes.ReplaceAllString(x.child("list").text(), "--"))
+			}
+		}
+		if d := p.child("date").text(); d != "" {
+			if y := yearPrefix.FindStringSubmatch(d); y != nil {
+				set("year", y[1])
+			}
+		}
+	}
+
+	for _, c := range m.Children {
+		if c.text() == "" || modsIgnored[c.Name] {
+			continue
+		}
+		switch c.Name {
+		case "titleInfo":
+			if t := c.attr("type"); t == "" {
+				set("title", modsTitle(m))
+			}
+		case "name":
+			// collected below, in order
+		case "genre":
+			if e.Kind == TechReport || e.Kind == PhdThesis || e.Kind == MastersThesis {
+				continue
+			}
+			if e.Kind == Misc {
+				set("howpublished", c.text())
+			}
+		case "originInfo":
+			origin(c)
+		case "part":
+			part(c)
+		case "relatedItem":
+			switch c.attr("type") {
+			case "host":
+				title := modsTitle(c)
+				if e.Kind == Article {
+					set("journal", title)
+				} else {
+					set("booktitle", title)
+				}
+				addNames(c, "relatedItem/")
+				for _, p := range c.all("part") {
+					part(p)
+				}
+				origin(c.child("originInfo"))
+				for _, id := range c.all("identifier") {
+					if t := id.attr("type"); t == "issn" || t == "isbn" {
+						set(t, id.text())
+					}
+				}
+			case "series":
+				set("series", modsTitle(c))
+			default:
+				warn("relatedItem type=" + c.attr("type"))
+			}
+		case "identifier":
+			switch t := strings.ToLower(c.attr("type")); t {
+			case "doi", "isbn", "issn", "pmid":
+				set(t, strings.TrimPrefix(c.text(), "doi:"))
+			case "pmc", "pmcid":
+				set("pmc", c.text())
+			case "uri", "url":
+				set("url", c.text())
+			case "citekey":
+				if e.Key == "" {
+					e.Key = c.text()
+				}
+			default:
+				warn("identifier type=" + c.attr("type"))
+			}
+		case "location":
+			set("url", c.child("url").text())
+		case "abstract":
+			set("abstract", c.text())
+		case "note":
+			set("note", c.text())
+		case "language":
+			set("language", c.text())
+		case "subject":
+			// keywords are added below
+		default:
+			warn(c.Name)
+		}
+	}
+
+	addNames(m, "")
+	for _, tag := range []string{"author", "editor"} {
+		if len(names[tag]) > 0 {
+			e.Fields[tag] = nameListValue(names[tag])
+		}
+	}
+	e.AuthorList = names["author"]
+
+	kws := make([]string, 0)
+	for _, s := range m.all("subject") {
+		for _, t := range s.all("topic") {
+			kws = append(kws, t.text())
+		}
+	}
+	if len(kws) > 0 {
+		set("keywords", strings.Join(kws, ", "))
+	}
+	return e
+}
+
+// readMODSTree converts a MODS document into a database.
+func readMODSTree(root *xmlNode) *Database {
+	db := NewDatabase()
+	records := []*xmlNode{root}
+	if root.Name == "modsCollection" {
+		records = root.all("mods")
+	}
+	for _, m := range records {
+		db.Pubs = append(db.Pubs, db.modsEntry(m))
+	}
+	db.assignMissingKeys()
+	return db
+}
+
+// ReadMODS reads a MODS XML document (a <modsCollection> or a single <mods>
+// record) and returns a database with an entry for each record. Text is
+// escaped for LaTeX but is otherwise left as Unicode. Typed name parts map
+// directly to the parts of names. The record's ID attribute gives the key;
+// records without one get a key made from the first author and year. Elements
+// that have no BibTeX equivalent are reported in the database's errors.
+func ReadMODS(r io.Reader) (*Database, error) {
+	root, err := parseXMLTree(r)
+	if err != nil {
+		return nil, err
+	}
+	if root.Name != "mods" && root.Name != "modsCollection" {
+		return nil, fmt.Errorf("not a MODS document: root element is <%s>", root.Name)
+	}
+	return readMODSTree(root), nil
+}
@@ -0,0 +1,103 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadMODS(t *testing.T) {
+	const in = `<?xml version="1.0" encoding="UTF-8"?>
+<modsCollection xmlns="http://www.loc.gov/mods/v3">
+<mods ID="kingsford10">
+  <titleInfo><nonSort>The</nonSort><title>Assembly</title><subTitle>a review</subTitle></titleInfo>
+  <titleInfo type="abbreviated"><title>Assem.</title></titleInfo>
+  <name type="personal"><namePart type="given">Carl</namePart><namePart type="family">Kingsford</namePart>
+    <role><roleTerm type="text">author</roleTerm></role></name>
+  <name type="personal"><namePart type="given">Ludwig</namePart><namePart type="family">van Beethoven</namePart>
+    <namePart type="termsOfAddress">Jr.</namePart><role><roleTerm type="code">aut</roleTerm></role></name>
+  <name type="corporate"><namePart>The Consortium</namePart></name>
+  <name type="personal"><namePart>Joe Illustrator</namePart><role><roleTerm>illustrator</roleTerm></role></name>
+  <originInfo><dateIssued>2010-06</dateIssued></originInfo>
+  <genre>journal article</genre>
+  <relatedItem type="host">
+    <titleInfo><title>BMC Bioinformatics</title></titleInfo>
+    <originInfo><issuance>continuing</issuance></originInfo>
+    <part><detail type="volume"><number>11</number></detail><detail type="issue"><number>1</number></detail>
+      <extent unit="page"><start>21</start><end>30</end></extent></part>
+  </relatedItem>
+  <identifier type="doi">10.1186/1471-2105-11-21</identifier>
+  <subject><topic>assembly</topic></subject>
+</mods>
+<mods>
+  <titleInfo><title>Book chapter</title></titleInfo>
+  <name type="personal"><namePart>Smith, Bob</namePart></name>
+  <originInfo><dateIssued>2001</dateIssued></originInfo>
+  <relatedItem type="host"><titleInfo><title>Big Book</title></titleInfo><genre>book</genre>
+    <name type="personal"><namePart type="given">Ed</namePart><namePart type="family">Itor</namePart>
+      <role><roleTerm>editor</roleTerm></role></name>
+    <originInfo><publisher>MIT Press</publisher><place><placeTerm type="text">Cambridge</placeTerm></place></originInfo>
+  </relatedItem>
+</mods>
+</modsCollection>`
+
+	db, err := ReadMODS(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(db.Pubs) != 2 {
+		t.Fatalf("got %d entries, expected 2", len(db.Pubs))
+	}
+
+	e := db.Pubs[0]
+	if e.Key != "kingsford10" || e.Kind != Article {
+		t.Errorf("key, kind = %q, %q", e.Key, e.Kind)
+	}
+	expected := map[string]string{
+		"author":  `Kingsford, Carl and van Beethoven, Jr., Ludwig and {The Consortium}`,
+		"title":   "The Assembly: a review",
+		"journal": "BMC Bioinformatics",
+		"pages":   "21--30",
+		"month":   "jun",
+		"doi":     "10.1186/1471-2105-11-21",
+	}
+	for tag, s := range expected {
+		if v, ok := e.Fields[tag]; !ok || v.S != s {
+			t.Errorf("%s = %v, expected %q", tag, v, s)
+		}
+	}
+	if e.Fields["year"].I != 2010 || e.Fields["volume"].I != 11 || e.Fields["number"].I != 1 {
+		t.Errorf("year, volume, number = %v, %v, %v", e.Fields["year"], e.Fields["volume"], e.Fields["number"])
+	}
+	if a := e.AuthorList[1]; a.First != "Ludwig" || a.Von != "van" || a.Last != "Beethoven" || a.Jr != "Jr." {
+		t.Errorf("second author = %+v", a)
+	}
+	if len(db.Errors) != 1 || !strings.Contains(db.Errors[0].Msg, "illustrator") {
+		t.Errorf("expected one error for the illustrator, got %v", db.Errors)
+	}
+
+	e = db.Pubs[1]
+	if e.Key != "smith2001" || e.Kind != InCollection {
+		t.Errorf("key, kind = %q, %q", e.Key, e.Kind)
+	}
+	for tag, s := range map[string]string{"booktitle": "Big Book", "editor": "Itor, Ed", "publisher": "MIT Press", "address": "Cambridge"} {
+		if v, ok := e.Fields[tag]; !ok || v.S != s {
+			t.Errorf("%s = %v, expected %q", tag, v, s)
+		}
+	}
+}
+
+func TestReadXML(t *testing.T) {
+	for _, in := range []string{
+		`<mods><titleInfo><title>T</title></titleInfo></mods>`,
+		`<xml><records><record><titles><title>T</title></titles></record></records></xml>`,
+	} {
+		db, err := ReadXML(strings.NewReader(in))
+		if err != nil || len(db.Pubs) != 1 || db.Pubs[0].Fields["title"].S != "T" {
+			t.Errorf("ReadXML(%q) = %v, %v", in, db, err)
+		}
+	}
+	if _, err := ReadXML(strings.NewReader("<html/>")); err == nil {
+		t.Errorf("expected an error for an unknown XML format")
+	}
+}
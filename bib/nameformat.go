@@ -0,0 +1,371 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*=====================================================================================
+ * BibTeX name formatting
+ *
+ * These follow BibTeX's format.name$, purify$ and text.prefix$ built-ins, so
+ * that biblint can reproduce what a style prints. A "special character" is a
+ * brace group at brace depth 0 that starts with a backslash, like {\'E}; it
+ * counts as a single letter.
+ *====================================================================================*/
+
+// foreignLetters are the control sequences that BibTeX treats as letters in
+// their own right, rather than as accents on the letter that follows.
+var foreignLetters = map[string]bool{
+	"oe": true, "OE": true, "ae": true, "AE": true, "aa": true, "AA": true,
+	"o": true, "O": true, "l": true, "L": true, "ss": true, "i": true, "j": true,
+}
+
+// groupEnd returns the index just past the brace group that starts at s[i],
+// or len(s) if it isn't closed.
+func groupEnd(s string, i int) int {
+	depth := 0
+	for j := i; j < len(s); j++ {
+		switch s[j] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return j + 1
+			}
+		}
+	}
+	return len(s)
+}
+
+// isSpecialChar returns true if the brace group starting at s[i] is a special
+// character.
+func isSpecialChar(s string, i int) bool {
+	return i+1 < len(s) && s[i] == '{' && s[i+1] == '\\'
+}
+
+// controlSequence splits a special character (including its braces) into the
+// name of its leading control sequence and the text after it.
+func controlSequence(special string) (string, string) {
+	body := strings.TrimSuffix(strings.TrimPrefix(special, "{\\"), "}")
+	n := 0
+	for n < len(body) && isASCIILetter(body[n]) {
+		n++
+	}
+	if n == 0 && len(body) > 0 {
+		// a one-character control sequence like \' or \"
+		n = 1
+	}
+	return body[:n], body[n:]
+}
+
+// isASCIILetter returns true if c is an ASCII letter.
+func isASCIILetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// specialCharCase returns the first letter that determines the case of a
+// special character: the foreign letter itself (\oe, \AA), or the first
+// letter after the accent command ({\'E}, {\c c}). It returns 0 if there is
+// none.
+func specialCharCase(special string) rune {
+	cs, rest := controlSequence(special)
+	if foreignLetters[cs] {
+		r, _ := utf8.DecodeRuneInString(cs)
+		return r
+	}
+	for _, r := range rest {
+		if unicode.IsLetter(r) {
+			return r
+		}
+	}
+	return 0
+}
+
+// nameWordCase returns the letter that determines the case of a word of a
+// name, as BibTeX decides it: the first letter at brace depth 0, where a
+// special character counts as its letter and other brace groups are skipped.
+// It returns 0 if the word has no such letter (e.g. "{IEEE}").
+func nameWordCase(w string) rune {
+	for i := 0; i < len(w); {
+		switch {
+		case w[i] == '{':
+			end := groupEnd(w, i)
+			if isSpecialChar(w, i) {
+				return specialCharCase(w[i:end])
+			}
+			i = end
+		default:
+			r, size := utf8.DecodeRuneInString(w[i:])
+			if unicode.IsLetter(r) {
+				return r
+			}
+			i += size
+		}
+	}
+	return 0
+}
+
+// isNameWordUpper and isNameWordLower return true if a word of a name is
+// upper- or lowercase, as BibTeX decides it.
+func isNameWordUpper(w string) bool { return unicode.IsUpper(nameWordCase(w)) }
+func isNameWordLower(w string) bool { return unicode.IsLower(nameWordCase(w)) }
+
+// nameTokens splits a part of a name into its tokens, at whitespace, hyphens
+// and ties at brace depth 0. seps[i] is the character that came before
+// tokens[i] (a space for whitespace).
+func nameTokens(part string) (tokens []string, seps []byte) {
+	start, depth := 0, 0
+	sep := byte(' ')
+	for i := 0; i <= len(part); i++ {
+		if i < len(part) {
+			switch c := part[i]; {
+			case c == '{':
+				depth++
+				continue
+			case c == '}':
+				depth--
+				continue
+			case depth > 0 || (c != '-' && c != '~' && c != ' ' && c != '\t' && c != '\n'):
+				continue
+			}
+		}
+		if i > start {
+			tokens = append(tokens, part[start:i])
+			seps = append(seps, sep)
+			sep = ' '
+		}
+		if i < len(part) && part[i] != ' ' && part[i] != '\t' && part[i] != '\n' {
+			sep = part[i]
+		}
+		start = i + 1
+	}
+	return tokens, seps
+}
+
+// abbreviateToken returns the first letter of a token: the first letter at
+// brace depth 0, or the whole of a leading brace group (so {\'E}mile gives
+// {\'E} and {\relax Ch}ristopher gives {\relax Ch}).
+func abbreviateToken(t string) string {
+	for i := 0; i < len(t); {
+		if t[i] == '{' {
+			return t[i:groupEnd(t, i)]
+		}
+		r, size := utf8.DecodeRuneInString(t[i:])
+		if unicode.IsLetter(r) {
+			return string(r)
+		}
+		i += size
+	}
+	return ""
+}
+
+// textLength returns the number of characters in s as BibTeX counts them:
+// braces don't count, and a special character counts as one.
+func textLength(s string) int {
+	n := 0
+	for i := 0; i < len(s); {
+		switch {
+		case isSpecialChar(s, i):
+			n++
+			i = groupEnd(s, i)
+		case s[i] == '{' || s[i] == '}':
+			i++
+		default:
+			_, size := utf8.DecodeRuneInString(s[i:])
+			n++
+			i += size
+		}
+	}
+	return n
+}
+
+// namePart returns the part of a named by a format.name$ letter.
+func (a *Author) namePart(letter byte) string {
+	switch letter {
+	case 'f':
+		return a.First
+	case 'v':
+		return a.Von
+	case 'l':
+		if a.Others {
+			return "others"
+		}
+		return a.Last
+	case 'j':
+		return a.Jr
+	}
+	return ""
+}
+
+// formatGroup formats one top-level {} group of a format.name$ pattern (given
+// without its braces). The group is omitted if the name part it names is
+// empty.
+func (a *Author) formatGroup(g string) string {
+	// find the letter naming the part, at depth 0 of the group
+	k := -1
+	for i := 0; i < len(g) && k < 0; {
+		switch {
+		case g[i] == '{':
+			i = groupEnd(g, i)
+		case isASCIILetter(g[i]):
+			k = i
+		default:
+			i++
+		}
+	}
+	if k < 0 {
+		return g
+	}
+	pre := g[:k]
+	letter := unicode.ToLower(rune(g[k]))
+	full := k+1 < len(g) && unicode.ToLower(rune(g[k+1])) == letter
+	rest := g[k+1:]
+	if full {
+		rest = g[k+2:]
+	}
+	sep, explicit := "", false
+	if strings.HasPrefix(rest, "{") {
+		end := groupEnd(rest, 0)
+		sep, explicit = strings.TrimSuffix(rest[1:end], "}"), true
+		rest = rest[end:]
+	}
+	post := rest
+
+	tokens, seps := nameTokens(a.namePart(byte(letter)))
+	if len(tokens) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	for i, t := range tokens {
+		if full {
+			b.WriteString(t)
+		} else {
+			b.WriteString(abbreviateToken(t))
+		}
+		if i == len(tokens)-1 {
+			break
+		}
+		switch {
+		case explicit:
+			b.WriteString(sep)
+			continue
+		case !full:
+			b.WriteString(".")
+		}
+		switch {
+		case seps[i+1] == '-' || seps[i+1] == '~':
+			b.WriteByte(seps[i+1])
+		case i+1 == len(tokens)-1 || textLength(b.String()) < 3:
+			b.WriteString("~")
+		default:
+			b.WriteString(" ")
+		}
+	}
+	text := b.String()
+
+	// a tie ending the group is discretionary: it's kept only after a short
+	// part, and "~~" asks for a tie regardless
+	switch {
+	case strings.HasSuffix(post, "~~"):
+		post = strings.TrimSuffix(post, "~")
+	case strings.HasSuffix(post, "~") && textLength(text) >= 3:
+		post = strings.TrimSuffix(post, "~") + " "
+	}
+	return pre + text + post
+}
+
+// Format formats the name as BibTeX's format.name$ does. The pattern's
+// top-level {} groups each name a part of the name: "ff" for the full first
+// names, "f" for their initials, and likewise "vv"/"v" (von), "ll"/"l" (last)
+// and "jj"/"j" (jr). Text in a group before and after the letters is written
+// only if the part is not empty, and a {} group right after the letters gives
+// the separator between the part's words. Text outside the groups is written
+// as is. For example, "{ff~}{vv~}{ll}{, jj}" gives "Jean-Pierre van~der
+// Berg, Jr." and "{vv~}{ll}{, f.}" gives "van~der Berg, J.-P."
+func (a *Author) Format(pattern string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); {
+		if pattern[i] == '{' {
+			end := groupEnd(pattern, i)
+			b.WriteString(a.formatGroup(strings.TrimSuffix(pattern[i+1:end], "}")))
+			i = end
+			continue
+		}
+		b.WriteByte(pattern[i])
+		i++
+	}
+	return b.String()
+}
+
+// Purify returns s as BibTeX's purify$ does: only letters, digits and
+// whitespace are kept, hyphens and ties become spaces, and special characters
+// are reduced to their letters ({\'E} to E, {\ss} to ss). Used for sorting
+// and comparing text as BibTeX styles do.
+func Purify(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		if isSpecialChar(s, i) {
+			end := groupEnd(s, i)
+			cs, rest := controlSequence(s[i:end])
+			if foreignLetters[cs] {
+				b.WriteString(cs)
+			}
+			for _, r := range rest {
+				if unicode.IsLetter(r) || unicode.IsDigit(r) {
+					b.WriteRune(r)
+				}
+			}
+			i = end
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		case r == '-' || r == '~':
+			b.WriteByte(' ')
+		case unicode.IsSpace(r):
+			b.WriteRune(r)
+		}
+		i += size
+	}
+	return b.String()
+}
+
+// TextPrefix returns the first n characters of s as BibTeX's text.prefix$
+// does: braces don't count as characters, a special character counts as one
+// and is never split, and any braces left open are closed.
+func TextPrefix(s string, n int) string {
+	var b strings.Builder
+	depth, count := 0, 0
+	for i := 0; i < len(s) && count < n; {
+		switch {
+		case isSpecialChar(s, i) && depth == 0:
+			end := groupEnd(s, i)
+			b.WriteString(s[i:end])
+			count++
+			i = end
+		case s[i] == '{':
+			depth++
+			b.WriteByte('{')
+			i++
+		case s[i] == '}':
+			if depth > 0 {
+				depth--
+				b.WriteByte('}')
+			}
+			i++
+		default:
+			_, size := utf8.DecodeRuneInString(s[i:])
+			b.WriteString(s[i : i+size])
+			count++
+			i += size
+		}
+	}
+	b.WriteString(strings.Repeat("}", depth))
+	return b.String()
+}
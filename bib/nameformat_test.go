@@ -0,0 +1,80 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import "testing"
+
+func TestAuthorFormat(t *testing.T) {
+	tests := []struct {
+		name, pattern, exp string
+	}{
+		{"Donald E. Knuth", "{ff~}{vv~}{ll}{, jj}", "Donald~E. Knuth"},
+		{"Knuth, Donald E.", "{vv~}{ll}{, f.}", "Knuth, D.~E."},
+		{"van der Berg, Jr., Jean-Pierre", "{ff~}{vv~}{ll}{, jj}", "Jean-Pierre van~der Berg, Jr."},
+		{"van der Berg, Jr., Jean-Pierre", "{vv~}{ll}{, jj}{, f.}", "van~der Berg, Jr., J.-P."},
+		{"Wu Li", "{ff~}{ll}", "Wu~Li"},
+		{"Wu Li", "{f.~}{ll}", "W.~Li"},
+		{"Carl Kingsford", "{f.~}{ll}", "C.~Kingsford"},
+		{"Carl Kingsford", "{ff~~}{ll}", "Carl~Kingsford"},
+		{"J. R. R. Tolkien", "{ff~}{ll}", "J.~R.~R. Tolkien"},
+		{"Jean-Pierre Rampal", "{f{}}~{ll}", "JP~Rampal"},
+		{"{\\'E}mile Zola", "{f.~}{ll}", "{\\'E}.~Zola"},
+		{"{\\relax Ch}ristopher Columbus", "{f.~}{ll}", "{\\relax Ch}.~Columbus"},
+		{"{Ch}ristopher Columbus", "{vv~}{ll}", "{Ch}ristopher Columbus"},
+		{"{Barnes and Noble}", "{ff~}{ll}", "{Barnes and Noble}"},
+		{"Zola, Emile", "{ll}{ (ff)}: done", "Zola (Emile): done"},
+		{"others", "{ff~}{ll}", "others"},
+	}
+	for _, tc := range tests {
+		a := NormalizeName(tc.name)
+		if got := a.Format(tc.pattern); got != tc.exp {
+			t.Errorf("%q formatted with %q = %q, expected %q", tc.name, tc.pattern, got, tc.exp)
+		}
+	}
+}
+
+func TestNormalizeNameSpecialChars(t *testing.T) {
+	a := NormalizeName("{\\'E}mile Zola")
+	if a.First != "{\\'E}mile" || a.Last != "Zola" {
+		t.Errorf("first = %q, last = %q", a.First, a.Last)
+	}
+	a = NormalizeName("Jean {\\oe}uvre Martin")
+	if a.First != "Jean" || a.Von != "{\\oe}uvre" || a.Last != "Martin" {
+		t.Errorf("first = %q, von = %q, last = %q", a.First, a.Von, a.Last)
+	}
+}
+
+func TestPurify(t *testing.T) {
+	tests := map[string]string{
+		"{\\'E}mile--Zola":  "Emile  Zola",
+		"Stra{\\ss}e":       "Strasse",
+		"A~B-C":             "A B C",
+		"Hello, {World}!":   "Hello World",
+		"{\\c c}a va":       "ca va",
+		"{\\OE}uvres 2nd":   "OEuvres 2nd",
+		"$\\alpha$-helices": "alpha helices",
+	}
+	for in, exp := range tests {
+		if got := Purify(in); got != exp {
+			t.Errorf("Purify(%q) = %q, expected %q", in, got, exp)
+		}
+	}
+}
+
+func TestTextPrefix(t *testing.T) {
+	tests := []struct {
+		in  string
+		n   int
+		exp string
+	}{
+		{"{\\'E}mile", 2, "{\\'E}m"},
+		{"{ABC}def", 2, "{AB}"},
+		{"a{b{c}d}e", 3, "a{b{c}}"},
+		{"abc", 5, "abc"},
+		{"abc", 0, ""},
+	}
+	for _, tc := range tests {
+		if got := TextPrefix(tc.in, tc.n); got != tc.exp {
+			t.Errorf("TextPrefix(%q, %d) = %q, expected %q", tc.in, tc.n, got, tc.exp)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*=====================================================================================
+ * Organizations as authors
+ *
+ * BibTeX parses "World Health Organization" as the first name "World Health"
+ * and the last name "Organization", so the name of an organization must be
+ * wrapped in braces to be kept whole. An author is taken to be an
+ * organization if its name, as written in the field, has no comma, has more
+ * than one word and contains a word like "Consortium" or "Institute", or is
+ * one of a list of names given by the user.
+ *====================================================================================*/
+
+// defaultOrganizationWords are the words that mark a name as an organization.
+var defaultOrganizationWords = []string{
+	"Agency", "Alliance", "Association", "Board", "Bureau", "Center", "Centre",
+	"Collaboration", "Collaborative", "Commission", "Committee", "Company",
+	"Consortium", "Corporation", "Council", "Department", "Foundation", "Group",
+	"Inc.", "Initiative", "Institute", "Institution", "Laboratory", "Ltd.",
+	"Ministry", "Network", "Organisation", "Organization", "Program",
+	"Programme", "Project", "Society", "Team", "University",
+}
+
+// organizationSet holds the words that mark a name as an organization, and
+// the names of organizations that have none of those words, both as
+// lowercased plain text.
+type organizationSet struct {
+	words map[string]bool
+	names map[string]bool
+}
+
+// organizationKey returns the lowercased plain text of a name, with its words
+// separated by single spaces.
+func organizationKey(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(Purify(name)), " "))
+}
+
+// newOrganizationSet returns the default organization words plus the given
+// ones. An entry of extra with more than one word is the name of an
+// organization; one with a single word marks any name containing it.
+func newOrganizationSet(extra []string) *organizationSet {
+	set := &organizationSet{words: make(map[string]bool), names: make(map[string]bool)}
+	for _, w := range defaultOrganizationWords {
+		set.words[organizationKey(w)] = true
+	}
+	for _, name := range extra {
+		switch key := organizationKey(name); {
+		case key == "":
+		case strings.Contains(key, " "):
+			set.names[key] = true
+		default:
+			set.words[key] = true
+		}
+	}
+	return set
+}
+
+// isOrganization returns true if name, one name from a name list as written
+// in the field, is the name of an organization that isn't protected by
+// braces.
+func (o *organizationSet) isOrganization(name string) bool {
+	if len(splitOnTopLevelString(name, ",", false)) > 1 {
+		return false
+	}
+	words := splitOnTopLevel(name)
+	if len(words) < 2 {
+		return false
+	}
+	if o.names[organizationKey(name)] {
+		return true
+	}
+	for _, w := range words {
+		if o.words[organizationKey(w)] {
+			return true
+		}
+	}
+	return false
+}
+
+// isProtected returns true if the whole name is a single brace group, like
+// "{World Health Organization}", which BibTeX takes as a last name alone.
+func (a *Author) isProtected() bool {
+	last := strings.TrimSpace(a.Last)
+	return a.First == "" && a.Von == "" && a.Jr == "" &&
+		strings.HasPrefix(last, "{") && groupEnd(last, 0) == len(last)
+}
+
+// organizationNames returns the names in the name-list field tag of e that
+// are unprotected organizations.
+func (o *organizationSet) organizationNames(e *Entry, tag string) []string {
+	names := make([]string, 0)
+	if v, ok := e.Fields[tag]; ok && v.T == StringType {
+		for _, name := range splitOnTopLevelString(v.S, "and", true) {
+			if name = strings.TrimSpace(name); o.isOrganization(name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// CheckOrganizationAuthors reports authors that look like organizations but
+// aren't wrapped in braces, so BibTeX will split them into first and last
+// names. organizations are names of organizations, or words that mark them,
+// in addition to the built-in words. It looks at the name-list fields as
+// written, so it must be called before NormalizeAuthors.
+func (db *Database) CheckOrganizationAuthors(organizations []string) {
+	set := newOrganizationSet(organizations)
+	for _, e := range db.Pubs {
+		for _, tag := range db.dialect().NameFields {
+			for _, name := range set.organizationNames(e, tag) {
+				db.addError(e, tag, fmt.Sprintf("organization \"%s\" should be wrapped in braces", name))
+			}
+		}
+	}
+}
+
+// ProtectOrganizationAuthors wraps the authors reported by
+// CheckOrganizationAuthors in braces, so that NormalizeAuthors keeps them
+// whole, and returns the names it wrapped.
+func (db *Database) ProtectOrganizationAuthors(organizations []string) []NameReplacement {
+	set := newOrganizationSet(organizations)
+	changes := make([]NameReplacement, 0)
+	for _, e := range db.Pubs {
+		for _, tag := range db.dialect().NameFields {
+			found := set.organizationNames(e, tag)
+			if len(found) == 0 {
+				continue
+			}
+			for _, name := range found {
+				changes = append(changes, NameReplacement{Key: e.Key, Old: name, New: "{" + name + "}"})
+			}
+			names := splitOnTopLevelString(e.Fields[tag].S, "and", true)
+			for i, name := range names {
+				names[i] = strings.TrimSpace(name)
+				if set.isOrganization(names[i]) {
+					names[i] = "{" + names[i] + "}"
+				}
+			}
+			e.Fields[tag].S = strings.Join(names, " and ")
+		}
+	}
+	return changes
+}
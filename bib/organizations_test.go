@@ -0,0 +1,52 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIsOrganization(t *testing.T) {
+	set := newOrganizationSet([]string{"Kingsford Lab", "Cabal"})
+	tests := []struct {
+		name string
+		org  bool
+	}{
+		{"World Health Organization", true},
+		{"ENCODE Project Consortium", true},
+		{"The {ENCODE} Project Consortium", true},
+		{"Kingsford Lab", true},
+		{"Secret Cabal of Reviewers", true},
+		{"{World Health Organization}", false},
+		{"Consortium", false},
+		{"Carl Kingsford", false},
+		{"Group, Jane", false},
+	}
+	for _, tc := range tests {
+		if got := set.isOrganization(tc.name); got != tc.org {
+			t.Errorf("isOrganization(%q) = %v, expected %v", tc.name, got, tc.org)
+		}
+	}
+}
+
+func TestProtectOrganizationAuthors(t *testing.T) {
+	in := `@misc{a, author={World Health Organization and Carl Kingsford and {NIH} and others}, title={X}}`
+	db := NewParser(strings.NewReader(in)).ParseBibTeX()
+	db.CheckOrganizationAuthors(nil)
+	if len(db.Errors) != 1 {
+		t.Errorf("expected 1 error, got %d", len(db.Errors))
+	}
+	if changes := db.ProtectOrganizationAuthors(nil); len(changes) != 1 {
+		t.Errorf("expected 1 change, got %d", len(changes))
+	}
+	db.NormalizeAuthors()
+	exp := "{World Health Organization} and Kingsford, Carl and {NIH} and others"
+	if got := db.Pubs[0].Fields["author"].S; got != exp {
+		t.Errorf("author = %q, expected %q", got, exp)
+	}
+	db.Errors = nil
+	db.CheckAuthorLast()
+	if len(db.Errors) != 0 {
+		t.Errorf("protected names should pass CheckAuthorLast, got %d errors", len(db.Errors))
+	}
+}
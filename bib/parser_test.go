@@ -123,6 +123,24 @@ func TestFlattenToMinBraces(t *testing.T) {
 	fmt.Println(bn.FlattenToMinBraces())
 }
 
+func TestMergeAdjacentBraces(t *testing.T) {
+	tests := map[string]string{
+		`{mRNA,} {DNA} are great`:        `{mRNA, DNA} are great`,
+		`{A}: {B} -- {C}{D}`:             `{A: B -- CD}`,
+		`{DNA} ({RNA}) {SNP}s`:           `{DNA} ({RNA}) {SNP}s`,
+		`{\"O}zt{\"u}rk {\'E}mile {DNA}`: `{\"O}zt{\"u}rk {\'E}mile {DNA}`,
+		`{\LaTeX} {DNA} {RNA}`:           `{\LaTeX} {DNA RNA}`,
+		`{a} b {c}`:                      `{a} b {c}`,
+		`{({RNA})} {SNP}s`:               `{(RNA) SNP}s`,
+		`{{Sch\"o}n} {{DNA}}`:            `{Sch\"on DNA}`,
+	}
+	for in, exp := range tests {
+		if out := mergeBraces(in); out != exp {
+			t.Errorf("mergeBraces(%q) = %q, expected %q", in, out, exp)
+		}
+	}
+}
+
 func TestIsStrangeCase(t *testing.T) {
 	const in = "nOW"
 	fmt.Println(IsStrangeCase(in))
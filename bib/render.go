@@ -0,0 +1,661 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*=====================================================================================
+ * Rendering formatted reference lists
+ *====================================================================================*/
+
+// RenderOptions controls how a database is rendered as a reference list.
+type RenderOptions struct {
+	// Style is the citation style: "acm", "apa" or "ieee".
+	Style string
+	// Format is the output markup: "txt", "md" or "html".
+	Format string
+	// Initials abbreviates first names to initials. APA and IEEE always use
+	// initials.
+	Initials bool
+	// EtAl, if > 0, shortens name lists with more than EtAl names to the first
+	// EtAlKeep names followed by "et al."
+	EtAl     int
+	EtAlKeep int
+	// Bold lists names (in any form BibTeX accepts) to write in bold, e.g. to
+	// highlight one's own name in a CV. Names match if they have the same last
+	// name and their first names agree word by word, where an initial agrees
+	// with any name it abbreviates.
+	Bold []string
+	// GroupBy is "", "year" or "kind".
+	GroupBy string
+}
+
+// renderStyles and renderFormats list the supported styles and formats.
+var (
+	renderStyles  = []string{"acm", "apa", "ieee"}
+	renderFormats = []string{"txt", "md", "html"}
+)
+
+// kindHeadings gives the heading used for each kind when grouping by kind,
+// in the order the groups are written.
+var kindHeadings = []struct {
+	kinds   []EntryKind
+	heading string
+}{
+	{[]EntryKind{Book, Proceedings}, "Books"},
+	{[]EntryKind{Article}, "Journal Articles"},
+	{[]EntryKind{InProceedings}, "Conference Papers"},
+	{[]EntryKind{InBook, InCollection}, "Book Chapters"},
+	{[]EntryKind{PhdThesis, MastersThesis}, "Theses"},
+	{[]EntryKind{TechReport, Manual}, "Reports"},
+	{[]EntryKind{Unpublished}, "Unpublished"},
+}
+
+// markup writes text in one of the output formats.
+type markup struct {
+	format string
+}
+
+// text escapes plain text.
+func (m markup) text(s string) string {
+	switch m.format {
+	case "html":
+		return html.EscapeString(s)
+	case "md":
+		var b strings.Builder
+		for _, r := range s {
+			if strings.ContainsRune(`\*_[]<>`+"`", r) {
+				b.WriteRune('\\')
+			}
+			b.WriteRune(r)
+		}
+		return b.String()
+	}
+	return s
+}
+
+// italic marks up already-escaped text as italic.
+func (m markup) italic(s string) string {
+	switch {
+	case s == "":
+		return ""
+	case m.format == "html":
+		return "<i>" + s + "</i>"
+	case m.format == "md":
+		return "*" + s + "*"
+	}
+	return s
+}
+
+// bold marks up already-escaped text as bold.
+func (m markup) bold(s string) string {
+	switch {
+	case s == "":
+		return ""
+	case m.format == "html":
+		return "<b>" + s + "</b>"
+	case m.format == "md":
+		return "**" + s + "**"
+	}
+	return s
+}
+
+// link writes url as a link.
+func (m markup) link(url string) string {
+	switch m.format {
+	case "html":
+		u := html.EscapeString(url)
+		return `<a href="` + u + `">` + u + `</a>`
+	case "md":
+		return "<" + url + ">"
+	}
+	return url
+}
+
+// heading writes a group heading.
+func (m markup) heading(s string) string {
+	switch m.format {
+	case "html":
+		return "<h2>" + html.EscapeString(s) + "</h2>\n"
+	case "md":
+		return "## " + m.text(s) + "\n\n"
+	}
+	return s + "\n" + strings.Repeat("=", len([]rune(s))) + "\n\n"
+}
+
+// renderer renders the entries of a database.
+type renderer struct {
+	db   *Database
+	opts *RenderOptions
+	m    markup
+	bold []*Author
+}
+
+// get returns the value of the tag field of e as Unicode text, or "".
+func (r *renderer) get(e *Entry, tag string) string {
+	v, ok := e.Fields[tag]
+	if !ok {
+		return ""
+	}
+	s := displayValue(r.db.SymbolValue(v, 10))
+	if cslVerbatim[tag] {
+		return s
+	}
+	return strings.TrimSpace(latexToText(s))
+}
+
+// name formats a single name for the style.
+func (r *renderer) name(a *Author) string {
+	if isCorporateName(a) {
+		return r.m.text(latexToText(a.Last))
+	}
+	given := latexToText(a.First)
+	if r.opts.Initials || r.opts.Style == "apa" || r.opts.Style == "ieee" {
+		given = initials(given)
+	}
+	last := latexToText(strings.TrimSpace(a.Von + " " + a.Last))
+	jr := latexToText(a.Jr)
+
+	var s string
+	switch {
+	case given == "":
+		s = last
+	case r.opts.Style == "apa":
+		s = last + ", " + given
+	default:
+		s = given + " " + last
+	}
+	if jr != "" {
+		s += ", " + jr
+	}
+	s = r.m.text(s)
+	if matchesName(a, r.bold) {
+		s = r.m.bold(s)
+	}
+	return s
+}
+
+// names formats the name list in the tag field of e.
+func (r *renderer) names(e *Entry, tag string) string {
+	v, ok := e.Fields[tag]
+	if !ok {
+		return ""
+	}
+	list := parseNameList(displayValue(r.db.SymbolValue(v, 10)))
+	etal := false
+	if len(list) > 0 && list[len(list)-1].Others {
+		list = list[:len(list)-1]
+		etal = true
+	}
+	if r.opts.EtAl > 0 && len(list) > r.opts.EtAl {
+		keep := r.opts.EtAlKeep
+		if keep < 1 {
+			keep = 1
+		}
+		if keep < len(list) {
+			list = list[:keep]
+			etal = true
+		}
+	}
+
+	strs := make([]string, 0, len(list))
+	for _, a := range list {
+		strs = append(strs, r.name(a))
+	}
+	if etal {
+		return strings.Join(strs, ", ") + " et al."
+	}
+
+	and := "and "
+	if r.opts.Style == "apa" {
+		and = "& "
+	}
+	switch len(strs) {
+	case 0:
+		return ""
+	case 1:
+		return strs[0]
+	case 2:
+		if r.opts.Style == "apa" {
+			return strs[0] + ", " + and + strs[1]
+		}
+		return strs[0] + " " + and + strs[1]
+	}
+	return strings.Join(strs[:len(strs)-1], ", ") + ", " + and + strs[len(strs)-1]
+}
+
+// date returns the year of e and the name of its month, if any.
+func (r *renderer) date(e *Entry) (string, string) {
+	year := r.db.entryYear(e)
+	month := ""
+	if v, ok := e.Fields["month"]; ok {
+		if n := r.db.monthNumber(v); n > 0 {
+			month = predefinedSymbols[monthSymbols[n-1]]
+		}
+	}
+	return year, month
+}
+
+// doiURL returns the URL for e's DOI, or its URL, or "".
+func (r *renderer) doiURL(e *Entry) string {
+	if doi := r.get(e, "doi"); doi != "" {
+		for _, prefix := range []string{"https://doi.org/", "http://doi.org/", "http://dx.doi.org/", "https://dx.doi.org/", "doi:"} {
+			if strings.HasPrefix(strings.ToLower(doi), prefix) {
+				doi = doi[len(prefix):]
+			}
+		}
+		return "https://doi.org/" + doi
+	}
+	return r.get(e, "url")
+}
+
+// sentence joins non-empty parts with sep and ends the result with a period
+// unless it already ends with punctuation.
+func sentence(sep string, parts ...string) string {
+	nonEmpty := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p != "" {
+			nonEmpty = append(nonEmpty, p)
+		}
+	}
+	s := strings.Join(nonEmpty, sep)
+	if s == "" {
+		return ""
+	}
+	if endsWithPunctuation(s) {
+		return s
+	}
+	return s + "."
+}
+
+// endsWithPunctuation returns true iff s, ignoring any closing markup, ends
+// with a period, question mark or exclamation point.
+func endsWithPunctuation(s string) bool {
+	for {
+		t := strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(s, "</i>"), "</b>"), "*")
+		if t == s {
+			break
+		}
+		s = t
+	}
+	return strings.HasSuffix(s, ".") || strings.HasSuffix(s, "?") || strings.HasSuffix(s, "!")
+}
+
+// container returns the name of the journal or book that e appears in, and
+// the publisher or institution responsible for it.
+func (r *renderer) container(e *Entry) (string, string) {
+	venue := ""
+	for _, tag := range []string{"journal", "journaltitle", "booktitle"} {
+		if venue = r.get(e, tag); venue != "" {
+			break
+		}
+	}
+	publisher := ""
+	for _, tag := range []string{"publisher", "school", "institution", "organization"} {
+		if publisher = r.get(e, tag); publisher != "" {
+			break
+		}
+	}
+	return venue, publisher
+}
+
+// kindNote describes theses and reports, which have no container.
+func (r *renderer) kindNote(e *Entry) string {
+	if t := r.get(e, "type"); t != "" {
+		if n := r.get(e, "number"); n != "" && e.Kind == TechReport {
+			return t + " " + n
+		}
+		return t
+	}
+	switch e.Kind {
+	case PhdThesis:
+		return "PhD thesis"
+	case MastersThesis:
+		return "Master's thesis"
+	case TechReport:
+		if n := r.get(e, "number"); n != "" {
+			return "Technical Report " + n
+		}
+		return "Technical Report"
+	}
+	return r.get(e, "howpublished")
+}
+
+// pages returns the pages of e, with ranges written with an en dash.
+func (r *renderer) pages(e *Entry) string {
+	return strings.ReplaceAll(diffDashes.ReplaceAllString(r.get(e, "pages"), "–"), "—", "–")
+}
+
+// acm renders e in the ACM reference format.
+func (r *renderer) acm(e *Entry) string {
+	m := r.m
+	year, month := r.date(e)
+	venue, publisher := r.container(e)
+	title := m.text(r.get(e, "title"))
+	volume, number, pages := r.get(e, "volume"), r.get(e, "number"), r.pages(e)
+
+	parts := []string{sentence("", r.names(e, "author")), sentence("", year)}
+	switch e.Kind {
+	case Article:
+		parts = append(parts, sentence("", title))
+		v := m.italic(m.text(venue))
+		if volume != "" {
+			v += " " + m.text(volume)
+			if number != "" {
+				v += ", " + m.text(number)
+			}
+		}
+		if d := strings.TrimSpace(month + " " + year); d != "" {
+			v += " (" + m.text(d) + ")"
+		}
+		parts = append(parts, sentence(", ", v, m.text(pages)))
+	case Book, Proceedings:
+		parts = append(parts, sentence("", m.italic(title)), sentence(", ", m.text(publisher), m.text(r.get(e, "address"))))
+	case InProceedings, InCollection, InBook:
+		parts = append(parts, sentence("", title))
+		in := ""
+		if venue != "" {
+			in = "In " + m.italic(m.text(venue))
+		}
+		parts = append(parts, sentence(", ", in, m.text(publisher), m.text(r.get(e, "address")), m.text(pages)))
+	default:
+		parts = append(parts, sentence("", title), sentence(", ", m.text(r.kindNote(e)), m.text(publisher)))
+	}
+	return r.finish(e, parts)
+}
+
+// apa renders e in APA style.
+func (r *renderer) apa(e *Entry) string {
+	m := r.m
+	year, _ := r.date(e)
+	if year == "" {
+		year = "n.d."
+	}
+	venue, publisher := r.container(e)
+	title := m.text(r.get(e, "title"))
+	volume, number, pages := r.get(e, "volume"), r.get(e, "number"), r.pages(e)
+
+	parts := []string{sentence("", r.names(e, "author")), "(" + m.text(year) + ")."}
+	switch e.Kind {
+	case Article:
+		parts = append(parts, sentence("", title))
+		v := m.italic(m.text(venue))
+		if volume != "" {
+			v += ", " + m.italic(m.text(volume))
+			if number != "" {
+				v += "(" + m.text(number) + ")"
+			}
+		}
+		parts = append(parts, sentence(", ", v, m.text(pages)))
+	case Book, Proceedings:
+		parts = append(parts, sentence("", m.italic(title)), sentence("", m.text(publisher)))
+	case InProceedings, InCollection, InBook:
+		parts = append(parts, sentence("", title))
+		in := ""
+		if venue != "" {
+			in = "In " + m.italic(m.text(venue))
+			if pages != "" {
+				in += " (pp. " + m.text(pages) + ")"
+			}
+		}
+		parts = append(parts, sentence("", in), sentence("", m.text(publisher)))
+	default:
+		t := m.italic(title)
+		if note := r.kindNote(e); note != "" {
+			t += " [" + m.text(note) + "]"
+		}
+		parts = append(parts, sentence("", t), sentence("", m.text(publisher)))
+	}
+	return r.finish(e, parts)
+}
+
+// ieeeMonths are the month abbreviations used by IEEE.
+var ieeeMonths = []string{"Jan.", "Feb.", "Mar.", "Apr.", "May", "Jun.", "Jul.", "Aug.", "Sep.", "Oct.", "Nov.", "Dec."}
+
+// ieee renders e in IEEE style.
+func (r *renderer) ieee(e *Entry) string {
+	m := r.m
+	year, month := r.date(e)
+	if month != "" {
+		for i, sym := range monthSymbols {
+			if predefinedSymbols[sym] == month {
+				month = ieeeMonths[i]
+			}
+		}
+	}
+	date := m.text(strings.TrimSpace(month + " " + year))
+	venue, publisher := r.container(e)
+	title := r.get(e, "title")
+	volume, number, pages := r.get(e, "volume"), r.get(e, "number"), r.pages(e)
+
+	quoted := ""
+	if title != "" {
+		quoted = "“" + m.text(title) + ",”"
+	}
+	fields := make([]string, 0)
+	add := func(prefix, s string) {
+		if s != "" {
+			fields = append(fields, prefix+m.text(s))
+		}
+	}
+
+	authors := r.names(e, "author")
+	if authors != "" {
+		authors += ","
+	}
+	switch e.Kind {
+	case Article:
+		fields = append(fields, m.italic(m.text(venue)))
+		add("vol. ", volume)
+		add("no. ", number)
+		add("pp. ", pages)
+		fields = append(fields, date)
+	case Book, Proceedings:
+		quoted = m.italic(m.text(title)) + "."
+		place := r.get(e, "address")
+		if place != "" && publisher != "" {
+			place += ": " + publisher
+		} else {
+			place += publisher
+		}
+		add("", place)
+		fields = append(fields, date)
+	case InProceedings, InCollection, InBook:
+		if venue != "" {
+			fields = append(fields, "in "+m.italic(m.text(venue)))
+		}
+		add("", r.get(e, "address"))
+		add("", publisher)
+		fields = append(fields, date)
+		add("pp. ", pages)
+	default:
+		add("", r.kindNote(e))
+		add("", publisher)
+		add("", r.get(e, "address"))
+		fields = append(fields, date)
+	}
+
+	s := strings.TrimSpace(authors + " " + quoted)
+	if rest := sentence(", ", fields...); rest != "" {
+		if strings.HasSuffix(s, ".") {
+			runes := []rune(rest)
+			s += " " + strings.ToUpper(string(runes[0])) + string(runes[1:])
+		} else {
+			s += " " + rest
+		}
+	} else {
+		s = strings.TrimSuffix(s, ",") + "."
+	}
+	return r.finish(e, []string{s})
+}
+
+// finish joins the parts of a reference and adds a link to its DOI or URL.
+func (r *renderer) finish(e *Entry, parts []string) string {
+	nonEmpty := make([]string, 0, len(parts)+1)
+	for _, p := range parts {
+		if p != "" && p != "." {
+			nonEmpty = append(nonEmpty, p)
+		}
+	}
+	if u := r.doiURL(e); u != "" {
+		nonEmpty = append(nonEmpty, r.m.link(u))
+	}
+	return strings.Join(nonEmpty, " ")
+}
+
+// entry renders a single entry.
+func (r *renderer) entry(e *Entry) string {
+	switch r.opts.Style {
+	case "apa":
+		return r.apa(e)
+	case "ieee":
+		return r.ieee(e)
+	}
+	return r.acm(e)
+}
+
+// renderGroup is a heading and the entries under it.
+type renderGroup struct {
+	heading string
+	entries []*Entry
+}
+
+// groups splits the entries into groups, keeping the order of the entries
+// within each group.
+func (r *renderer) groups() []renderGroup {
+	switch r.opts.GroupBy {
+	case "year":
+		byYear := make(map[string][]*Entry)
+		years := make([]string, 0)
+		for _, e := range r.db.Pubs {
+			y := r.db.entryYear(e)
+			if y == "" {
+				y = "Undated"
+			}
+			if _, ok := byYear[y]; !ok {
+				years = append(years, y)
+			}
+			byYear[y] = append(byYear[y], e)
+		}
+		sort.SliceStable(years, func(i, j int) bool {
+			y1, err1 := strconv.Atoi(years[i])
+			y2, err2 := strconv.Atoi(years[j])
+			if err1 == nil && err2 == nil {
+				return y1 > y2
+			}
+			return err1 == nil && err2 != nil
+		})
+		groups := make([]renderGroup, 0, len(years))
+		for _, y := range years {
+			groups = append(groups, renderGroup{y, byYear[y]})
+		}
+		return groups
+
+	case "kind":
+		groups := make([]renderGroup, 0)
+		used := make(map[*Entry]bool)
+		for _, kh := range kindHeadings {
+			g := renderGroup{heading: kh.heading}
+			for _, e := range r.db.Pubs {
+				for _, k := range kh.kinds {
+					if e.Kind == k {
+						g.entries = append(g.entries, e)
+						used[e] = true
+					}
+				}
+			}
+			if len(g.entries) > 0 {
+				groups = append(groups, g)
+			}
+		}
+		other := renderGroup{heading: "Other"}
+		for _, e := range r.db.Pubs {
+			if !used[e] {
+				other.entries = append(other.entries, e)
+			}
+		}
+		if len(other.entries) > 0 {
+			groups = append(groups, other)
+		}
+		return groups
+	}
+	return []renderGroup{{"", r.db.Pubs}}
+}
+
+// checkOption returns an error if value is not one of the allowed values.
+func checkOption(name, value string, allowed []string) error {
+	for _, a := range allowed {
+		if value == a {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown %s %q (expected one of %s)", name, value, strings.Join(allowed, ", "))
+}
+
+// Render writes the entries of the database to w as a formatted reference
+// list. Entries are written in the order they appear in the database (within
+// each group, if they are grouped). Symbols are expanded, inherited fields are
+// filled in, and LaTeX is converted to Unicode. @xdata entries are skipped.
+// IEEE references are numbered.
+func (db *Database) Render(w io.Writer, opts *RenderOptions) error {
+	if err := checkOption("style", opts.Style, renderStyles); err != nil {
+		return err
+	}
+	if err := checkOption("format", opts.Format, renderFormats); err != nil {
+		return err
+	}
+	if err := checkOption("grouping", opts.GroupBy, []string{"", "year", "kind"}); err != nil {
+		return err
+	}
+
+	r := &renderer{db: db.Resolved(), opts: opts, m: markup{opts.Format}, bold: make([]*Author, 0)}
+	for _, name := range opts.Bold {
+		if a := NormalizeName(name); a != nil {
+			r.bold = append(r.bold, a)
+		}
+	}
+
+	n := 0
+	for _, g := range r.groups() {
+		if g.heading != "" {
+			fmt.Fprint(w, r.m.heading(g.heading))
+		}
+		list := "ul"
+		if opts.Style == "ieee" {
+			list = "ol"
+		}
+		if opts.Format == "html" {
+			if list == "ol" && n > 0 {
+				fmt.Fprintf(w, "<ol start=\"%d\">\n", n+1)
+			} else {
+				fmt.Fprintf(w, "<%s>\n", list)
+			}
+		}
+		for _, e := range g.entries {
+			n++
+			s := r.entry(e)
+			switch {
+			case opts.Format == "html":
+				fmt.Fprintf(w, "<li id=\"%s\">%s</li>\n", html.EscapeString(e.Key), s)
+			case opts.Style == "ieee" && opts.Format == "md":
+				fmt.Fprintf(w, "%d. %s\n\n", n, s)
+			case opts.Style == "ieee":
+				fmt.Fprintf(w, "[%d] %s\n\n", n, s)
+			case opts.Format == "md":
+				fmt.Fprintf(w, "- %s\n\n", s)
+			default:
+				fmt.Fprintf(w, "%s\n\n", s)
+			}
+		}
+		if opts.Format == "html" {
+			fmt.Fprintf(w, "</%s>\n", list)
+		}
+	}
+	return nil
+}
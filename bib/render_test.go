@@ -0,0 +1,122 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const renderBib = `@string{bmc = "BMC Bioinformatics"}
+@article{k10, author={Kingsford, Carl and Schatz, Michael C. and Pop, Mihai},
+  title={Assembly complexity of prokaryotic genomes}, journal=bmc, year=2010,
+  volume=11, number=1, pages={21--30}, month=jan, doi={10.1186/1471-2105-11-21}}
+@inproceedings{p21, author={Jean-Pierre Dupont and M{\"u}ller, J{\"o}rg and others},
+  title={Fast {DNA} search}, booktitle={Proc. of RECOMB}, year=2021, pages={3--14},
+  publisher={Springer}, url={https://x.org/a_b}}
+@book{b1, author={{The Consortium}}, title={A \& B}, publisher={MIT Press}, address={Cambridge}, year=2001}
+`
+
+func render(t *testing.T, opts *RenderOptions) string {
+	db := NewParser(strings.NewReader(renderBib)).ParseBibTeX()
+	var out bytes.Buffer
+	if err := db.Render(&out, opts); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestRenderStyles(t *testing.T) {
+	tests := []struct {
+		opts     RenderOptions
+		expected []string
+	}{
+		{RenderOptions{Style: "acm", Format: "txt"}, []string{
+			"Carl Kingsford, Michael C. Schatz, and Mihai Pop. 2010. Assembly complexity of prokaryotic genomes. BMC Bioinformatics 11, 1 (January 2010), 21–30. https://doi.org/10.1186/1471-2105-11-21\n",
+			"Jean-Pierre Dupont, Jörg Müller et al. 2021. Fast DNA search. In Proc. of RECOMB, Springer, 3–14. https://x.org/a_b\n",
+			"The Consortium. 2001. A & B. MIT Press, Cambridge.\n",
+		}},
+		{RenderOptions{Style: "apa", Format: "txt"}, []string{
+			"Kingsford, C., Schatz, M. C., & Pop, M. (2010). Assembly complexity of prokaryotic genomes. BMC Bioinformatics, 11(1), 21–30. https://doi.org/10.1186/1471-2105-11-21\n",
+			"Dupont, J.-P., Müller, J. et al. (2021). Fast DNA search. In Proc. of RECOMB (pp. 3–14). Springer. https://x.org/a_b\n",
+		}},
+		{RenderOptions{Style: "ieee", Format: "txt"}, []string{
+			"[1] C. Kingsford, M. C. Schatz, and M. Pop, “Assembly complexity of prokaryotic genomes,” BMC Bioinformatics, vol. 11, no. 1, pp. 21–30, Jan. 2010. https://doi.org/10.1186/1471-2105-11-21\n",
+			"[3] The Consortium, A & B. Cambridge: MIT Press, 2001.\n",
+		}},
+	}
+	for _, tc := range tests {
+		opts := tc.opts
+		out := render(t, &opts)
+		for _, s := range tc.expected {
+			if !strings.Contains(out, s) {
+				t.Errorf("%s output is missing %q:\n%s", tc.opts.Style, s, out)
+			}
+		}
+	}
+}
+
+func TestRenderOptions(t *testing.T) {
+	out := render(t, &RenderOptions{Style: "acm", Format: "md", Initials: true, EtAl: 2,
+		Bold: []string{"Kingsford, C."}, GroupBy: "year"})
+	for _, s := range []string{
+		"## 2021\n\n- J.-P. Dupont, J. Müller et al.",
+		"- **C. Kingsford** et al. 2010.",
+		"*BMC Bioinformatics* 11",
+		"<https://doi.org/10.1186/1471-2105-11-21>",
+		"*A & B*",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("markdown output is missing %q:\n%s", s, out)
+		}
+	}
+	// a different first name with the same initial isn't bolded
+	bdb := NewParser(strings.NewReader(`@misc{m, author={Carl Kingsford and Catherine Kingsford and C. Kingsford}, title={T}, year=2020}`)).ParseBibTeX()
+	var b bytes.Buffer
+	if err := bdb.Render(&b, &RenderOptions{Style: "acm", Format: "md", Bold: []string{"Kingsford, Carl"}}); err != nil {
+		t.Fatal(err)
+	}
+	if exp := "**Carl Kingsford**, Catherine Kingsford, and **C. Kingsford**"; !strings.Contains(b.String(), exp) {
+		t.Errorf("bold output is missing %q:\n%s", exp, b.String())
+	}
+
+	if strings.Index(out, "## 2021") > strings.Index(out, "## 2010") {
+		t.Errorf("years should be in decreasing order:\n%s", out)
+	}
+
+	out = render(t, &RenderOptions{Style: "ieee", Format: "html", GroupBy: "kind"})
+	for _, s := range []string{
+		"<h2>Books</h2>\n<ol>\n<li id=\"b1\">The Consortium, <i>A &amp; B</i>.",
+		"<h2>Journal Articles</h2>\n<ol start=\"2\">\n",
+		`<a href="https://x.org/a_b">https://x.org/a_b</a>`,
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("html output is missing %q:\n%s", s, out)
+		}
+	}
+
+	db := NewDatabase()
+	for _, opts := range []*RenderOptions{
+		{Style: "mla", Format: "txt"},
+		{Style: "acm", Format: "pdf"},
+		{Style: "acm", Format: "txt", GroupBy: "venue"},
+	} {
+		if err := db.Render(&bytes.Buffer{}, opts); err == nil {
+			t.Errorf("expected an error for %+v", opts)
+		}
+	}
+}
+
+func TestInitials(t *testing.T) {
+	for in, out := range map[string]string{
+		"John Andrew": "J. A.",
+		"Jean-Pierre": "J.-P.",
+		"J. R. R.":    "J. R. R.",
+		"Élodie":      "É.",
+		"":            "",
+	} {
+		if got := initials(in); got != out {
+			t.Errorf("initials(%q) = %q, expected %q", in, got, out)
+		}
+	}
+}
@@ -0,0 +1,551 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/*=====================================================================================
+ * RIS import and export
+ *
+ * RIS is the tagged text format used by EndNote, RefWorks, Mendeley and most
+ * publisher websites. Each record is a list of "XX  - value" lines, starting with
+ * a TY (type) line and ending with an ER line.
+ *====================================================================================*/
+
+// kindToRIS maps entry kinds to RIS reference types.
+var kindToRIS = map[EntryKind]string{
+	Article:       "JOUR",
+	Book:          "BOOK",
+	Booklet:       "PAMP",
+	InBook:        "CHAP",
+	InCollection:  "CHAP",
+	InProceedings: "CPAPER",
+	Manual:        "GEN",
+	MastersThesis: "THES",
+	Misc:          "GEN",
+	PhdThesis:     "THES",
+	Proceedings:   "CONF",
+	TechReport:    "RPRT",
+	Unpublished:   "UNPB",
+}
+
+// risToKind maps RIS reference types to entry kinds. Types that aren't listed
+// become Misc.
+var risToKind = map[string]EntryKind{
+	"JOUR":    Article,
+	"JFULL":   Article,
+	"MGZN":    Article,
+	"NEWS":    Article,
+	"EJOUR":   Article,
+	"INPR":    Article,
+	"BOOK":    Book,
+	"EBOOK":   Book,
+	"EDBOOK":  Book,
+	"PAMP":    Booklet,
+	"CHAP":    InCollection,
+	"ECHAP":   InCollection,
+	"CPAPER":  InProceedings,
+	"CONF":    Proceedings,
+	"THES":    PhdThesis,
+	"RPRT":    TechReport,
+	"UNPB":    Unpublished,
+	"MANSCPT": Unpublished,
+	"GEN":     Misc,
+}
+
+// risFields maps RIS tags that hold a single value to the BibTeX field they
+// become. Tags whose meaning depends on the reference type (containers, ISBN
+// vs ISSN, publishers), names, dates and pages are handled separately.
+var risFields = map[string]string{
+	"TI": "title",
+	"T1": "title",
+	"VL": "volume",
+	"IS": "number",
+	"ET": "edition",
+	"T3": "series",
+	"CY": "address",
+	"DO": "doi",
+	"UR": "url",
+	"AB": "abstract",
+	"N2": "abstract",
+	"N1": "note",
+	"LA": "language",
+	"M3": "type",
+}
+
+// risOutput lists the BibTeX fields written to RIS by single-valued tags, and
+// the tag each is written to.
+var risOutput = []struct{ field, tag string }{
+	{"title", "TI"},
+	{"volume", "VL"},
+	{"number", "IS"},
+	{"edition", "ET"},
+	{"series", "T3"},
+	{"address", "CY"},
+	{"doi", "DO"},
+	{"url", "UR"},
+	{"abstract", "AB"},
+	{"note", "N1"},
+	{"language", "LA"},
+	{"type", "M3"},
+}
+
+// risLine matches a tagged RIS line.
+var risLine = regexp.MustCompile(`^([A-Z][A-Z0-9])  -(?: (.*))?$`)
+
+// risDate matches a RIS date (YYYY/MM/DD/other, with any part missing).
+var risDate = regexp.MustCompile(`^(\d{4})(?:[/-](\d{0,2}))?`)
+
+// risField is a tag and value from a RIS record.
+type risField struct {
+	tag, value string
+}
+
+// risRecord is a RIS record in the order its lines appear.
+type risRecord struct {
+	fields []risField
+	line   int
+}
+
+// all returns the values of every line with the given tag.
+func (r *risRecord) all(tag string) []string {
+	values := make([]string, 0)
+	for _, f := range r.fields {
+		if f.tag == tag {
+			values = append(values, f.value)
+		}
+	}
+	return values
+}
+
+// first returns the value of the first line with one of the given tags, and
+// the tag it was found under.
+func (r *risRecord) first(tags ...string) (string, string) {
+	for _, tag := range tags {
+		if v := r.all(tag); len(v) > 0 {
+			return v[0], tag
+		}
+	}
+	return "", ""
+}
+
+// readRISRecords splits RIS input into records. Untagged lines inside a
+// record continue the value of the previous line.
+func readRISRecords(r io.Reader) ([]*risRecord, error) {
+	records := make([]*risRecord, 0)
+	var cur *risRecord
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if lineNo == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		m := risLine.FindStringSubmatch(line)
+		switch {
+		case m == nil:
+			if cur != nil && len(cur.fields) > 0 && strings.TrimSpace(line) != "" {
+				f := &cur.fields[len(cur.fields)-1]
+				f.value += " " + strings.TrimSpace(line)
+			}
+		case m[1] == "TY":
+			if cur != nil {
+				return nil, fmt.Errorf("line %d: TY before ER; the record on line %d is missing its ER line", lineNo, cur.line)
+			}
+			cur = &risRecord{line: lineNo}
+			cur.fields = append(cur.fields, risField{"TY", strings.TrimSpace(m[2])})
+		case m[1] == "ER":
+			if cur != nil {
+				records = append(records, cur)
+			}
+			cur = nil
+		case cur == nil:
+			return nil, fmt.Errorf("line %d: %s tag outside of a record", lineNo, m[1])
+		default:
+			cur.fields = append(cur.fields, risField{m[1], strings.TrimSpace(m[2])})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if cur != nil {
+		return nil, fmt.Errorf("line %d: record is missing its ER line", cur.line)
+	}
+	return records, nil
+}
+
+// risNames converts RIS names ("Last, First, Suffix") into a BibTeX name list
+// and the parsed authors.
+func risNames(values []string) (string, []*Author) {
+	authors := make([]*Author, 0, len(values))
+	strs := make([]string, 0, len(values))
+	for _, v := range values {
+		parts := strings.Split(v, ",")
+		for i := range parts {
+			parts[i] = escapeLaTeX(strings.TrimSpace(parts[i]))
+		}
+		name := parts[0]
+		switch len(parts) {
+		case 1:
+			// a name without a comma is an institution
+			if !strings.EqualFold(name, "others") {
+				name = "{" + name + "}"
+			}
+		case 2:
+			name = parts[0] + ", " + parts[1]
+		default:
+			name = parts[0] + ", " + parts[2] + ", " + parts[1]
+		}
+		if a := NormalizeName(name); a != nil {
+			authors = append(authors, a)
+			strs = append(strs, a.String())
+		}
+	}
+	return strings.Join(strs, " and "), authors
+}
+
+// risEntry converts a RIS record into an entry. Tags that have no BibTeX
+// field are reported as errors in db.
+func (db *Database) risEntry(r *risRecord) *Entry {
+	e := newEntry()
+	e.LineNo = r.line
+
+	ty, _ := r.first("TY")
+	kind, ok := risToKind[strings.ToUpper(ty)]
+	if !ok {
+		kind = Misc
+	}
+	m3, _ := r.first("M3")
+	if kind == PhdThesis && strings.Contains(strings.ToLower(m3), "master") {
+		kind = MastersThesis
+	}
+	e.Kind = kind
+	e.EntryString = string(kind)
+	e.Key, _ = r.first("ID")
+
+	set := func(tag, value string) {
+		if value != "" {
+			if _, ok := e.Fields[tag]; !ok {
+				e.Fields[tag] = cslValue(tag, value)
+			}
+		}
+	}
+
+	// names
+	for _, names := range []struct {
+		field string
+		tags  []string
+	}{
+		{"author", []string{"AU", "A1"}},
+		{"editor", []string{"ED", "A2"}},
+	} {
+		values := make([]string, 0)
+		for _, tag := range names.tags {
+			values = append(values, r.all(tag)...)
+		}
+		if len(values) > 0 {
+			s, authors := risNames(values)
+			e.Fields[names.field] = &Value{T: StringType, S: s}
+			if names.field == "author" {
+				e.AuthorList = authors
+			}
+		}
+	}
+
+	// dates
+	if date, _ := r.first("PY", "Y1", "DA"); date != "" {
+		if m := risDate.FindStringSubmatch(date); m != nil {
+			y, _ := strconv.Atoi(m[1])
+			e.Fields["year"] = &Value{T: NumberType, I: y}
+			if month, err := strconv.Atoi(m[2]); err == nil && 1 <= month && month <= 12 {
+				e.Fields["month"] = &Value{T: SymbolType, S: monthSymbols[month-1]}
+			}
+		} else {
+			set("year", date)
+		}
+	}
+	if _, ok := e.Fields["month"]; !ok {
+		if da, _ := r.first("DA"); da != "" {
+			if m := risDate.FindStringSubmatch(da); m != nil {
+				if month, err := strconv.Atoi(m[2]); err == nil && 1 <= month && month <= 12 {
+					e.Fields["month"] = &Value{T: SymbolType, S: monthSymbols[month-1]}
+				}
+			}
+		}
+	}
+
+	// pages
+	sp, _ := r.first("SP")
+	ep, _ := r.first("EP")
+	switch {
+	case sp != "" && ep != "":
+		set("pages", sp+"--"+ep)
+	case sp != "":
+		set("pages", diffDashes.ReplaceAllString(sp, "--"))
+	}
+
+	// containers
+	switch kind {
+	case Article:
+		v, _ := r.first("JF", "JO", "T2", "JA", "J2")
+		set("journal", v)
+	case InBook, InCollection, InProceedings:
+		v, _ := r.first("T2", "BT", "JF", "JO")
+		set("booktitle", v)
+	default:
+		v, _ := r.first("T2", "BT")
+		set("booktitle", v)
+	}
+
+	// identifiers
+	if sn, _ := r.first("SN"); sn != "" {
+		if kind == Article {
+			set("issn", sn)
+		} else {
+			set("isbn", sn)
+		}
+	}
+
+	if pb, _ := r.first("PB"); pb != "" {
+		set(publisherField(kind), pb)
+	}
+	if kw := r.all("KW"); len(kw) > 0 {
+		set("keywords", strings.Join(kw, ", "))
+	}
+
+	handled := map[string]bool{
+		"TY": true, "ID": true, "M3": m3 != "" && (kind == PhdThesis || kind == MastersThesis),
+		"AU": true, "A1": true, "ED": true, "A2": true,
+		"PY": true, "Y1": true, "DA": true, "SP": true, "EP": true,
+		"JF": true, "JO": true, "T2": true, "JA": true, "J2": true, "BT": true,
+		"SN": true, "PB": true, "KW": true,
+	}
+	reported := make(map[string]bool)
+	for _, f := range r.fields {
+		if handled[f.tag] {
+			continue
+		}
+		if tag, ok := risFields[f.tag]; ok {
+			set(tag, f.value)
+		} else if !reported[f.tag] {
+			reported[f.tag] = true
+			db.addError(e, "", fmt.Sprintf("RIS tag %s has no BibTeX field; dropped", f.tag))
+		}
+	}
+	return e
+}
+
+// authorYearKey returns a key for an entry that has none, made from the last
+// name of the first author and the year, that isn't already in used.
+func authorYearKey(e *Entry, used map[string]bool) string {
+	base := "ref"
+	if len(e.AuthorList) > 0 && !e.AuthorList[0].Others {
+		var b strings.Builder
+		for _, r := range foldAccents(latexToText(e.AuthorList[0].Last)) {
+			if ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') {
+				b.WriteRune(r)
+			}
+		}
+		if b.Len() > 0 {
+			base = strings.ToLower(b.String())
+		}
+	}
+	if v, ok := e.Fields["year"]; ok {
+		base += displayValue(v)
+	}
+	key := base
+	for i := 0; used[key]; i++ {
+		key = base + string(rune('a'+i%26))
+		if i >= 26 {
+			key += strconv.Itoa(i / 26)
+		}
+	}
+	return key
+}
+
+// ReadRIS reads RIS records and returns a database with an entry for each
+// record. Text is escaped for LaTeX but is otherwise left as Unicode. The ID
+// tag gives the key of the entry; records without one get a key made from the
+// first author and year. Tags that have no BibTeX equivalent are reported in
+// the database's errors.
+func ReadRIS(r io.Reader) (*Database, error) {
+	records, err := readRISRecords(r)
+	if err != nil {
+		return nil, err
+	}
+	db := NewDatabase()
+	for _, rec := range records {
+		db.Pubs = append(db.Pubs, db.risEntry(rec))
+	}
+	db.assignMissingKeys()
+	return db, nil
+}
+
+// assignMissingKeys gives each imported entry that has no key one made from
+// its first author and year.
+func (db *Database) assignMissingKeys() {
+	used := make(map[string]bool)
+	for _, e := range db.Pubs {
+		used[e.Key] = true
+	}
+	for _, e := range db.Pubs {
+		if e.Key == "" {
+			e.Key = authorYearKey(e, used)
+			used[e.Key] = true
+		}
+	}
+}
+
+/*-------------------------------------------------------------------------------------
+ * Writing RIS
+ *------------------------------------------------------------------------------------*/
+
+// risName formats a name as RIS expects: "Last, First, Suffix".
+func risName(a *Author) string {
+	if isCorporateName(a) {
+		return latexToText(a.Last)
+	}
+	last := strings.TrimSpace(a.Von + " " + a.Last)
+	s := latexToText(last)
+	if a.First != "" || a.Jr != "" {
+		s += ", " + latexToText(a.First)
+	}
+	if a.Jr != "" {
+		s += ", " + latexToText(a.Jr)
+	}
+	return s
+}
+
+// writeRISEntry writes e as a RIS record. Fields that have no RIS tag are
+// not written.
+func (db *Database) writeRISEntry(w io.Writer, e *Entry) {
+	text := func(tag string) string {
+		s := displayValue(db.SymbolValue(e.Fields[tag], 10))
+		if cslVerbatim[tag] {
+			return s
+		}
+		return strings.TrimSpace(latexToText(s))
+	}
+	line := func(tag, value string) {
+		if value != "" {
+			fmt.Fprintf(w, "%s  - %s\n", tag, value)
+		}
+	}
+	has := func(tag string) bool {
+		_, ok := e.Fields[tag]
+		return ok
+	}
+
+	ty, ok := kindToRIS[e.Kind]
+	if !ok {
+		ty = "GEN"
+	}
+	line("TY", ty)
+	line("ID", e.Key)
+
+	for _, names := range []struct{ field, tag string }{{"author", "AU"}, {"editor", "ED"}} {
+		if has(names.field) {
+			for _, a := range parseNameList(displayValue(db.SymbolValue(e.Fields[names.field], 10))) {
+				if !a.Others {
+					line(names.tag, risName(a))
+				}
+			}
+		}
+	}
+
+	for _, f := range risOutput {
+		if has(f.field) && !(f.field == "type" && (e.Kind == PhdThesis || e.Kind == MastersThesis)) {
+			line(f.tag, text(f.field))
+		}
+	}
+	switch e.Kind {
+	case PhdThesis:
+		if has("type") {
+			line("M3", text("type"))
+		} else {
+			line("M3", "PhD thesis")
+		}
+	case MastersThesis:
+		if has("type") {
+			line("M3", text("type"))
+		} else {
+			line("M3", "Master's thesis")
+		}
+	}
+
+	if has("journal") {
+		line("JO", text("journal"))
+	} else if has("journaltitle") {
+		line("JO", text("journaltitle"))
+	}
+	if has("booktitle") {
+		line("T2", text("booktitle"))
+	}
+
+	if d := db.cslIssued(e); d != nil {
+		switch {
+		case len(d.DateParts) > 0:
+			parts := d.DateParts[0]
+			line("PY", fmt.Sprint(parts[0]))
+			if len(parts) > 1 {
+				date := fmt.Sprintf("%v/%02d/", parts[0], parts[1])
+				if len(parts) > 2 {
+					date += fmt.Sprintf("%02d", parts[2])
+				}
+				line("DA", date)
+			}
+		case d.Literal != "":
+			line("PY", d.Literal)
+		case d.Raw != "":
+			line("DA", d.Raw)
+		}
+	}
+
+	if has("pages") {
+		pages := diffDashes.Split(strings.ReplaceAll(text("pages"), "–", "-"), 2)
+		line("SP", strings.TrimSpace(pages[0]))
+		if len(pages) > 1 {
+			line("EP", strings.TrimSpace(pages[1]))
+		}
+	}
+
+	for _, tag := range cslPublisherFields {
+		if has(tag) {
+			line("PB", text(tag))
+			break
+		}
+	}
+	if has("issn") {
+		line("SN", text("issn"))
+	} else if has("isbn") {
+		line("SN", text("isbn"))
+	}
+	if has("keywords") {
+		for _, kw := range strings.Split(text("keywords"), ",") {
+			line("KW", strings.TrimSpace(kw))
+		}
+	}
+	fmt.Fprintf(w, "ER  - \n\n")
+}
+
+// WriteRIS writes the database to w as RIS records. Symbols are expanded and
+// LaTeX is converted to Unicode text, and inherited fields are filled in.
+// Fields that have no RIS tag, the preamble, @xdata entries, and "others" in
+// name lists are not written.
+func (db *Database) WriteRIS(w io.Writer) error {
+	db = db.Resolved()
+	bw := bufio.NewWriter(w)
+	for _, e := range db.Pubs {
+		db.writeRISEntry(bw, e)
+	}
+	return bw.Flush()
+}
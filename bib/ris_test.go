@@ -0,0 +1,142 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReadRIS(t *testing.T) {
+	const in = "\ufeffTY  - JOUR\r\n" + `AU  - Müller, Jörg
+AU  - de la Cruz, Ana, Jr.
+AU  - The Consortium
+TI  - R&D of
+  wrapped titles
+JO  - J. Comput. Biol.
+PY  - 2019/03/12/
+SP  - 1
+EP  - 10
+SN  - 1234-5678
+KW  - genomics
+KW  - DNA
+Y2  - 2020
+ER  - 
+
+TY  - THES
+ID  - smith
+AU  - Smith, Bob
+TI  - Thesis
+M3  - Master's thesis
+PB  - CMU
+PY  - 2020
+ER  - 
+`
+	db, err := ReadRIS(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(db.Pubs) != 2 {
+		t.Fatalf("got %d entries, expected 2", len(db.Pubs))
+	}
+
+	e := db.Pubs[0]
+	if e.Key != "muller2019" || e.Kind != Article || e.LineNo != 1 {
+		t.Errorf("key, kind, line = %q, %q, %d", e.Key, e.Kind, e.LineNo)
+	}
+	expected := map[string]string{
+		"author":   `Müller, Jörg and de la Cruz, Jr., Ana and {The Consortium}`,
+		"title":    `R\&D of wrapped titles`,
+		"journal":  "J. Comput. Biol.",
+		"pages":    "1--10",
+		"issn":     "1234-5678",
+		"keywords": "genomics, DNA",
+		"month":    "mar",
+	}
+	for tag, s := range expected {
+		if v, ok := e.Fields[tag]; !ok || v.S != s {
+			t.Errorf("%s = %v, expected %q", tag, v, s)
+		}
+	}
+	if e.Fields["year"].I != 2019 {
+		t.Errorf("year = %v, expected 2019", e.Fields["year"])
+	}
+	if len(e.AuthorList) != 3 || e.AuthorList[1].Von != "de la" || e.AuthorList[1].Jr != "Jr." {
+		t.Errorf("author list = %v", e.AuthorList)
+	}
+	if len(db.Errors) != 1 || db.Errors[0].BadEntry != e || !strings.Contains(db.Errors[0].Msg, "Y2") {
+		t.Errorf("expected one error for the Y2 tag, got %v", db.Errors)
+	}
+
+	e = db.Pubs[1]
+	if e.Key != "smith" || e.Kind != MastersThesis || e.Fields["school"] == nil {
+		t.Errorf("thesis = %q, %q, %v", e.Key, e.Kind, e.Fields)
+	}
+	if _, ok := e.Fields["type"]; ok {
+		t.Errorf("thesis type should not be kept")
+	}
+}
+
+func TestReadRISErrors(t *testing.T) {
+	for _, in := range []string{
+		"AU  - Smith, Bob\nER  - \n",
+		"TY  - JOUR\nAU  - Smith, Bob\n",
+		"TY  - JOUR\nAU  - Smith, Bob\nTY  - BOOK\nAU  - Doe, Jane\nER  - \n",
+	} {
+		if _, err := ReadRIS(strings.NewReader(in)); err == nil {
+			t.Errorf("expected an error reading %q", in)
+		}
+	}
+}
+
+func TestWriteRIS(t *testing.T) {
+	const in = `@article{a1, author={M{\"u}ller, J{\"o}rg and {The Consortium} and others},
+  title={The {DNA} of \emph{Things}}, pages={1--10}, month=mar, year=2019}`
+	db := NewParser(strings.NewReader(in)).ParseBibTeX()
+	var out bytes.Buffer
+	if err := db.WriteRIS(&out); err != nil {
+		t.Fatal(err)
+	}
+	const expected = `TY  - JOUR
+ID  - a1
+AU  - Müller, Jörg
+AU  - The Consortium
+TI  - The DNA of Things
+PY  - 2019
+DA  - 2019/03/
+SP  - 1
+EP  - 10
+ER  - 
+
+`
+	if out.String() != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+}
+
+func TestRISRoundTrip(t *testing.T) {
+	const in = `@string{jcb = "J. Comput. Biol."}
+@article{a1, author={Muller, Jorg and de la Cruz, Jr., Ana}, title={The {DNA} of Things},
+  journal=jcb, year=2019, month=mar, pages={1--10}, volume=3, number=2, doi={10.1/x}}
+@phdthesis{t1, author={Smith, Bob}, title={Thesis}, school={CMU}, year=2020}
+@inproceedings{p1, author={Li, X}, title={P}, booktitle={Proc. X}, year=2021, publisher={ACM}, address={NY}}
+`
+	db := NewParser(strings.NewReader(in)).ParseBibTeX()
+	var out bytes.Buffer
+	if err := db.WriteRIS(&out); err != nil {
+		t.Fatal(err)
+	}
+	db2, err := ReadRIS(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(db2.Errors) != 0 {
+		t.Errorf("unexpected errors: %v", db2.Errors)
+	}
+	d := Diff(db, db2)
+	if !d.IsEmpty() {
+		var b bytes.Buffer
+		d.Write(&b)
+		t.Errorf("round trip changed the database:\n%s", b.String())
+	}
+}
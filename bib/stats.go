@@ -0,0 +1,239 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*=====================================================================================
+ * Bibliography statistics
+ *====================================================================================*/
+
+// Count is the number of times Name occurs.
+type Count struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Stats summarizes a database.
+type Stats struct {
+	Entries  int     `json:"entries"`
+	Symbols  int     `json:"symbols"`
+	ByKind   []Count `json:"by_kind"`
+	ByYear   []Count `json:"by_year"`
+	Venues   []Count `json:"top_venues"`
+	Authors  []Count `json:"top_authors"`
+	Fields   []Count `json:"fields"`
+	WithDOI  int     `json:"with_doi"`
+	WithURL  int     `json:"with_url"`
+	Findings []Count `json:"check_findings,omitempty"`
+}
+
+// yearPrefix matches the year at the start of a biblatex date.
+var yearPrefix = regexp.MustCompile(`^\s*(\d{4})`)
+
+// sortedCounts converts a map of counts into a list sorted by decreasing count
+// (ties broken by name). If top > 0, only the first top counts are returned.
+func sortedCounts(counts map[string]int, top int) []Count {
+	list := make([]Count, 0, len(counts))
+	for name, n := range counts {
+		list = append(list, Count{name, n})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Name < list[j].Name
+	})
+	if top > 0 && len(list) > top {
+		list = list[:top]
+	}
+	return list
+}
+
+// mostCommon returns the most common string in names, breaking ties by
+// the one seen first.
+func mostCommon(names []string) string {
+	counts := make(map[string]int)
+	best := ""
+	for _, n := range names {
+		counts[n]++
+		if counts[n] > counts[best] {
+			best = n
+		}
+	}
+	return best
+}
+
+// entryYear returns the year of e as a string, taken from the year field or
+// the start of the date field, or "" if neither is present.
+func (db *Database) entryYear(e *Entry) string {
+	if v, ok := e.Fields["year"]; ok {
+		v = db.SymbolValue(v, 10)
+		if v.T == NumberType {
+			return strconv.Itoa(v.I)
+		}
+		return flattenForFilter(v.S)
+	}
+	if v, ok := e.Fields["date"]; ok {
+		v = db.SymbolValue(v, 10)
+		if m := yearPrefix.FindStringSubmatch(displayValue(v)); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// entryVenue returns the journal or booktitle of e with symbols expanded and
+// {} removed, or "" if it has neither.
+func (db *Database) entryVenue(e *Entry) string {
+	for _, tag := range []string{"journal", "journaltitle", "booktitle"} {
+		if v, ok := e.Fields[tag]; ok {
+			return flattenForFilter(displayValue(db.SymbolValue(v, 10)))
+		}
+	}
+	return ""
+}
+
+// ComputeStats summarizes the database. Venues are clustered in the same way
+// as SymbolizeJournalNames clusters journal names, and authors are grouped
+// as CheckAuthorVariants groups them, so that names are counted together only
+// if their first names agree word by word; each cluster is reported under its
+// most common spelling. Only the top venues and authors are listed.
+func (db *Database) ComputeStats(top int) *Stats {
+	s := &Stats{
+		Entries: len(db.Pubs),
+		Symbols: len(db.Symbols),
+	}
+
+	kinds := make(map[string]int)
+	years := make(map[string]int)
+	fields := make(map[string]int)
+	venueNames := make(map[string][]string)
+	allNames := make([]*Author, 0)
+	for _, e := range db.Pubs {
+		kinds[strings.ToLower(e.EntryString)]++
+
+		if y := db.entryYear(e); y != "" {
+			years[y]++
+		} else {
+			years["unknown"]++
+		}
+
+		for tag := range e.Fields {
+			fields[tag]++
+		}
+		if _, ok := e.Fields["doi"]; ok {
+			s.WithDOI++
+		}
+		if _, ok := e.Fields["url"]; ok {
+			s.WithURL++
+		}
+
+		if venue := db.entryVenue(e); venue != "" {
+			h := canonicalJournalName(venue)
+			venueNames[h] = append(venueNames[h], venue)
+		}
+
+		if names, ok := db.sortNames(e, "author"); ok {
+			allNames = append(allNames, names...)
+		}
+	}
+
+	s.ByKind = sortedCounts(kinds, 0)
+	s.Fields = sortedCounts(fields, 0)
+
+	// years are listed most recent first, followed by non-numeric years
+	s.ByYear = sortedCounts(years, 0)
+	sort.SliceStable(s.ByYear, func(i, j int) bool {
+		y1, err1 := strconv.Atoi(s.ByYear[i].Name)
+		y2, err2 := strconv.Atoi(s.ByYear[j].Name)
+		switch {
+		case err1 == nil && err2 == nil:
+			return y1 > y2
+		case err1 == nil || err2 == nil:
+			return err1 == nil
+		}
+		return s.ByYear[i].Name < s.ByYear[j].Name
+	})
+
+	venues := make(map[string]int)
+	for _, names := range venueNames {
+		venues[mostCommon(names)] += len(names)
+	}
+	s.Venues = sortedCounts(venues, top)
+
+	// names in a cluster share the identity of the cluster's first spelling
+	identity := make(map[string]string)
+	for _, c := range clusterNames(allNames) {
+		for _, v := range c.variants {
+			identity[v.author.String()] = c.variants[0].author.String()
+		}
+	}
+	authorNames := make(map[string][]string)
+	for _, a := range allNames {
+		if a.Others {
+			continue
+		}
+		id, ok := identity[a.String()]
+		if !ok {
+			id = a.String()
+		}
+		authorNames[id] = append(authorNames[id], a.String())
+	}
+	authors := make(map[string]int)
+	for _, names := range authorNames {
+		authors[mostCommon(names)] += len(names)
+	}
+	s.Authors = sortedCounts(authors, top)
+
+	return s
+}
+
+// percent returns n as a percentage of total.
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(total)
+}
+
+// writeCounts writes a titled table of counts to w.
+func writeCounts(w io.Writer, title string, counts []Count) {
+	fmt.Fprintf(w, "\n%s:\n", title)
+	if len(counts) == 0 {
+		fmt.Fprintf(w, "  (none)\n")
+	}
+	for _, c := range counts {
+		fmt.Fprintf(w, "  %6d  %s\n", c.Count, c.Name)
+	}
+}
+
+// Write writes the statistics to w as a set of tables.
+func (s *Stats) Write(w io.Writer) {
+	fmt.Fprintf(w, "Entries: %d\n", s.Entries)
+	fmt.Fprintf(w, "Symbols: %d\n", s.Symbols)
+	fmt.Fprintf(w, "With DOI: %d (%.1f%%)\n", s.WithDOI, percent(s.WithDOI, s.Entries))
+	fmt.Fprintf(w, "With URL: %d (%.1f%%)\n", s.WithURL, percent(s.WithURL, s.Entries))
+	writeCounts(w, "Entries by kind", s.ByKind)
+	writeCounts(w, "Entries by year", s.ByYear)
+	writeCounts(w, "Top venues", s.Venues)
+	writeCounts(w, "Top authors", s.Authors)
+	writeCounts(w, "Fields used", s.Fields)
+	if s.Findings != nil {
+		writeCounts(w, "Check findings", s.Findings)
+	}
+}
+
+// WriteJSON writes the statistics to w as JSON.
+func (s *Stats) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
@@ -0,0 +1,52 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestComputeStats(t *testing.T) {
+	const in = `@string{jcb = {Journal of Computational Biology}}
+@article{a, author={Kingsford, Carl and Smith, J}, year=2010, journal=jcb, doi={x}}
+@article{b, author={Kingsford, C.}, year=9, journal={Journal of Computational Biology.}, url={u}}
+@article{c, author={Carl Kingsford}, date={2019-01-02}, journal={journal of computational biology}}
+@inproceedings{d, booktitle={RECOMB}}
+`
+	db := NewParser(strings.NewReader(in)).ParseBibTeX()
+	s := db.ComputeStats(1)
+
+	if s.Entries != 4 || s.Symbols != 1 || s.WithDOI != 1 || s.WithURL != 1 {
+		t.Errorf("wrong totals: %+v", s)
+	}
+	if len(s.ByKind) != 2 || s.ByKind[0] != (Count{"article", 3}) {
+		t.Errorf("by kind = %v", s.ByKind)
+	}
+	years := make([]string, 0)
+	for _, c := range s.ByYear {
+		years = append(years, c.Name)
+	}
+	if strings.Join(years, ",") != "2019,2010,9,unknown" {
+		t.Errorf("by year = %v", s.ByYear)
+	}
+	if len(s.Venues) != 1 || s.Venues[0] != (Count{"Journal of Computational Biology", 3}) {
+		t.Errorf("venues = %v", s.Venues)
+	}
+	if len(s.Authors) != 1 || s.Authors[0] != (Count{"Kingsford, Carl", 3}) {
+		t.Errorf("authors = %v", s.Authors)
+	}
+
+	// with a Catherine Kingsford, "Kingsford, C." could be either, so it's
+	// counted on its own, and the two are never counted together
+	db = NewParser(strings.NewReader(in + `@misc{e, author={Catherine Kingsford}}`)).ParseBibTeX()
+	s = db.ComputeStats(5)
+	exp := []Count{{"Kingsford, Carl", 2}, {"Kingsford, C.", 1}, {"Kingsford, Catherine", 1}, {"Smith, J", 1}}
+	if len(s.Authors) != len(exp) {
+		t.Fatalf("authors = %v, expected %v", s.Authors, exp)
+	}
+	for i := range exp {
+		if s.Authors[i] != exp[i] {
+			t.Errorf("authors = %v, expected %v", s.Authors, exp)
+		}
+	}
+}
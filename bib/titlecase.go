@@ -0,0 +1,441 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*=====================================================================================
+ * Sentence case and title case for titles
+ *
+ * Bibliography styles differ in whether they print titles in sentence case
+ * ("A study of Markov chains") or title case ("A Study of Markov Chains").
+ * Styles that sentence-case titles lowercase every letter that isn't inside
+ * {}, so proper nouns and acronyms have to be braced to survive.
+ *====================================================================================*/
+
+// TitleCaseMode says how the case of titles is changed.
+type TitleCaseMode int
+
+const (
+	// KeepCase leaves the case of titles alone.
+	KeepCase TitleCaseMode = iota
+	// SentenceCase capitalizes only the first word of the title and of each
+	// subtitle.
+	SentenceCase
+	// TitleCase capitalizes every word except the small words (a, the, of,
+	// ...) that aren't the first word of the title or of a subtitle.
+	TitleCase
+)
+
+// ParseTitleCaseMode parses "sentence", "title" or "keep" into a
+// TitleCaseMode.
+func ParseTitleCaseMode(s string) (TitleCaseMode, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "sentence":
+		return SentenceCase, nil
+	case "title":
+		return TitleCase, nil
+	case "keep", "":
+		return KeepCase, nil
+	}
+	return KeepCase, fmt.Errorf("unknown title case %q: must be sentence, title or keep", s)
+}
+
+// defaultProperNouns are the words that are always protected in titles, in
+// addition to those given by the user.
+var defaultProperNouns = []string{
+	"Bayes", "Bayesian", "Bernoulli", "Boolean", "Dirichlet", "Euclidean",
+	"Euler", "Fourier", "Gaussian", "Gibbs", "Hamiltonian", "Hamming",
+	"Hilbert", "Hopfield", "Kalman", "Laplace", "Laplacian", "Levenshtein",
+	"Markov", "Markovian", "Monte", "Carlo", "Newton", "Pareto", "Poisson",
+	"Riemann", "Shannon", "Turing", "Wilcoxon", "Illumina", "Nanopore",
+	"PacBio", "Linux", "Unix", "Python", "Java", "English", "European",
+	"American", "African", "Asian", "Chinese", "Drosophila", "Arabidopsis",
+	"Escherichia", "Saccharomyces", "Mendelian", "Darwinian",
+}
+
+// properNounSet maps the lowercased plain text of proper nouns to the way
+// they are written.
+type properNounSet map[string]string
+
+// newProperNounSet returns the default proper nouns plus the given ones. Each
+// word of a multi-word name (e.g. "Monte Carlo") is added separately.
+func newProperNounSet(extra []string) properNounSet {
+	set := make(properNounSet)
+	for _, list := range [][]string{defaultProperNouns, extra} {
+		for _, name := range list {
+			for _, w := range strings.Fields(name) {
+				set[strings.ToLower(latexToText(w))] = w
+			}
+		}
+	}
+	return set
+}
+
+// lookup returns the way the proper noun word (in plain text) is written, and
+// whether it's a proper noun.
+func (p properNounSet) lookup(word string) (string, bool) {
+	name, ok := p[strings.ToLower(word)]
+	return name, ok
+}
+
+// splitTopLevelWords splits s into words and runs of whitespace, treating
+// {}-delimited text as part of a word. s == strings.Join(return, "").
+func splitTopLevelWords(s string) []string {
+	words := make([]string, 0)
+	start := 0
+	nbrace := 0
+	inspace := false
+	for i, r := range s {
+		space := unicode.IsSpace(r) && nbrace == 0
+		if i > start && space != inspace {
+			words = append(words, s[start:i])
+			start = i
+		}
+		inspace = space
+		switch r {
+		case '{':
+			nbrace++
+		case '}':
+			nbrace--
+		}
+	}
+	if start < len(s) {
+		words = append(words, s[start:])
+	}
+	return words
+}
+
+// isCaseProtected returns true iff the word contains math or a {} group that
+// protects case (rather than one that just delimits an accent, like {\"o}).
+func isCaseProtected(w string) bool {
+	if strings.Contains(w, "$") {
+		return true
+	}
+	bn, size := ParseBraceTree(w)
+	if size != len(w) {
+		return true
+	}
+	for _, c := range bn.Children {
+		if !c.IsLeaf() && !isDecorationGroup(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// trimWordPunct splits w into leading punctuation, the word itself and
+// trailing punctuation. Braces and backslashes belong to the word.
+func trimWordPunct(w string) (string, string, string) {
+	isPunct := func(r rune) bool {
+		return (unicode.IsPunct(r) || unicode.IsSymbol(r)) && r != '{' && r != '}' && r != '\\'
+	}
+	core := strings.TrimLeftFunc(w, isPunct)
+	pre := w[:len(w)-len(core)]
+	trimmed := strings.TrimRightFunc(core, isPunct)
+	return pre, trimmed, core[len(trimmed):]
+}
+
+// caseSwappedSpecials maps the special letter commands to the commands for
+// the same letter in the other case.
+var caseSwappedSpecials = map[string]string{
+	"o": "O", "O": "o", "ae": "AE", "AE": "ae", "oe": "OE", "OE": "oe",
+	"aa": "AA", "AA": "aa", "l": "L", "L": "l",
+}
+
+// setFirstLetterCase changes the case of the first letter of a LaTeX word,
+// looking inside accent commands ({\'e}, \c{c}) and special letters (\o). If
+// the word starts with a digit or another command, it's returned unchanged.
+func setFirstLetterCase(w string, upper bool) string {
+	change := unicode.ToLower
+	if upper {
+		change = unicode.ToUpper
+	}
+	for i := 0; i < len(w); {
+		r, size := utf8.DecodeRuneInString(w[i:])
+		switch {
+		case r == '\\':
+			j := i + 1
+			for j < len(w) && (w[j] >= 'a' && w[j] <= 'z' || w[j] >= 'A' && w[j] <= 'Z') {
+				j++
+			}
+			name := w[i+1 : j]
+			if name == "" && j < len(w) && strings.ContainsRune("`'^\"~=.", rune(w[j])) {
+				// a symbol accent like \'
+				i = j + 1
+			} else if swapped, ok := caseSwappedSpecials[name]; ok {
+				if unicode.IsUpper(rune(name[0])) != upper {
+					return w[:i+1] + swapped + w[j:]
+				}
+				return w
+			} else if len(name) == 1 && strings.Contains("cuvHkrdbt", name) {
+				// a letter accent like \c
+				i = j
+			} else {
+				return w
+			}
+		case unicode.IsLetter(r):
+			return w[:i] + string(change(r)) + w[i+size:]
+		case r == '{' || unicode.IsSpace(r) || unicode.IsPunct(r):
+			i += size
+		default:
+			return w
+		}
+	}
+	return w
+}
+
+// isTitleLowerWord returns true iff w is one of the small words that title
+// case leaves in lowercase.
+func isTitleLowerWord(w string) bool {
+	for _, s := range titleLowerWords {
+		if strings.EqualFold(s, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSubtitleBreak returns true iff a word ending in s ends a sentence or
+// starts a subtitle, so the next word is capitalized.
+func isSubtitleBreak(s string) bool {
+	s = strings.TrimRight(s, `}'")`)
+	return strings.HasSuffix(s, ":") || strings.HasSuffix(s, "?") || strings.HasSuffix(s, "!") ||
+		strings.HasSuffix(s, "---") || strings.HasSuffix(s, "—")
+}
+
+// changeSegmentCase changes the case of one hyphen-separated part of a word,
+// bracing it instead if it's a proper noun or an acronym.
+func changeSegmentCase(seg string, mode TitleCaseMode, first bool, nouns properNounSet) string {
+	pre, core, post := trimWordPunct(seg)
+	if core == "" {
+		return seg
+	}
+	plain := latexToText(core)
+
+	// a possessive proper noun is braced without the 's
+	possessive := ""
+	if p := strings.TrimSuffix(strings.TrimSuffix(plain, "'s"), "’s"); p != plain {
+		if _, ok := nouns.lookup(p); ok {
+			possessive = core[len(core)-len(plain)+len(p):]
+			core = core[:len(core)-len(possessive)]
+			plain = p
+		}
+	}
+	if name, ok := nouns.lookup(plain); ok {
+		if !strings.Contains(core, `\`) && !strings.Contains(core, "{") {
+			core = name
+		}
+		return pre + "{" + core + "}" + possessive + post
+	}
+
+	letters := 0
+	for _, r := range plain {
+		if unicode.IsLetter(r) {
+			letters++
+		}
+	}
+	if IsStrangeCase(plain) || (letters == 1 && !first && plain != "A" && strings.ToUpper(plain) == plain) {
+		// acronyms, words like mRNA, and single capital letters (type I)
+		return pre + "{" + core + "}" + possessive + post
+	}
+
+	upper := first
+	if mode == TitleCase && !isTitleLowerWord(plain) {
+		upper = true
+	}
+	return pre + setFirstLetterCase(core, upper) + possessive + post
+}
+
+// changeTitleCase returns the title s in sentence or title case. Words that
+// are already protected by {} are left alone; proper nouns and acronyms are
+// braced so styles that change the case of titles leave them alone.
+func changeTitleCase(s string, mode TitleCaseMode, nouns properNounSet) string {
+	if mode == KeepCase {
+		return s
+	}
+	words := splitTopLevelWords(s)
+	start := true
+	for i, w := range words {
+		if strings.TrimSpace(w) == "" {
+			continue
+		}
+		if isCaseProtected(w) {
+			start = isSubtitleBreak(w)
+			continue
+		}
+
+		// change each part between hyphens and em-dashes (--- or —),
+		// capitalizing the part after an em-dash
+		var b strings.Builder
+		segStart := start
+		for k, part := range strings.Split(w, "—") {
+			if k > 0 {
+				b.WriteString("—")
+				segStart = true
+			}
+			for j, seg := range strings.Split(part, "-") {
+				if j > 0 {
+					b.WriteString("-")
+					if strings.HasSuffix(b.String(), "---") {
+						segStart = true
+					}
+				}
+				if seg == "" {
+					continue
+				}
+				b.WriteString(changeSegmentCase(seg, mode, segStart, nouns))
+				segStart = isSubtitleBreak(seg)
+			}
+		}
+		words[i] = b.String()
+		start = isSubtitleBreak(w)
+	}
+	return strings.Join(words, "")
+}
+
+// ConvertTitleCase changes the case of the title and booktitle fields to
+// sentence case or title case, bracing proper nouns and acronyms so that
+// styles that change the case of titles leave them alone. The proper nouns
+// are a built-in list plus properNouns. Words that are already protected by
+// {} aren't changed.
+func (db *Database) ConvertTitleCase(mode TitleCaseMode, properNouns []string) {
+	if mode == KeepCase {
+		return
+	}
+	nouns := newProperNounSet(properNouns)
+	db.TransformEachField(
+		func(tag string, v *Value) *Value {
+			if v.T == StringType && (tag == "title" || tag == "booktitle") {
+				if _, size := ParseBraceTree(v.S); size == len(v.S) {
+					v.S = mergeBraces(changeTitleCase(v.S, mode, nouns))
+				}
+			}
+			return v
+		})
+}
+
+/*-------------------------------------------------------------------------------------
+ * Unprotected acronyms and proper nouns
+ *------------------------------------------------------------------------------------*/
+
+// protectionScanner finds the words of a title that styles that change the
+// case of titles would lowercase: acronyms, strange-case words and proper
+// nouns that aren't inside {}. Words are scanned in order, so it can skip
+// math and proper nouns that start the title or a subtitle (which keep their
+// capital).
+type protectionScanner struct {
+	nouns  properNounSet
+	inMath bool
+	start  bool
+}
+
+// newProtectionScanner returns a scanner for a new title.
+func newProtectionScanner(nouns properNounSet) *protectionScanner {
+	return &protectionScanner{nouns: nouns, start: true}
+}
+
+// scan classifies the next word of the title, which isn't inside {}. If the
+// word needs protection, it returns the punctuation before it, the part that
+// should be braced, the rest of the word, and what kind of word it is;
+// otherwise kind is "".
+func (ps *protectionScanner) scan(w string) (pre, word, post, kind string) {
+	if strings.TrimSpace(w) == "" {
+		return "", w, "", ""
+	}
+	start := ps.start
+	ps.start = isSubtitleBreak(w)
+	if ps.inMath || strings.Contains(w, "$") {
+		if (strings.Count(w, "$")-strings.Count(w, `\$`))%2 == 1 {
+			ps.inMath = !ps.inMath
+		}
+		return "", w, "", ""
+	}
+
+	pre, word, post = trimWordPunct(w)
+	plain := latexToText(word)
+	if word == "" || strings.Contains(plain, `\`) {
+		return "", w, "", ""
+	}
+
+	if p := strings.TrimSuffix(strings.TrimSuffix(plain, "'s"), "’s"); p != plain {
+		if _, ok := ps.nouns.lookup(p); ok {
+			possessive := word[len(word)-len(plain)+len(p):]
+			word, post = word[:len(word)-len(possessive)], possessive+post
+			plain = p
+		}
+	}
+
+	letters, upper := 0, 0
+	for _, r := range plain {
+		if unicode.IsLetter(r) {
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+		}
+	}
+	switch {
+	case letters >= 2 && upper == letters:
+		kind = "acronym"
+	case IsStrangeCase(plain):
+		kind = "strange-case word"
+	default:
+		if _, ok := ps.nouns.lookup(plain); ok && !start {
+			kind = "proper noun"
+		}
+	}
+	return pre, word, post, kind
+}
+
+// CheckUnprotectedWords reports acronyms, strange-case words and proper nouns
+// in title and booktitle that aren't inside {}, and so will be lowercased by
+// styles that change the case of titles. The proper nouns are a built-in list
+// plus properNouns.
+func (db *Database) CheckUnprotectedWords(properNouns []string) {
+	nouns := newProperNounSet(properNouns)
+	for _, e := range db.Pubs {
+		for _, tag := range []string{"title", "booktitle"} {
+			v, ok := e.Fields[tag]
+			if !ok || v.T != StringType {
+				continue
+			}
+			bn, size := ParseBraceTree(v.S)
+			if size != len(v.S) {
+				continue
+			}
+			ps := newProtectionScanner(nouns)
+			bn.flattenBracingWords(func(w string) string {
+				if _, word, _, kind := ps.scan(w); kind != "" {
+					db.addError(e, tag, fmt.Sprintf("%s %q isn't braced and will be lowercased by styles that change the case of titles", kind, word))
+				}
+				return w
+			})
+		}
+	}
+}
+
+// ProtectUnprotectedWords braces the words that CheckUnprotectedWords
+// reports. Only the word itself is braced, not the punctuation around it.
+func (db *Database) ProtectUnprotectedWords(properNouns []string) {
+	nouns := newProperNounSet(properNouns)
+	db.TransformEachField(
+		func(tag string, v *Value) *Value {
+			if v.T == StringType && (tag == "title" || tag == "booktitle") {
+				if bn, size := ParseBraceTree(v.S); size == len(v.S) {
+					ps := newProtectionScanner(nouns)
+					v.S = mergeBraces(bn.flattenBracingWords(func(w string) string {
+						if pre, word, post, kind := ps.scan(w); kind != "" {
+							return pre + "{" + word + "}" + post
+						}
+						return w
+					}))
+				}
+			}
+			return v
+		})
+}
@@ -0,0 +1,108 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChangeTitleCase(t *testing.T) {
+	nouns := newProperNounSet([]string{"Illumina", `Schr\"odinger`})
+	tests := []struct {
+		in, sentence, title string
+	}{
+		{
+			"RiboGalaxy: A Browser Based Platform for the Alignment of {DNA} Reads",
+			"{RiboGalaxy}: A browser based platform for the alignment of {DNA} reads",
+			"{RiboGalaxy}: A Browser Based Platform for the Alignment of {DNA} Reads",
+		},
+		{
+			"A study of markov chains---the Bayesian view of Whole-Genome RNA-seq",
+			"A study of {Markov} chains---The {Bayesian} view of whole-genome {RNA}-seq",
+			"A Study of {Markov} Chains---The {Bayesian} View of Whole-Genome {RNA}-Seq",
+		},
+		{
+			`{\"O}zt{\"u}rk's Method: An analysis of type I errors in Illumina data`,
+			`{\"O}zt{\"u}rk's method: An analysis of type {I} errors in {Illumina} data`,
+			`{\"O}zt{\"u}rk's Method: An Analysis of Type {I} Errors in {Illumina} Data`,
+		},
+		{
+			`Markov's inequality and {The Beatles} in $\alpha$-helices`,
+			`{Markov}'s inequality and {The Beatles} in $\alpha$-helices`,
+			`{Markov}'s Inequality and {The Beatles} in $\alpha$-helices`,
+		},
+		{
+			"Using mRNA In Yeast—a study",
+			"Using {mRNA} in yeast—A study",
+			"Using {mRNA} in Yeast—A Study",
+		},
+		{
+			`{\'e}tude of Schr\"odinger equations, COVID-19 and 3D genomes? why not`,
+			`{\'E}tude of {Schr\"odinger} equations, {COVID}-19 and {3D} genomes? Why not`,
+			`{\'E}tude of {Schr\"odinger} Equations, {COVID}-19 and {3D} Genomes? Why Not`,
+		},
+		{
+			`\o{}stergaard goes to the market`,
+			`\O{}stergaard goes to the market`,
+			`\O{}stergaard Goes to the Market`,
+		},
+	}
+	for _, tc := range tests {
+		if got := changeTitleCase(tc.in, SentenceCase, nouns); got != tc.sentence {
+			t.Errorf("sentence case of %q = %q, expected %q", tc.in, got, tc.sentence)
+		}
+		if got := changeTitleCase(tc.in, TitleCase, nouns); got != tc.title {
+			t.Errorf("title case of %q = %q, expected %q", tc.in, got, tc.title)
+		}
+		if got := changeTitleCase(tc.in, KeepCase, nouns); got != tc.in {
+			t.Errorf("keep case of %q = %q", tc.in, got)
+		}
+	}
+}
+
+func TestConvertTitleCase(t *testing.T) {
+	const in = `@inproceedings{a, title={Hidden Markov Models for Nanopore Reads},
+  booktitle={Proceedings of the international conference on Computational biology},
+  journal={Journal of Hidden Markov Models}}
+`
+	db := NewParser(strings.NewReader(in)).ParseBibTeX()
+	db.ConvertTitleCase(SentenceCase, []string{"Computational Biology"})
+	e := db.Pubs[0]
+	tests := map[string]string{
+		"title":     "Hidden {Markov} models for {Nanopore} reads",
+		"booktitle": "Proceedings of the international conference on {Computational Biology}",
+		"journal":   "Journal of Hidden Markov Models",
+	}
+	for tag, exp := range tests {
+		if got := e.Fields[tag].S; got != exp {
+			t.Errorf("%s = %q, expected %q", tag, got, exp)
+		}
+	}
+
+	if _, err := ParseTitleCaseMode("upper"); err == nil {
+		t.Errorf("ParseTitleCaseMode(upper) should fail")
+	}
+}
+
+func TestProtectUnprotectedWords(t *testing.T) {
+	const in = `@article{a, title={Assembling DNA (RNA-seq) with {GATK} in $O(N \log N)$: Bayesian Markov's models},
+  booktitle={Illumina Reads of the Illumina in Yeast—A Study}}
+`
+	db := NewParser(strings.NewReader(in)).ParseBibTeX()
+	db.CheckUnprotectedWords(nil)
+	if len(db.Errors) != 4 {
+		t.Errorf("found %d unprotected words, expected 4", len(db.Errors))
+	}
+
+	db.ProtectUnprotectedWords(nil)
+	e := db.Pubs[0]
+	tests := map[string]string{
+		"title":     `Assembling {DNA} ({RNA-seq}) with {GATK} in $O(N \log N)$: Bayesian {Markov}'s models`,
+		"booktitle": "Illumina Reads of the {Illumina} in Yeast—A Study",
+	}
+	for tag, exp := range tests {
+		if got := e.Fields[tag].S; got != exp {
+			t.Errorf("%s = %q, expected %q", tag, got, exp)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// (c) 2018-2022 by Carl Kingsford (carlk@cs.cmu.edu). See LICENSE.txt.
+package bib
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+/*=====================================================================================
+ * XML trees shared by the EndNote and MODS importers
+ *====================================================================================*/
+
+// xmlNode is an element of an XML document. Text holds the element's text,
+// including the text of its descendants, in document order.
+type xmlNode struct {
+	Name     string
+	Attrs    map[string]string
+	Children []*xmlNode
+	Text     string
+}
+
+// parseXMLTree reads an XML document and returns its root element. Namespaces
+// are ignored.
+func parseXMLTree(r io.Reader) (*xmlNode, error) {
+	dec := xml.NewDecoder(r)
+	dec.Strict = false
+	dec.AutoClose = xml.HTMLAutoClose
+	dec.Entity = xml.HTMLEntity
+
+	var root *xmlNode
+	stack := make([]*xmlNode, 0)
+	texts := make([]*strings.Builder, 0)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{Name: t.Name.Local, Attrs: make(map[string]string)}
+			for _, a := range t.Attr {
+				n.Attrs[a.Name.Local] = a.Value
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, n)
+			} else if root == nil {
+				root = n
+			}
+			stack = append(stack, n)
+			texts = append(texts, &strings.Builder{})
+		case xml.CharData:
+			for _, b := range texts {
+				b.Write(t)
+			}
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("unexpected </%s>", t.Name.Local)
+			}
+			stack[len(stack)-1].Text = strings.TrimSpace(texts[len(texts)-1].String())
+			stack = stack[:len(stack)-1]
+			texts = texts[:len(texts)-1]
+		}
+	}
+	if root == nil {
+		return nil, fmt.Errorf("no XML elements found")
+	}
+	return root, nil
+}
+
+// child returns the first child of n with the given name, or nil.
+func (n *xmlNode) child(name string) *xmlNode {
+	if n == nil {
+		return nil
+	}
+	for _, c := range n.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// all returns the children of n with the given name.
+func (n *xmlNode) all(name string) []*xmlNode {
+	nodes := make([]*xmlNode, 0)
+	if n == nil {
+		return nodes
+	}
+	for _, c := range n.Children {
+		if c.Name == name {
+			nodes = append(nodes, c)
+		}
+	}
+	return nodes
+}
+
+// path follows a path of child names from n, returning nil if any are
+// missing.
+func (n *xmlNode) path(names ...string) *xmlNode {
+	for _, name := range names {
+		n = n.child(name)
+	}
+	return n
+}
+
+// attr returns the value of the named attribute of n, or "".
+func (n *xmlNode) attr(name string) string {
+	if n == nil {
+		return ""
+	}
+	return n.Attrs[name]
+}
+
+// text returns the text of n with runs of whitespace collapsed, or "" if n is
+// nil.
+func (n *xmlNode) text() string {
+	if n == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(n.Text), " ")
+}
+
+// ReadXML reads an EndNote XML or MODS XML document, choosing the format from
+// the document's root element.
+func ReadXML(r io.Reader) (*Database, error) {
+	root, err := parseXMLTree(r)
+	if err != nil {
+		return nil, err
+	}
+	switch root.Name {
+	case "mods", "modsCollection":
+		return readMODSTree(root), nil
+	case "xml", "records":
+		return readEndNoteTree(root), nil
+	}
+	return nil, fmt.Errorf("unknown XML format with root element <%s>", root.Name)
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 
@@ -80,36 +81,155 @@ func parseBibFromArgs(c *subcommand) (*bib.Database, bool) {
 		c.flags.Usage()
 		return nil, false
 	}
+	return parseBibFile(c.flags.Arg(0))
+}
+
+// parseBibFile reads the named bib file and returns the database. The format
+// of the file is chosen by its extension, and is BibTeX if the extension isn't
+// known.
+func parseBibFile(fn string) (*bib.Database, bool) {
+	return readBibFile(fn, "")
+}
+
+// readBibFile reads the named file in the named format (or the format chosen
+// by its extension if format is "") and returns the database. Syntax errors
+// and anything that couldn't be imported are reported on stderr.
+func readBibFile(fn, format string) (*bib.Database, bool) {
+	var in *bib.Format
+	if format != "" {
+		var ok bool
+		if in, ok = bib.LookupFormat(format); !ok {
+			fmt.Printf("error: unknown input format %q (known formats: %s)\n", format, bib.FormatNames(true))
+			return nil, false
+		}
+	} else if f, ok := bib.FormatForFile(fn); ok {
+		in = f
+	} else {
+		in, _ = bib.LookupFormat("bibtex")
+	}
+	if in.Reader == nil {
+		fmt.Printf("error: can't read %s files\n", in.Name)
+		return nil, false
+	}
 
-	// read the bibtex file
-	f, err := os.Open(c.flags.Arg(0))
+	f, err := os.Open(fn)
 	if err != nil {
-		fmt.Printf("error: couldn't open %s\n", c.flags.Arg(0))
+		fmt.Printf("error: couldn't open %s\n", fn)
 		return nil, false
 	}
-	p := bib.NewParser(f)
-	db := p.ParseBibTeX()
-	if p.NErrors() > 0 {
-		p.PrintErrors(os.Stderr)
+	defer f.Close()
+
+	db, err := in.Read(f, os.Stderr)
+	if err != nil {
+		fmt.Printf("error: couldn't read %s: %v\n", fn, err)
+		return nil, false
+	}
+	if len(db.Errors) > 0 {
+		db.PrintErrors(os.Stderr)
+		db.Errors = nil
 	}
 	return db, true
+}
 
+// splitList splits a list given on the command line on sep, trimming the
+// items and dropping empty ones.
+func splitList(s, sep string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(s, sep) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// setDialect sets the dialect of db to the one named by a -dialect flag,
+// printing an error and returning false if there is no such dialect.
+func setDialect(db *bib.Database, name string) bool {
+	d, ok := bib.LookupDialect(name)
+	if !ok {
+		fmt.Printf("error: unknown dialect %q: must be one of %s\n", name, bib.DialectNames())
+		return false
+	}
+	db.Dialect = d
+	return true
+}
+
+// readStyle reads the BibTeX style file named by a -bst flag and makes the
+// dialect it defines the dialect of db. The style can't be combined with the
+// biblatex dialect, which doesn't use .bst files.
+func readStyle(db *bib.Database, fn string) (*bib.Style, bool) {
+	if db.Dialect != bib.BibTeXDialect {
+		fmt.Printf("error: -bst can only be used with the bibtex dialect\n")
+		return nil, false
+	}
+	f, err := os.Open(fn)
+	if err != nil {
+		fmt.Printf("error: couldn't open %s\n", fn)
+		return nil, false
+	}
+	defer f.Close()
+	style, err := bib.ReadStyle(f, filepath.Base(fn))
+	if err != nil {
+		fmt.Printf("error: couldn't read style %s: %v\n", fn, err)
+		return nil, false
+	}
+	db.Dialect = style.Dialect()
+	return style, true
 }
 
 // doClean reads a bibtex file and formats it using a "standard" format.
 func doClean(c *subcommand) bool {
-	sortby := c.flags.String("sort", "year", "sorts the entry by `field` or `none` to skip sort")
-	reverse := c.flags.Bool("reverse", true, "reverse the sort order")
+	sortby := c.flags.String("sort", "year", "sorts the entries by comma-separated `fields` (each optionally :asc or :desc) or `none` to skip sort")
+	reverse := c.flags.Bool("reverse", true, "reverse the sort order of fields without :asc or :desc")
 	blessed := c.flags.String("blessed", "", "Comma separated list of blessed `fields`")
 	minJournalOccurrences := c.flags.Int("merge-journal-names", -1, "Minimum number of occurrences for a journal name to be symbolized")
+	toUnicode := c.flags.Bool("unicode", false, "convert LaTeX accents and symbols to Unicode (for biber) instead of the reverse")
+	titleCase := c.flags.String("title-case", "keep", "change titles to `sentence` or `title` case, or keep their case")
+	properNouns := c.flags.String("proper-nouns", "", "comma separated list of proper `nouns` to protect in titles, in addition to the built-in list")
+	dialect := c.flags.String("dialect", "bibtex", "the `dialect` (bibtex or biblatex) that gives the entry types and fields")
+	inline := c.flags.Bool("inline-crossrefs", false, "copy inherited crossref and xdata fields into each entry and drop the references")
+	bst := c.flags.String("bst", "", "keep only the fields read by the BibTeX style `file` (.bst), and warn about entry types it has no function for")
+	mergeAuthors := c.flags.Bool("merge-authors", false, "rewrite names that look like the same person (e.g. \"Kingsford, C.\" and \"Kingsford, Carl\") to their most complete form")
+	organizations := c.flags.String("organizations", "", "comma separated list of organization `names` (or words that mark them) to brace in author lists, in addition to the built-in words")
+	firstNames := c.flags.String("first-names", "keep", "abbreviate first names to `initials`, expand initials to `full` names used elsewhere in the file, or keep them")
+	maxAuthors := c.flags.Int("max-authors", 0, "shorten author lists of more than `N` names to their first names followed by \"others\" (0 to keep every name)")
+	keepAuthors := c.flags.Int("keep-authors", 0, "the number of names `M` to keep in author lists shortened by -max-authors (0 to keep N)")
+	exemptAuthors := c.flags.String("exempt-authors", "", "semicolon separated list of `names` that -max-authors always keeps")
 	if !startSubcommand(c) {
 		return false
 	}
 
+	sortKeys, err := bib.ParseSortKeys(*sortby, *reverse)
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		return false
+	}
+	caseMode, err := bib.ParseTitleCaseMode(*titleCase)
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		return false
+	}
+	firstNameMode, err := bib.ParseFirstNameMode(*firstNames)
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		return false
+	}
+	if *keepAuthors > *maxAuthors {
+		fmt.Printf("error: -keep-authors (%d) must not be more than -max-authors (%d)\n", *keepAuthors, *maxAuthors)
+		return false
+	}
+
 	db, ok := parseBibFromArgs(c)
-	if !ok {
+	if !ok || !setDialect(db, *dialect) {
 		return false
 	}
+	var style *bib.Style
+	if *bst != "" {
+		if style, ok = readStyle(db, *bst); !ok {
+			return false
+		}
+	}
 
 	// parse the blessed fields
 	blessedArr := strings.Split(*blessed, ",")
@@ -118,17 +238,49 @@ func doClean(c *subcommand) bool {
 	}
 
 	// clean it up
+	if *inline {
+		db.InlineCrossrefs()
+	}
 	db.NormalizeWhitespace()
+	if *toUnicode {
+		db.ConvertLaTeXToUnicode()
+	} else {
+		convertUnicode(db)
+	}
 	db.RemoveWholeFieldBraces()
 	db.CanonicalBrace()
 	db.ConvertTitlesToMinBraces()
+	db.ConvertTitleCase(caseMode, splitList(*properNouns, ","))
 	db.ConvertIntStringsToInt()
 	db.ReplaceSymbols()
 	db.ReplaceAbbrMonths()
 	db.RemoveNonBlessedFields(blessedArr)
 	db.RemoveEmptyFields()
 	db.ReplaceAuthorEtAl()
+	protected := db.ProtectOrganizationAuthors(splitList(*organizations, ","))
+	if !quiet {
+		for _, r := range protected {
+			log.Printf("%s: Braced organization %q.\n", r.Key, r.Old)
+		}
+	}
 	db.NormalizeAuthors()
+	if *mergeAuthors {
+		replacements := db.MergeAuthorVariants()
+		if !quiet {
+			for _, r := range replacements {
+				log.Printf("%s: Replaced author %q with %q.\n", r.Key, r.Old, r.New)
+			}
+		}
+	}
+	db.ConvertFirstNames(firstNameMode)
+	if *maxAuthors > 0 {
+		truncated := db.TruncateAuthors(*maxAuthors, *keepAuthors, splitList(*exemptAuthors, ";"), splitList(*organizations, ","))
+		if !quiet {
+			for _, t := range truncated {
+				log.Printf("%s: Removed %d names from the author list.\n", t.Key, t.Removed)
+			}
+		}
+	}
 	db.RemovePeriodFromTitles()
 	db.FixHyphensInPages()
 	db.FixTruncatedPageNumbers()
@@ -145,7 +297,12 @@ func doClean(c *subcommand) bool {
 
 	db.RemoveExactDups()
 
-	db.SortByField(*sortby, *reverse)
+	db.SortByKeys(sortKeys)
+
+	if style != nil {
+		db.CheckStyleTypes(style)
+		db.PrintErrors(os.Stderr)
+	}
 
 	// write it out
 	db.WriteDatabase(os.Stdout)
@@ -155,38 +312,173 @@ func doClean(c *subcommand) bool {
 	return true
 }
 
-// doCheck runs the check command.
+// convertUnicode replaces non-ASCII characters with LaTeX, logging those
+// that have no LaTeX equivalent.
+func convertUnicode(db *bib.Database) {
+	unmapped := db.ConvertUnicodeToLaTeX()
+	if !quiet {
+		for _, u := range unmapped {
+			log.Printf("%s: %s: No LaTeX equivalent for %q (U+%04X).\n", u.Key, u.Tag, u.Char, u.Char)
+		}
+	}
+}
+
+// checkRule is a named check run by the check command. If fix is not nil,
+// check -fix runs it to repair what the check reports.
+type checkRule struct {
+	name string
+	run  func(*bib.Database)
+	fix  func(*bib.Database)
+}
+
+// checkProperNouns are the proper nouns, in addition to the built-in list,
+// that the unprotected-word check expects to be braced in titles.
+var checkProperNouns []string
+
+// checkStyle is the style given to check with -bst, or nil.
+var checkStyle *bib.Style
+
+// checkOrganizations are the names of organizations, or words that mark them,
+// in addition to the built-in words, that the organization-author check
+// expects to be braced.
+var checkOrganizations []string
+
+// checkRules lists the checks run by the check command, in order.
+var checkRules = []checkRule{
+	{"year-not-int", (*bib.Database).CheckYearsAreInt, nil},
+	{"et-al", (*bib.Database).CheckEtAl, nil},
+	{"non-ascii", (*bib.Database).CheckASCII, convertUnicode},
+	{"lone-hyphen", (*bib.Database).CheckLoneHyphenInTitle, nil},
+	{"page-range", (*bib.Database).CheckPageRanges, nil},
+	{"pages-start-at-one", (*bib.Database).CheckPagesStartAtOne, nil},
+	{"undefined-symbol", (*bib.Database).CheckUndefinedSymbols, nil},
+	{"duplicate-key", (*bib.Database).CheckDuplicateKeys, nil},
+	{"required-field", (*bib.Database).CheckRequiredFields, nil},
+	{"crossref", (*bib.Database).CheckCrossrefs, (*bib.Database).OrderCrossrefs},
+	{"unmatched-dollar", (*bib.Database).CheckUnmatchedDollarSigns, nil},
+	{"redundant-symbol", (*bib.Database).CheckRedundantSymbols, nil},
+	{"whole-field-braces", (*bib.Database).CheckWholeFieldBraces, nil},
+	{"unprotected-word", func(db *bib.Database) {
+		db.CheckUnprotectedWords(checkProperNouns)
+	}, func(db *bib.Database) {
+		db.ProtectUnprotectedWords(checkProperNouns)
+	}},
+	{"fragmented-braces", (*bib.Database).CheckFragmentedBraces, (*bib.Database).MergeAdjacentBraces},
+	{"style-type", func(db *bib.Database) {
+		if checkStyle != nil {
+			db.CheckStyleTypes(checkStyle)
+		}
+	}, nil},
+	{"unused-field", func(db *bib.Database) {
+		if checkStyle != nil {
+			db.CheckNonBlessedFields(nil)
+		}
+	}, func(db *bib.Database) {
+		if checkStyle != nil {
+			db.RemoveNonBlessedFields(nil)
+		}
+	}},
+	{"organization-author", func(db *bib.Database) {
+		db.CheckOrganizationAuthors(checkOrganizations)
+	}, func(db *bib.Database) {
+		db.ProtectOrganizationAuthors(checkOrganizations)
+	}},
+	{"author-last", func(db *bib.Database) {
+		db.NormalizeAuthors()
+		db.CheckAuthorLast()
+	}, nil},
+	{"author-variants", func(db *bib.Database) {
+		db.NormalizeAuthors()
+		db.CheckAuthorVariants()
+	}, nil},
+}
+
+// runChecks runs each of the checkRules on db and returns the number of
+// errors each one found.
+func runChecks(db *bib.Database) []bib.Count {
+	counts := make([]bib.Count, 0, len(checkRules))
+	for _, rule := range checkRules {
+		n := len(db.Errors)
+		rule.run(db)
+		counts = append(counts, bib.Count{Name: rule.name, Count: len(db.Errors) - n})
+	}
+	return counts
+}
+
+// doCheck runs the check command. With -fix, the problems that can be
+// repaired automatically are fixed first, the fixed database is written to
+// stdout and the remaining problems are written to stderr.
 func doCheck(c *subcommand) bool {
+	fix := c.flags.Bool("fix", false, "fix the problems that can be fixed automatically and write the fixed file")
+	properNouns := c.flags.String("proper-nouns", "", "comma separated list of proper `nouns` that should be braced in titles, in addition to the built-in list")
+	dialect := c.flags.String("dialect", "bibtex", "the `dialect` (bibtex or biblatex) that gives the entry types and fields")
+	bst := c.flags.String("bst", "", "check against the fields and entry types of the BibTeX style `file` (.bst)")
+	organizations := c.flags.String("organizations", "", "comma separated list of organization `names` (or words that mark them) that should be braced in author lists, in addition to the built-in words")
 	if !startSubcommand(c) {
 		return false
 	}
+	checkProperNouns = splitList(*properNouns, ",")
+	checkOrganizations = splitList(*organizations, ",")
 
 	db, ok := parseBibFromArgs(c)
-	if !ok {
+	if !ok || !setDialect(db, *dialect) {
 		return false
 	}
+	if *bst != "" {
+		if checkStyle, ok = readStyle(db, *bst); !ok {
+			return false
+		}
+	}
 
-	db.CheckYearsAreInt()
-	db.CheckEtAl()
-	db.CheckASCII()
-	db.CheckLoneHyphenInTitle()
-	db.CheckPageRanges()
-	db.CheckPagesStartAtOne()
-	db.CheckUndefinedSymbols()
-	db.CheckDuplicateKeys()
-	db.CheckRequiredFields()
-	db.CheckUnmatchedDollarSigns()
-	db.CheckRedundantSymbols()
-	db.CheckWholeFieldBraces()
+	if *fix {
+		for _, rule := range checkRules {
+			if rule.fix != nil {
+				rule.fix(db)
+			}
+		}
+		// write the fixed file before the checks run, since some of them
+		// (author-last, ...) normalize the names as they go
+		db.WriteDatabase(os.Stdout)
+	}
 
-	db.NormalizeAuthors()
-	db.CheckAuthorLast()
+	runChecks(db)
 
-	db.PrintErrors(os.Stdout)
+	if *fix {
+		db.PrintErrors(os.Stderr)
+	} else {
+		db.PrintErrors(os.Stdout)
+	}
 
 	return true
 }
 
+// doStats runs the stats command, summarizing the contents of a bib file.
+func doStats(c *subcommand) bool {
+	asJSON := c.flags.Bool("json", false, "write the statistics as JSON")
+	top := c.flags.Int("top", 10, "number of venues and authors to list")
+	if !startSubcommand(c) {
+		return false
+	}
+
+	db, ok := parseBibFromArgs(c)
+	if !ok {
+		return false
+	}
+
+	stats := db.ComputeStats(*top)
+	stats.Findings = runChecks(db)
+
+	if *asJSON {
+		if err := stats.WriteJSON(os.Stdout); err != nil {
+			log.Printf("error: %v", err)
+			return false
+		}
+	} else {
+		stats.Write(os.Stdout)
+	}
+	return true
+}
+
 // doDups runs the dups command, identifying and printing possible duplicates.
 func doDups(c *subcommand) bool {
 	if !startSubcommand(c) {
@@ -198,7 +490,7 @@ func doDups(c *subcommand) bool {
 		return false
 	}
 
-	for hash, list := range db.FindDupsByTitle() {
+	for hash, list := range db.Resolved().FindDupsByTitle() {
 		if hash != "" && len(list) > 1 {
 			fmt.Printf("Possible Duplicates:\n")
 			for _, e := range list {
@@ -211,6 +503,251 @@ func doDups(c *subcommand) bool {
 	return true
 }
 
+// doFilter runs the filter command, writing out the entries that match the
+// given expression.
+func doFilter(c *subcommand) bool {
+	if !startSubcommand(c) {
+		return false
+	}
+
+	if c.flags.NArg() < 2 {
+		fmt.Println("error: usage: biblint filter in.bib expression")
+		c.flags.Usage()
+		return false
+	}
+
+	filter, err := bib.ParseFilter(strings.Join(c.flags.Args()[1:], " "))
+	if err != nil {
+		fmt.Printf("error: bad filter expression: %v\n", err)
+		return false
+	}
+
+	db, ok := parseBibFromArgs(c)
+	if !ok {
+		return false
+	}
+
+	out := db.Filter(filter)
+	out.WriteDatabase(os.Stdout)
+	if !quiet {
+		log.Printf("Wrote %d of %d publications.", len(out.Pubs), len(db.Pubs))
+	}
+	return true
+}
+
+// doDiff runs the diff command, reporting the differences between the
+// entries of two bib files.
+func doDiff(c *subcommand) bool {
+	asJSON := c.flags.Bool("json", false, "write the differences as JSON")
+	if !startSubcommand(c) {
+		return false
+	}
+
+	if c.flags.NArg() != 2 {
+		fmt.Println("error: usage: biblint diff old.bib new.bib")
+		c.flags.Usage()
+		return false
+	}
+
+	oldDB, ok := parseBibFile(c.flags.Arg(0))
+	if !ok {
+		return false
+	}
+	newDB, ok := parseBibFile(c.flags.Arg(1))
+	if !ok {
+		return false
+	}
+
+	d := bib.Diff(oldDB, newDB)
+	if *asJSON {
+		if err := d.WriteJSON(os.Stdout); err != nil {
+			log.Printf("error: %v", err)
+			return false
+		}
+	} else {
+		d.Write(os.Stdout)
+	}
+	return true
+}
+
+// readCitations reads the citations from a .tex, .aux, or .bcf file into
+// cites, following any files that it includes. As in LaTeX, included paths
+// are relative to dir, the directory of the main file, and included files
+// that can't be found (like those from the TeX tree) are skipped with a
+// warning. Files in seen are skipped.
+func readCitations(cites *bib.Citations, fn, dir string, seen map[string]bool) bool {
+	if seen[fn] {
+		return true
+	}
+	seen[fn] = true
+
+	f, err := os.Open(fn)
+	if err != nil {
+		fmt.Printf("error: couldn't open %s\n", fn)
+		return false
+	}
+	defer f.Close()
+
+	var includes []string
+	switch strings.ToLower(filepath.Ext(fn)) {
+	case ".aux":
+		includes = cites.AddAux(f)
+	case ".bcf":
+		if err := cites.AddBcf(f); err != nil {
+			fmt.Printf("error: couldn't parse %s: %v\n", fn, err)
+			return false
+		}
+	default:
+		includes = cites.AddTeX(f)
+		for i, inc := range includes {
+			if filepath.Ext(inc) == "" {
+				includes[i] = inc + ".tex"
+			}
+		}
+	}
+
+	for _, inc := range includes {
+		if !filepath.IsAbs(inc) {
+			inc = filepath.Join(dir, inc)
+		}
+		if _, err := os.Stat(inc); err != nil {
+			log.Printf("warning: couldn't open %s included by %s; skipping it\n", inc, fn)
+			continue
+		}
+		if !readCitations(cites, inc, dir, seen) {
+			return false
+		}
+	}
+	return true
+}
+
+// doXref runs the xref command, reporting entries that are not cited and
+// citations that have no entry.
+func doXref(c *subcommand) bool {
+	if !startSubcommand(c) {
+		return false
+	}
+
+	if c.flags.NArg() < 2 {
+		fmt.Println("error: usage: biblint xref in.bib main.tex|main.aux|main.bcf ...")
+		c.flags.Usage()
+		return false
+	}
+
+	db, ok := parseBibFromArgs(c)
+	if !ok {
+		return false
+	}
+
+	cites := bib.NewCitations()
+	seen := make(map[string]bool)
+	for _, fn := range c.flags.Args()[1:] {
+		if !readCitations(cites, fn, filepath.Dir(fn), seen) {
+			return false
+		}
+	}
+
+	db.CheckCitations(cites)
+	db.PrintErrors(os.Stdout)
+
+	return true
+}
+
+// doRender writes the entries of a bib file as a formatted reference list.
+func doRender(c *subcommand) bool {
+	style := c.flags.String("style", "acm", "citation `style`: acm, apa or ieee")
+	format := c.flags.String("format", "txt", "output `format`: txt, md or html")
+	initials := c.flags.Bool("initials", false, "abbreviate first names to initials")
+	etAl := c.flags.Int("et-al", 0, "shorten name lists with more than `N` names (0 = never)")
+	etAlKeep := c.flags.Int("et-al-keep", 1, "number of names to keep before \"et al.\" in shortened lists")
+	bold := c.flags.String("bold", "", "semicolon-separated `names` to write in bold")
+	groupBy := c.flags.String("group", "", "group entries by `year` or `kind`")
+	if !startSubcommand(c) {
+		return false
+	}
+
+	db, ok := parseBibFromArgs(c)
+	if !ok {
+		return false
+	}
+
+	opts := &bib.RenderOptions{
+		Style:    strings.ToLower(*style),
+		Format:   strings.ToLower(*format),
+		Initials: *initials,
+		EtAl:     *etAl,
+		EtAlKeep: *etAlKeep,
+		GroupBy:  strings.ToLower(*groupBy),
+	}
+	for _, name := range strings.Split(*bold, ";") {
+		if strings.TrimSpace(name) != "" {
+			opts.Bold = append(opts.Bold, name)
+		}
+	}
+	if err := db.Render(os.Stdout, opts); err != nil {
+		fmt.Printf("error: %v\n", err)
+		return false
+	}
+	return true
+}
+
+// doConvert reads a file in one format and writes it in another.
+func doConvert(c *subcommand) bool {
+	from := c.flags.String("from", "", "input `format` ("+bib.FormatNames(true)+"); chosen by the file's extension by default")
+	to := c.flags.String("to", "bibtex", "output `format` ("+bib.FormatNames(false)+")")
+	toDialect := c.flags.String("to-dialect", "", "convert the entry types and fields to the `dialect` (bibtex or biblatex)")
+	inline := c.flags.Bool("inline-crossrefs", false, "copy inherited crossref and xdata fields into each entry and drop the references")
+	if !startSubcommand(c) {
+		return false
+	}
+
+	if c.flags.NArg() < 1 {
+		fmt.Println("error: missing filename in fmt")
+		c.flags.Usage()
+		return false
+	}
+	out, ok := bib.LookupFormat(*to)
+	if !ok {
+		fmt.Printf("error: unknown output format %q (known formats: %s)\n", *to, bib.FormatNames(false))
+		return false
+	} else if out.Writer == nil {
+		fmt.Printf("error: can't write %s files\n", out.Name)
+		return false
+	}
+	var dialect *bib.Dialect
+	if *toDialect != "" {
+		if dialect, ok = bib.LookupDialect(*toDialect); !ok {
+			fmt.Printf("error: unknown dialect %q: must be one of %s\n", *toDialect, bib.DialectNames())
+			return false
+		}
+	}
+
+	db, ok := readBibFile(c.flags.Arg(0), *from)
+	if !ok {
+		return false
+	}
+	if *inline {
+		// a file being converted to BibTeX is read with biblatex's rules
+		if dialect == bib.BibTeXDialect {
+			db.Dialect = bib.BibLaTeXDialect
+		}
+		db.InlineCrossrefs()
+	}
+	if dialect != nil {
+		db.ConvertToDialect(dialect)
+		db.PrintErrors(os.Stderr)
+	}
+
+	if err := out.Writer.Write(os.Stdout, db); err != nil {
+		fmt.Printf("error: %v\n", err)
+		return false
+	}
+	if !quiet {
+		log.Printf("Converted %d publications.", len(db.Pubs))
+	}
+	return true
+}
+
 // printBanner prints out the version, tool name and copyright info
 func printBanner() {
 	fmt.Fprintf(os.Stderr, "biblint %s (c) 2017-2026 Carl Kingsford. See LICENSE.txt.\n", version)
@@ -221,6 +758,12 @@ func registerAllSubcommands() {
 	registerSubcommand("clean", "Clean up nonsense in a BibTeX file", doClean)
 	registerSubcommand("check", "Look for errors that can't be automatically corrected", doCheck)
 	registerSubcommand("dups", "Look for duplicate entries", doDups)
+	registerSubcommand("stats", "Summarize the contents of a BibTeX file", doStats)
+	registerSubcommand("diff", "Compare the entries in two BibTeX files", doDiff)
+	registerSubcommand("filter", "Select the entries that match an expression", doFilter)
+	registerSubcommand("xref", "Check citations in a LaTeX project against a BibTeX file", doXref)
+	registerSubcommand("render", "Write a formatted reference list", doRender)
+	registerSubcommand("convert", "Convert between BibTeX and other formats", doConvert)
 }
 
 func main() {
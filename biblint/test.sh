@@ -42,3 +42,35 @@ for f in tests/check_*_in.bib ; do
         echo "PASSED: $bn"
     fi
 done
+
+echo "# ===================="
+echo "#   biblint check -fix"
+echo "# ===================="
+for f in tests/checkfix_*_in.bib ; do
+    bn=`basename $f _in.bib`
+    exp="tests/${bn}_exp.bib"
+    out="$TESTOUTDIR/${bn}_out.bib"
+
+    ./biblint check -fix -quiet=true $f > $out 2> /dev/null
+    if ! cmp -s $exp $out ; then
+        echo "FAILED: $bn `cmp $exp $out`"
+    else
+        echo "PASSED: $bn"
+    fi
+done
+
+echo "# ===================="
+echo "#   biblint xref"
+echo "# ===================="
+for f in tests/xref_*_in.bib ; do
+    bn=`basename $f _in.bib`
+    exp="tests/${bn}_exp.bib"
+    out="$TESTOUTDIR/${bn}_out.bib"
+
+    ./biblint xref -quiet=true $f tests/${bn}_in.tex > $out
+    if ! cmp -s $exp $out ; then
+        echo "FAILED: $bn `cmp $exp $out`"
+    else
+        echo "PASSED: $bn"
+    fi
+done